@@ -37,6 +37,8 @@ POSSIBILITY OF SUCH DAMAGE.
 package virgil
 
 import (
+	"encoding/base64"
+
 	"github.com/pkg/errors"
 	"gopkg.in/virgil.v4/virgilcrypto"
 )
@@ -79,6 +81,18 @@ func (c *Card) Verify(data, signature []byte) (bool, error) {
 	return Crypto().Verify(data, signature, c.PublicKey)
 }
 
+//PrekeyCard returns the public key of a prekey card along with its signature made with the identity key
+func (c *Card) PrekeyCard() (*virgilcrypto.PrekeyCard, error) {
+	signature, err := base64.StdEncoding.DecodeString(c.Data[PrekeySignatureField])
+	if err != nil {
+		return nil, errors.Wrap(err, "Cannot decode prekey signature")
+	}
+	return &virgilcrypto.PrekeyCard{
+		Key:       c.PublicKey,
+		Signature: signature,
+	}, nil
+}
+
 func (c *Card) ToRequest() (*SignableRequest, error) {
 	if len(c.Snapshot) == 0 {
 		return nil, errors.New("The card has no snapshot")
@@ -0,0 +1,307 @@
+package virgil
+
+import (
+	"container/list"
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"gopkg.in/virgil.v4/errors"
+)
+
+//CardCacheSettings configures NewCachingClient. Zero fields take the default values
+type CardCacheSettings struct {
+	//Size is the maximum number of cached cards and searches, 10000 by default
+	Size int
+	//TTL is how long cards are kept, 5 minutes by default
+	TTL time.Duration
+	//NotFoundTTL is how long a missing card or an empty search result is kept, 30 seconds by default. Negative disables it
+	NotFoundTTL time.Duration
+}
+
+//CachingClient is a Client which keeps cards it got from the service in memory, least recently used are evicted first.
+//Only validated cards are cached, so the validator is not called again for cached ones.
+//Cards created, revoked or changed with relations through the same client are removed from the cache, changes made by other clients are seen after TTL.
+//Cached cards are shared between the callers and must not be modified. It is safe for concurrent use
+type CachingClient struct {
+	*Client
+	settings CardCacheSettings
+	now      func() time.Time
+
+	lock    sync.Mutex
+	lru     *list.List
+	entries map[cacheKey]*list.Element
+	//generation changes with every invalidation, so cards fetched before it are not cached
+	generation uint64
+}
+
+//cacheKey is either a card id or an identity of a search
+type cacheKey struct {
+	id           string
+	scope        Enum
+	identityType string
+	identity     string
+}
+
+type cacheEntry struct {
+	key     cacheKey
+	cards   []*Card
+	expires time.Time
+}
+
+//NewCachingClient wraps the client with the card cache
+func NewCachingClient(client *Client, settings CardCacheSettings) *CachingClient {
+	if settings.Size < 1 {
+		settings.Size = 10000
+	}
+	if settings.TTL <= 0 {
+		settings.TTL = 5 * time.Minute
+	}
+	if settings.NotFoundTTL == 0 {
+		settings.NotFoundTTL = 30 * time.Second
+	}
+	return &CachingClient{
+		Client:   client,
+		settings: settings,
+		now:      time.Now,
+		lru:      list.New(),
+		entries:  make(map[cacheKey]*list.Element),
+	}
+}
+
+func (c *CachingClient) GetCard(id string) (*Card, error) {
+	return c.GetCardContext(context.Background(), id)
+}
+
+//GetCardContext returns the cached card or ErrNotFound if the card is known to be missing
+func (c *CachingClient) GetCardContext(ctx context.Context, id string) (*Card, error) {
+	key := cacheKey{id: id}
+	if cards, ok := c.get(key); ok {
+		if len(cards) == 0 {
+			return nil, ErrNotFound
+		}
+		return cards[0], nil
+	}
+
+	gen := c.currentGeneration()
+	card, err := c.Client.GetCardContext(ctx, id)
+	if err != nil {
+		if errors.Cause(err) == ErrNotFound {
+			c.put(key, nil, gen)
+		}
+		return nil, err
+	}
+	c.put(key, []*Card{card}, gen)
+	return card, nil
+}
+
+func (c *CachingClient) SearchCards(criteria *Criteria) ([]*Card, error) {
+	return c.SearchCardsContext(context.Background(), criteria)
+}
+
+//SearchCardsContext caches cards of every identity of the criteria, so only identities which are not cached are searched for
+func (c *CachingClient) SearchCardsContext(ctx context.Context, criteria *Criteria) ([]*Card, error) {
+	if criteria == nil || len(criteria.Identities) == 0 {
+		return c.Client.SearchCardsContext(ctx, criteria)
+	}
+
+	found := make(map[string][]*Card)
+	var missing []string
+	for _, identity := range criteria.Identities {
+		if _, ok := found[identity]; ok {
+			continue
+		}
+		if cards, ok := c.get(searchKey(criteria, identity)); ok {
+			found[identity] = cards
+		} else {
+			found[identity] = nil
+			missing = append(missing, identity)
+		}
+	}
+
+	if len(missing) > 0 {
+		gen := c.currentGeneration()
+		cards, err := c.Client.SearchCardsContext(ctx, &Criteria{
+			Scope:        criteria.Scope,
+			IdentityType: criteria.IdentityType,
+			Identities:   missing,
+		})
+		if err != nil {
+			return nil, err
+		}
+		for _, card := range cards {
+			found[card.Identity] = append(found[card.Identity], card)
+		}
+		for _, identity := range missing {
+			c.put(searchKey(criteria, identity), found[identity], gen)
+		}
+	}
+
+	var res []*Card
+	for _, identity := range criteria.Identities {
+		res = append(res, found[identity]...)
+		delete(found, identity)
+	}
+	return res, nil
+}
+
+func (c *CachingClient) CreateCard(request *SignableRequest) (*Card, error) {
+	return c.CreateCardContext(context.Background(), request)
+}
+
+//CreateCardContext removes searches which must return the new card from the cache
+func (c *CachingClient) CreateCardContext(ctx context.Context, request *SignableRequest) (*Card, error) {
+	card, err := c.Client.CreateCardContext(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.generation++
+	c.remove(cacheKey{id: card.ID})
+	for _, identityType := range []string{card.IdentityType, ""} {
+		c.remove(cacheKey{scope: cacheScope(card.Scope), identityType: identityType, identity: card.Identity})
+	}
+	return card, nil
+}
+
+func (c *CachingClient) RevokeCard(request *SignableRequest) error {
+	return c.RevokeCardContext(context.Background(), request)
+}
+
+func (c *CachingClient) RevokeCardContext(ctx context.Context, request *SignableRequest) error {
+	if err := c.Client.RevokeCardContext(ctx, request); err != nil {
+		return err
+	}
+	req := &RevokeCardRequest{}
+	if err := json.Unmarshal(request.Snapshot, req); err == nil {
+		c.Invalidate(req.ID)
+	}
+	return nil
+}
+
+func (c *CachingClient) AddRelation(request *SignableRequest) (*Card, error) {
+	return c.AddRelationContext(context.Background(), request)
+}
+
+func (c *CachingClient) AddRelationContext(ctx context.Context, request *SignableRequest) (*Card, error) {
+	card, err := c.Client.AddRelationContext(ctx, request)
+	if err == nil {
+		c.Invalidate(card.ID)
+	}
+	return card, err
+}
+
+func (c *CachingClient) DeleteRelation(request *SignableRequest) (*Card, error) {
+	return c.DeleteRelationContext(context.Background(), request)
+}
+
+func (c *CachingClient) DeleteRelationContext(ctx context.Context, request *SignableRequest) (*Card, error) {
+	card, err := c.Client.DeleteRelationContext(ctx, request)
+	if err == nil {
+		c.Invalidate(card.ID)
+	}
+	return card, err
+}
+
+//Invalidate removes the card and all searches which returned it from the cache
+func (c *CachingClient) Invalidate(cardID string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.generation++
+	c.remove(cacheKey{id: cardID})
+	//revocations are rare, so searches are not indexed by card id
+	for key, e := range c.entries {
+		if key.id != "" {
+			continue
+		}
+		for _, card := range e.Value.(*cacheEntry).cards {
+			if card.ID == cardID {
+				c.remove(key)
+				break
+			}
+		}
+	}
+}
+
+//Purge removes everything from the cache
+func (c *CachingClient) Purge() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.generation++
+	c.lru.Init()
+	c.entries = make(map[cacheKey]*list.Element)
+}
+
+func searchKey(criteria *Criteria, identity string) cacheKey {
+	return cacheKey{scope: cacheScope(criteria.Scope), identityType: criteria.IdentityType, identity: identity}
+}
+
+//cacheScope treats empty scope as application one, the same way the service does for searches and new cards
+func cacheScope(scope Enum) Enum {
+	if scope == "" {
+		return CardScope.Application
+	}
+	return scope
+}
+
+func (c *CachingClient) get(key cacheKey) ([]*Card, bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	e, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	entry := e.Value.(*cacheEntry)
+	if !c.now().Before(entry.expires) {
+		c.remove(key)
+		return nil, false
+	}
+	c.lru.MoveToFront(e)
+	return entry.cards, true
+}
+
+func (c *CachingClient) currentGeneration() uint64 {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.generation
+}
+
+//put caches the cards fetched at the generation, empty cards mean there's nothing to find
+func (c *CachingClient) put(key cacheKey, cards []*Card, gen uint64) {
+	ttl := c.settings.TTL
+	if len(cards) == 0 {
+		if c.settings.NotFoundTTL < 0 {
+			return
+		}
+		ttl = c.settings.NotFoundTTL
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if gen != c.generation {
+		return
+	}
+	entry := &cacheEntry{key: key, cards: cards, expires: c.now().Add(ttl)}
+	if e, ok := c.entries[key]; ok {
+		e.Value = entry
+		c.lru.MoveToFront(e)
+		return
+	}
+	c.entries[key] = c.lru.PushFront(entry)
+	for c.lru.Len() > c.settings.Size {
+		c.remove(c.lru.Back().Value.(*cacheEntry).key)
+	}
+}
+
+func (c *CachingClient) remove(key cacheKey) {
+	if e, ok := c.entries[key]; ok {
+		c.lru.Remove(e)
+		delete(c.entries, key)
+	}
+}
@@ -0,0 +1,236 @@
+package virgil
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/virgil.v4/errors"
+	"gopkg.in/virgil.v4/transport"
+	"gopkg.in/virgil.v4/transport/endpoints"
+)
+
+//fakeCardService keeps cards in memory and counts calls of every endpoint
+type fakeCardService struct {
+	cards map[string]*CardResponse
+	calls map[endpoints.Endpoint]int
+}
+
+func (s *fakeCardService) Call(endpoint endpoints.Endpoint, payload interface{}, returnObj interface{}, params ...interface{}) error {
+	s.calls[endpoint]++
+	var res interface{}
+	switch endpoint {
+	case endpoints.GetCard:
+		card, ok := s.cards[params[0].(string)]
+		if !ok {
+			return errors.Wrap(transport.ErrNotFound, "")
+		}
+		res = card
+	case endpoints.SearchCards:
+		var cards []*CardResponse
+		for _, identity := range payload.(*Criteria).Identities {
+			for _, card := range s.cards {
+				model := &CardModel{}
+				json.Unmarshal(card.Snapshot, model)
+				if model.Identity == identity {
+					cards = append(cards, card)
+				}
+			}
+		}
+		res = cards
+	case endpoints.CreateCard:
+		card := requestToResponse(payload.(*SignableRequest))
+		s.cards[card.ID] = card
+		res = card
+	case endpoints.RevokeCard:
+		delete(s.cards, params[0].(string))
+		return nil
+	default:
+		return errors.New("unsupported endpoint")
+	}
+	d, _ := json.Marshal(res)
+	return json.Unmarshal(d, returnObj)
+}
+
+func (s *fakeCardService) SetToken(token string) {}
+
+func (s *fakeCardService) addCard(t *testing.T, identity string) *CardResponse {
+	kp, err := Crypto().GenerateKeypair()
+	assert.NoError(t, err)
+	req, err := NewCreateCardRequest(identity, "username", kp.PublicKey(), CardParams{})
+	assert.NoError(t, err)
+	card := requestToResponse(req)
+	s.cards[card.ID] = card
+	return card
+}
+
+func makeCachingClient(t *testing.T, settings CardCacheSettings) (*CachingClient, *fakeCardService) {
+	service := &fakeCardService{cards: make(map[string]*CardResponse), calls: make(map[endpoints.Endpoint]int)}
+	client, err := NewClient("token", ClientTransport(service), ClientCardsValidator(nil))
+	assert.NoError(t, err)
+	return NewCachingClient(client, settings), service
+}
+
+func TestCachingClient_GetCard(t *testing.T) {
+	c, service := makeCachingClient(t, CardCacheSettings{TTL: time.Minute, NotFoundTTL: time.Second})
+	now := time.Now()
+	c.now = func() time.Time { return now }
+
+	alice := service.addCard(t, "alice")
+	for i := 0; i < 3; i++ {
+		card, err := c.GetCard(alice.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, alice.ID, card.ID)
+	}
+	assert.Equal(t, 1, service.calls[endpoints.GetCard])
+
+	//negative caching
+	for i := 0; i < 3; i++ {
+		_, err := c.GetCard("missing")
+		assert.Equal(t, ErrNotFound, errors.Cause(err))
+	}
+	assert.Equal(t, 2, service.calls[endpoints.GetCard])
+
+	now = now.Add(2 * time.Second)
+	_, err := c.GetCard("missing")
+	assert.Equal(t, ErrNotFound, errors.Cause(err))
+	_, err = c.GetCard(alice.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, service.calls[endpoints.GetCard])
+
+	now = now.Add(time.Minute)
+	_, err = c.GetCard(alice.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, 4, service.calls[endpoints.GetCard])
+}
+
+func TestCachingClient_SearchCards(t *testing.T) {
+	c, service := makeCachingClient(t, CardCacheSettings{})
+
+	alice := service.addCard(t, "alice")
+	bob := service.addCard(t, "bob")
+
+	cards, err := c.SearchCards(SearchCriteriaByIdentities("alice"))
+	assert.NoError(t, err)
+	assert.Len(t, cards, 1)
+	assert.Equal(t, alice.ID, cards[0].ID)
+
+	//only bob is searched for
+	cards, err = c.SearchCards(SearchCriteriaByIdentities("bob", "alice", "bob"))
+	assert.NoError(t, err)
+	assert.Len(t, cards, 2)
+	assert.Equal(t, bob.ID, cards[0].ID)
+	assert.Equal(t, alice.ID, cards[1].ID)
+	assert.Equal(t, 2, service.calls[endpoints.SearchCards])
+
+	//empty results are cached as well
+	cards, err = c.SearchCards(SearchCriteriaByIdentities("carol"))
+	assert.NoError(t, err)
+	assert.Empty(t, cards)
+	_, err = c.SearchCards(&Criteria{Identities: []string{"carol", "alice"}})
+	assert.NoError(t, err)
+	assert.Equal(t, 3, service.calls[endpoints.SearchCards])
+
+	//scope and identity type are parts of the key
+	_, err = c.SearchCards(&Criteria{Scope: CardScope.Global, Identities: []string{"alice"}})
+	assert.NoError(t, err)
+	_, err = c.SearchCards(&Criteria{IdentityType: "username", Identities: []string{"alice"}})
+	assert.NoError(t, err)
+	assert.Equal(t, 5, service.calls[endpoints.SearchCards])
+
+	//created card is found at once
+	kp, err := Crypto().GenerateKeypair()
+	assert.NoError(t, err)
+	req, err := NewCreateCardRequest("carol", "username", kp.PublicKey(), CardParams{})
+	assert.NoError(t, err)
+	assert.NoError(t, (&RequestSigner{}).SelfSign(req, kp.PrivateKey()))
+	carol, err := c.CreateCard(req)
+	assert.NoError(t, err)
+
+	cards, err = c.SearchCards(SearchCriteriaByIdentities("carol"))
+	assert.NoError(t, err)
+	assert.Len(t, cards, 1)
+	assert.Equal(t, carol.ID, cards[0].ID)
+}
+
+func TestCachingClient_CreateCardAfterNegativeSearch(t *testing.T) {
+	c, _ := makeCachingClient(t, CardCacheSettings{})
+
+	for _, criteria := range []*Criteria{
+		SearchCriteriaByIdentities("carol"),
+		{Scope: CardScope.Application, Identities: []string{"carol"}},
+		{Scope: CardScope.Application, IdentityType: "username", Identities: []string{"carol"}},
+	} {
+		cards, err := c.SearchCards(criteria)
+		assert.NoError(t, err)
+		assert.Empty(t, cards)
+	}
+
+	//card snapshot without scope belongs to the application scope
+	kp, err := Crypto().GenerateKeypair()
+	assert.NoError(t, err)
+	key, err := kp.PublicKey().Encode()
+	assert.NoError(t, err)
+	snapshot, err := json.Marshal(&CardModel{Identity: "carol", IdentityType: "username", PublicKey: key})
+	assert.NoError(t, err)
+	req := &SignableRequest{Snapshot: snapshot, Meta: RequestMeta{Signatures: map[string][]byte{}}}
+	assert.NoError(t, (&RequestSigner{}).SelfSign(req, kp.PrivateKey()))
+	carol, err := c.CreateCard(req)
+	assert.NoError(t, err)
+	assert.Empty(t, carol.Scope)
+
+	for _, criteria := range []*Criteria{
+		SearchCriteriaByIdentities("carol"),
+		{Scope: CardScope.Application, IdentityType: "username", Identities: []string{"carol"}},
+	} {
+		cards, err := c.SearchCards(criteria)
+		assert.NoError(t, err)
+		assert.Len(t, cards, 1)
+	}
+}
+
+func TestCachingClient_RevokeCard_Invalidates(t *testing.T) {
+	c, service := makeCachingClient(t, CardCacheSettings{})
+	alice := service.addCard(t, "alice")
+
+	_, err := c.GetCard(alice.ID)
+	assert.NoError(t, err)
+	cards, err := c.SearchCards(SearchCriteriaByIdentities("alice"))
+	assert.NoError(t, err)
+	assert.Len(t, cards, 1)
+
+	req, err := NewRevokeCardRequest(alice.ID, RevocationReason.Compromised)
+	assert.NoError(t, err)
+	assert.NoError(t, c.RevokeCard(req))
+
+	_, err = c.GetCard(alice.ID)
+	assert.Equal(t, ErrNotFound, errors.Cause(err))
+	cards, err = c.SearchCards(SearchCriteriaByIdentities("alice"))
+	assert.NoError(t, err)
+	assert.Empty(t, cards)
+	assert.Equal(t, 2, service.calls[endpoints.GetCard])
+	assert.Equal(t, 2, service.calls[endpoints.SearchCards])
+}
+
+func TestCachingClient_LRU(t *testing.T) {
+	c, service := makeCachingClient(t, CardCacheSettings{Size: 2})
+	a := service.addCard(t, "a")
+	b := service.addCard(t, "b")
+	d := service.addCard(t, "d")
+
+	for _, id := range []string{a.ID, b.ID, a.ID, d.ID, a.ID} {
+		_, err := c.GetCard(id)
+		assert.NoError(t, err)
+	}
+	//b was the least recently used one
+	assert.Equal(t, 3, service.calls[endpoints.GetCard])
+	_, err := c.GetCard(b.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, 4, service.calls[endpoints.GetCard])
+
+	c.Purge()
+	_, err = c.GetCard(a.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, 5, service.calls[endpoints.GetCard])
+}
@@ -37,6 +37,7 @@ POSSIBILITY OF SUCH DAMAGE.
 package virgil
 
 import (
+	"context"
 	"encoding/json"
 
 	"gopkg.in/virgil.v4/errors"
@@ -97,8 +98,13 @@ type Client struct {
 
 // GetCard return a card from Virgil Read Only Card service
 func (c *Client) GetCard(id string) (*Card, error) {
+	return c.GetCardContext(context.Background(), id)
+}
+
+// GetCardContext is GetCard which stops when ctx is done
+func (c *Client) GetCardContext(ctx context.Context, id string) (*Card, error) {
 	var res *CardResponse
-	err := c.transportClient.Call(endpoints.GetCard, nil, &res, id)
+	err := transport.CallContext(ctx, c.transportClient, endpoints.GetCard, nil, &res, id)
 	if err != nil {
 		return nil, err
 	}
@@ -107,11 +113,16 @@ func (c *Client) GetCard(id string) (*Card, error) {
 
 // CreateCard posts card create request to server where it checks signatures and adds it
 func (c *Client) CreateCard(request *SignableRequest) (*Card, error) {
+	return c.CreateCardContext(context.Background(), request)
+}
+
+// CreateCardContext is CreateCard which stops when ctx is done
+func (c *Client) CreateCardContext(ctx context.Context, request *SignableRequest) (*Card, error) {
 	if request == nil || len(request.Snapshot) == 0 || len(request.Meta.Signatures) == 0 {
 		return nil, errors.New("request is empty or does not contain any signatures")
 	}
 	var res *CardResponse
-	err := c.transportClient.Call(endpoints.CreateCard, request, &res)
+	err := transport.CallContext(ctx, c.transportClient, endpoints.CreateCard, request, &res)
 
 	if err != nil {
 		return nil, err
@@ -121,6 +132,11 @@ func (c *Client) CreateCard(request *SignableRequest) (*Card, error) {
 
 // RevokeCard deletes card from server
 func (c *Client) RevokeCard(request *SignableRequest) error {
+	return c.RevokeCardContext(context.Background(), request)
+}
+
+// RevokeCardContext is RevokeCard which stops when ctx is done
+func (c *Client) RevokeCardContext(ctx context.Context, request *SignableRequest) error {
 	if request == nil {
 		return errors.New("request is nil")
 	}
@@ -130,15 +146,20 @@ func (c *Client) RevokeCard(request *SignableRequest) error {
 		return errors.Wrap(err, "")
 	}
 
-	return c.transportClient.Call(endpoints.RevokeCard, request, nil, req.ID)
+	return transport.CallContext(ctx, c.transportClient, endpoints.RevokeCard, request, nil, req.ID)
 }
 
 func (c *Client) SearchCards(criteria *Criteria) ([]*Card, error) {
+	return c.SearchCardsContext(context.Background(), criteria)
+}
+
+// SearchCardsContext is SearchCards which stops when ctx is done
+func (c *Client) SearchCardsContext(ctx context.Context, criteria *Criteria) ([]*Card, error) {
 	if criteria == nil || len(criteria.Identities) == 0 {
 		return nil, errors.New("search criteria cannot be empty")
 	}
 	var res []*CardResponse
-	err := c.transportClient.Call(endpoints.SearchCards, criteria, &res)
+	err := transport.CallContext(ctx, c.transportClient, endpoints.SearchCards, criteria, &res)
 	if err != nil {
 		return nil, err
 	}
@@ -155,11 +176,16 @@ func (c *Client) SearchCards(criteria *Criteria) ([]*Card, error) {
 }
 
 func (c *Client) VerifyIdentity(request *VerifyRequest) (*VerifyResponse, error) {
+	return c.VerifyIdentityContext(context.Background(), request)
+}
+
+// VerifyIdentityContext is VerifyIdentity which stops when ctx is done
+func (c *Client) VerifyIdentityContext(ctx context.Context, request *VerifyRequest) (*VerifyResponse, error) {
 	if request == nil {
 		return nil, errors.New("request is nil")
 	}
 	var res *VerifyResponse
-	err := c.transportClient.Call(endpoints.VerifyIdentity, request, &res)
+	err := transport.CallContext(ctx, c.transportClient, endpoints.VerifyIdentity, request, &res)
 
 	if err != nil {
 		return nil, err
@@ -169,12 +195,17 @@ func (c *Client) VerifyIdentity(request *VerifyRequest) (*VerifyResponse, error)
 }
 
 func (c *Client) ConfirmIdentity(request *ConfirmRequest) (*ConfirmResponse, error) {
+	return c.ConfirmIdentityContext(context.Background(), request)
+}
+
+// ConfirmIdentityContext is ConfirmIdentity which stops when ctx is done
+func (c *Client) ConfirmIdentityContext(ctx context.Context, request *ConfirmRequest) (*ConfirmResponse, error) {
 	if request == nil {
 		return nil, errors.New("request is nil")
 	}
 	var res *ConfirmResponse
 
-	err := c.transportClient.Call(endpoints.ConfirmIdentity, request, &res)
+	err := transport.CallContext(ctx, c.transportClient, endpoints.ConfirmIdentity, request, &res)
 
 	if err != nil {
 		return nil, err
@@ -184,14 +215,24 @@ func (c *Client) ConfirmIdentity(request *ConfirmRequest) (*ConfirmResponse, err
 }
 
 func (c *Client) ValidateIdentity(request *ValidateRequest) error {
+	return c.ValidateIdentityContext(context.Background(), request)
+}
+
+// ValidateIdentityContext is ValidateIdentity which stops when ctx is done
+func (c *Client) ValidateIdentityContext(ctx context.Context, request *ValidateRequest) error {
 	if request == nil {
 		return errors.New("request is nil")
 	}
-	return c.transportClient.Call(endpoints.ValidateIdentity, request, nil)
+	return transport.CallContext(ctx, c.transportClient, endpoints.ValidateIdentity, request, nil)
 }
 
 // AddRelation adds signature of the card signer trusts
 func (c *Client) AddRelation(request *SignableRequest) (*Card, error) {
+	return c.AddRelationContext(context.Background(), request)
+}
+
+// AddRelationContext is AddRelation which stops when ctx is done
+func (c *Client) AddRelationContext(ctx context.Context, request *SignableRequest) (*Card, error) {
 	if request == nil || len(request.Snapshot) == 0 || len(request.Meta.Signatures) != 1 {
 		return nil, errors.New("request must not be empty and must contain exactly 1 relation signature")
 	}
@@ -202,7 +243,7 @@ func (c *Client) AddRelation(request *SignableRequest) (*Card, error) {
 	}
 
 	var res *CardResponse
-	err := c.transportClient.Call(endpoints.AddRelation, request, &res, id)
+	err := transport.CallContext(ctx, c.transportClient, endpoints.AddRelation, request, &res, id)
 
 	if err != nil {
 		return nil, err
@@ -212,6 +253,11 @@ func (c *Client) AddRelation(request *SignableRequest) (*Card, error) {
 
 // AddRelation adds signature of the card signer trusts
 func (c *Client) DeleteRelation(request *SignableRequest) (*Card, error) {
+	return c.DeleteRelationContext(context.Background(), request)
+}
+
+// DeleteRelationContext is DeleteRelation which stops when ctx is done
+func (c *Client) DeleteRelationContext(ctx context.Context, request *SignableRequest) (*Card, error) {
 	if request == nil || len(request.Snapshot) == 0 || len(request.Meta.Signatures) != 1 {
 		return nil, errors.New("request must not be empty and must contain exactly 1 signature")
 	}
@@ -222,7 +268,7 @@ func (c *Client) DeleteRelation(request *SignableRequest) (*Card, error) {
 	}
 
 	var res *CardResponse
-	err := c.transportClient.Call(endpoints.DeleteRelation, request, &res, id)
+	err := transport.CallContext(ctx, c.transportClient, endpoints.DeleteRelation, request, &res, id)
 
 	if err != nil {
 		return nil, err
@@ -246,3 +292,159 @@ func (c *Client) convertToCardAndValidate(response *CardResponse) (*Card, error)
 	}
 	return card, nil
 }
+
+// UploadPrekeys publishes a long-term prekey card and, optionally, one-time prekey cards for the identity card
+func (c *Client) UploadPrekeys(identityCardID string, request *PrekeysRequest) (longTerm *Card, oneTime []*Card, err error) {
+	return c.UploadPrekeysContext(context.Background(), identityCardID, request)
+}
+
+// UploadPrekeysContext is UploadPrekeys which stops when ctx is done
+func (c *Client) UploadPrekeysContext(ctx context.Context, identityCardID string, request *PrekeysRequest) (longTerm *Card, oneTime []*Card, err error) {
+	if request == nil || request.LongTermCard == nil {
+		return nil, nil, errors.New("request must contain long-term prekey card")
+	}
+	var res *PrekeysResponse
+	err = transport.CallContext(ctx, c.transportClient, endpoints.UploadPrekeys, request, &res, identityCardID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if res == nil || res.LongTermCard == nil {
+		return nil, nil, errors.New("response does not contain long-term prekey card")
+	}
+
+	longTerm, err = res.LongTermCard.ToCard()
+	if err != nil {
+		return nil, nil, err
+	}
+	oneTime, err = prekeyCards(res.OneTimeCards)
+	if err != nil {
+		return nil, nil, err
+	}
+	return longTerm, oneTime, nil
+}
+
+// UploadOneTimePrekeys adds one-time prekey cards to the identity card supply
+func (c *Client) UploadOneTimePrekeys(identityCardID string, requests []*SignableRequest) ([]*Card, error) {
+	return c.UploadOneTimePrekeysContext(context.Background(), identityCardID, requests)
+}
+
+// UploadOneTimePrekeysContext is UploadOneTimePrekeys which stops when ctx is done
+func (c *Client) UploadOneTimePrekeysContext(ctx context.Context, identityCardID string, requests []*SignableRequest) ([]*Card, error) {
+	if len(requests) == 0 {
+		return nil, errors.New("requests are empty")
+	}
+	var res []*CardResponse
+	err := transport.CallContext(ctx, c.transportClient, endpoints.UploadOneTimePrekeys, &PrekeysRequest{OneTimeCards: requests}, &res, identityCardID)
+	if err != nil {
+		return nil, err
+	}
+	return prekeyCards(res)
+}
+
+// ClaimPrekeys returns prekey bundles for the identity cards. Every returned one-time prekey is removed from the service
+func (c *Client) ClaimPrekeys(identityCardIDs ...string) ([]*PrekeyBundle, error) {
+	return c.ClaimPrekeysContext(context.Background(), identityCardIDs...)
+}
+
+// ClaimPrekeysContext is ClaimPrekeys which stops when ctx is done
+func (c *Client) ClaimPrekeysContext(ctx context.Context, identityCardIDs ...string) ([]*PrekeyBundle, error) {
+	if len(identityCardIDs) == 0 {
+		return nil, errors.New("identity card ids cannot be empty")
+	}
+	var res []*PrekeyBundleResponse
+	err := transport.CallContext(ctx, c.transportClient, endpoints.ClaimPrekeys, &ClaimPrekeysRequest{IdentityCardIDs: identityCardIDs}, &res)
+	if err != nil {
+		return nil, err
+	}
+
+	var bundles []*PrekeyBundle
+	for _, v := range res {
+		if v == nil || v.IdentityCard == nil || v.LongTermCard == nil {
+			return nil, errors.New("prekey bundle is incomplete")
+		}
+		bundle := &PrekeyBundle{}
+		if bundle.IdentityCard, err = c.convertToCardAndValidate(v.IdentityCard); err != nil {
+			return nil, err
+		}
+		if bundle.LongTermCard, err = verifiedPrekeyCard(v.LongTermCard, bundle.IdentityCard); err != nil {
+			return nil, err
+		}
+		if v.OneTimeCard != nil {
+			if bundle.OneTimeCard, err = verifiedPrekeyCard(v.OneTimeCard, bundle.IdentityCard); err != nil {
+				return nil, err
+			}
+		}
+		bundles = append(bundles, bundle)
+	}
+	return bundles, nil
+}
+
+// verifiedPrekeyCard checks that the prekey was signed with the key of the identity card
+func verifiedPrekeyCard(res *CardResponse, identityCard *Card) (*Card, error) {
+	card, err := res.ToCard()
+	if err != nil {
+		return nil, err
+	}
+	prekey, err := card.PrekeyCard()
+	if err != nil {
+		return nil, err
+	}
+	if err = prekey.Verify(identityCard.PublicKey); err != nil {
+		return nil, err
+	}
+	return card, nil
+}
+
+// CountOneTimePrekeys returns the number of active and exhausted one-time prekeys of the identity card
+func (c *Client) CountOneTimePrekeys(identityCardID string) (*PrekeyCount, error) {
+	return c.CountOneTimePrekeysContext(context.Background(), identityCardID)
+}
+
+// CountOneTimePrekeysContext is CountOneTimePrekeys which stops when ctx is done
+func (c *Client) CountOneTimePrekeysContext(ctx context.Context, identityCardID string) (*PrekeyCount, error) {
+	var res *PrekeyCount
+	err := transport.CallContext(ctx, c.transportClient, endpoints.CountOneTimePrekeys, nil, &res, identityCardID)
+	if err != nil {
+		return nil, err
+	}
+	if res == nil {
+		return nil, errors.New("empty response")
+	}
+	return res, nil
+}
+
+// ValidateOneTimePrekeys returns ids of one-time prekey cards which have already been claimed
+func (c *Client) ValidateOneTimePrekeys(identityCardID string, oneTimeCardIDs []string) ([]string, error) {
+	return c.ValidateOneTimePrekeysContext(context.Background(), identityCardID, oneTimeCardIDs)
+}
+
+// ValidateOneTimePrekeysContext is ValidateOneTimePrekeys which stops when ctx is done
+func (c *Client) ValidateOneTimePrekeysContext(ctx context.Context, identityCardID string, oneTimeCardIDs []string) ([]string, error) {
+	if len(oneTimeCardIDs) == 0 {
+		return nil, errors.New("one-time card ids cannot be empty")
+	}
+	var res *ValidateOneTimePrekeysResponse
+	err := transport.CallContext(ctx, c.transportClient, endpoints.ValidateOneTimePrekeys, &ValidateOneTimePrekeysRequest{OneTimeCardIDs: oneTimeCardIDs}, &res, identityCardID)
+	if err != nil {
+		return nil, err
+	}
+	if res == nil {
+		return nil, nil
+	}
+	return res.Exhausted, nil
+}
+
+func prekeyCards(responses []*CardResponse) ([]*Card, error) {
+	cards := make([]*Card, 0, len(responses))
+	for _, v := range responses {
+		if v == nil {
+			return nil, errors.New("prekey card is empty")
+		}
+		card, err := v.ToCard()
+		if err != nil {
+			return nil, err
+		}
+		cards = append(cards, card)
+	}
+	return cards, nil
+}
@@ -1,6 +1,7 @@
 package virgil
 
 import (
+	"context"
 	"encoding/json"
 	"testing"
 
@@ -357,3 +358,15 @@ func TestRevokeCard_CheckPassedParameter(t *testing.T) {
 		},
 	}, nil, "id")
 }
+
+func TestGetCardContext_DoneContext_TransportNotCalled(t *testing.T) {
+	tr := makeFakeTransport()
+	c, _ := NewClient("accessToken", ClientTransport(tr), ClientCardsValidator(nil))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := c.GetCardContext(ctx, "id")
+
+	assert.Equal(t, context.Canceled, err)
+	tr.AssertNotCalled(t, "Call", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
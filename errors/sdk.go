@@ -1,8 +1,11 @@
 package errors
 
+import "time"
+
 // HTTPError stores HTTP Status error.
 type HTTPError struct {
-	code int
+	code       int
+	retryAfter time.Duration
 }
 
 // GetCode gets HTTP status code.
@@ -10,6 +13,11 @@ func (httpError HTTPError) HTTPErrorCode() int {
 	return httpError.code
 }
 
+// RetryAfter returns the delay the service asked for with the Retry-After header, zero if there was none.
+func (httpError HTTPError) RetryAfter() time.Duration {
+	return httpError.retryAfter
+}
+
 // ServiceError stores Service errors.
 type ServiceError struct {
 	code int
@@ -74,3 +82,13 @@ func ToSdkError(err error) (SDKError, bool) {
 	e, ok := Cause(err).(SDKError)
 	return e, ok
 }
+
+// WithRetryAfter sets the delay from the Retry-After header to the HTTP error. Other errors are returned as is.
+func WithRetryAfter(err error, retryAfter time.Duration) error {
+	e, ok := err.(SDKError)
+	if !ok || !e.IsHTTPError() {
+		return err
+	}
+	e.HTTPError.retryAfter = retryAfter
+	return e
+}
@@ -0,0 +1,387 @@
+package virgil
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"gopkg.in/virgil.v4/errors"
+	"gopkg.in/virgil.v4/virgilcrypto"
+)
+
+//Prekeys are ephemeral cards signed by the identity card key. The long-term prekey is rotated from time to time,
+//each one-time prekey is given to a single initiator and then removed from the service
+
+type PrekeysRequest struct {
+	LongTermCard *SignableRequest   `json:"long_time_card,omitempty"`
+	OneTimeCards []*SignableRequest `json:"one_time_cards,omitempty"`
+}
+
+type PrekeysResponse struct {
+	LongTermCard *CardResponse   `json:"long_time_card"`
+	OneTimeCards []*CardResponse `json:"one_time_cards"`
+}
+
+type ClaimPrekeysRequest struct {
+	IdentityCardIDs []string `json:"identity_cards_ids"`
+}
+
+type PrekeyBundleResponse struct {
+	IdentityCard *CardResponse `json:"identity_card"`
+	LongTermCard *CardResponse `json:"long_time_card"`
+	OneTimeCard  *CardResponse `json:"one_time_card,omitempty"`
+}
+
+//PrekeyBundle is what an initiator needs to start a PFS session. OneTimeCard is nil when the supply is exhausted
+type PrekeyBundle struct {
+	IdentityCard *Card
+	LongTermCard *Card
+	OneTimeCard  *Card
+}
+
+type PrekeyCount struct {
+	Active    int `json:"active"`
+	Exhausted int `json:"exhausted"`
+}
+
+type ValidateOneTimePrekeysRequest struct {
+	OneTimeCardIDs []string `json:"one_time_cards_ids"`
+}
+
+type ValidateOneTimePrekeysResponse struct {
+	Exhausted []string `json:"exhausted_one_time_cards_ids"`
+}
+
+const (
+	DefaultLowPrekeysThreshold = 10
+	//DefaultPrekeyGracePeriod is how long private keys of rotated and claimed prekeys are kept
+	DefaultPrekeyGracePeriod = 7 * 24 * time.Hour
+
+	PrekeyTypeLongTerm = "long_term"
+	PrekeyTypeOneTime  = "one_time"
+
+	//PrekeySignatureField is the card data field with the base64 encoded signature of the prekey made with the identity key
+	PrekeySignatureField = "prekey_signature"
+
+	prekeyTypeMeta     = "prekey_type"
+	identityCardIDMeta = "identity_card_id"
+	prekeyIndexType    = "index"
+)
+
+//PrekeyManager generates and publishes prekeys of the identity card and keeps their private keys in Storage
+type PrekeyManager struct {
+	Client       *Client
+	Storage      KeyStorage
+	IdentityCard *Card
+	IdentityKey  virgilcrypto.PrivateKey
+	//KeyPassword protects stored private keys
+	KeyPassword string
+	//LowSupplyThreshold is the number of active one-time prekeys below which the supply is low. DefaultLowPrekeysThreshold is used if zero
+	LowSupplyThreshold int
+	//OnLowSupply is called by CheckSupply when the supply is low
+	OnLowSupply func(count *PrekeyCount)
+	//GracePeriod is how long Cleanup keeps private keys of rotated long-term prekeys and of claimed one-time prekeys,
+	//so that sessions started with them just before can still be established. DefaultPrekeyGracePeriod is used if zero
+	GracePeriod time.Duration
+
+	lock sync.Mutex
+	now  func() time.Time
+}
+
+//prekeyIndex lists private prekeys of the identity card kept in the storage, since KeyStorage can't enumerate them.
+//Retired and claimed prekeys are mapped to the time they were rotated or found claimed, active one-time prekeys to zero time
+type prekeyIndex struct {
+	LongTerm string               `json:"long_term,omitempty"`
+	Retired  map[string]time.Time `json:"retired,omitempty"`
+	OneTime  map[string]time.Time `json:"one_time,omitempty"`
+}
+
+//Publish generates a new long-term prekey along with oneTimeCount one-time prekeys and uploads them.
+//Calling it again rotates the long-term prekey, Cleanup removes the private key of the previous one after GracePeriod
+func (m *PrekeyManager) Publish(oneTimeCount int) (longTerm *Card, oneTime []*Card, err error) {
+	ltReq, ltID, err := m.newPrekey(PrekeyTypeLongTerm)
+	if err != nil {
+		return nil, nil, err
+	}
+	otReqs, otIDs, err := m.newOneTimePrekeys(oneTimeCount)
+	if err != nil {
+		m.deletePrivateKeys(append(otIDs, ltID))
+		return nil, nil, err
+	}
+
+	longTerm, oneTime, err = m.Client.UploadPrekeys(m.IdentityCard.ID, &PrekeysRequest{
+		LongTermCard: ltReq,
+		OneTimeCards: otReqs,
+	})
+	if err != nil {
+		m.deletePrivateKeys(append(otIDs, ltID))
+		return nil, nil, err
+	}
+
+	err = m.updateIndex(func(index *prekeyIndex) {
+		if index.LongTerm != "" && index.LongTerm != ltID {
+			index.Retired[index.LongTerm] = m.currentTime()
+		}
+		index.LongTerm = ltID
+		for _, id := range otIDs {
+			index.OneTime[id] = time.Time{}
+		}
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return longTerm, oneTime, nil
+}
+
+//AddOneTimePrekeys generates and uploads count one-time prekeys
+func (m *PrekeyManager) AddOneTimePrekeys(count int) ([]*Card, error) {
+	if count <= 0 {
+		return nil, errors.New("count must be positive")
+	}
+	reqs, ids, err := m.newOneTimePrekeys(count)
+	if err != nil {
+		m.deletePrivateKeys(ids)
+		return nil, err
+	}
+	cards, err := m.Client.UploadOneTimePrekeys(m.IdentityCard.ID, reqs)
+	if err != nil {
+		m.deletePrivateKeys(ids)
+		return nil, err
+	}
+
+	err = m.updateIndex(func(index *prekeyIndex) {
+		for _, id := range ids {
+			index.OneTime[id] = time.Time{}
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return cards, nil
+}
+
+//Cleanup removes private keys of long-term prekeys rotated more than GracePeriod ago and of one-time prekeys
+//which the service gave out more than GracePeriod ago. It asks the service which one-time prekeys have been claimed,
+//so it's called from time to time, for example along with CheckSupply
+func (m *PrekeyManager) Cleanup() error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	index, err := m.loadIndex()
+	if err != nil {
+		return err
+	}
+
+	var active []string
+	for id, claimed := range index.OneTime {
+		if claimed.IsZero() {
+			active = append(active, id)
+		}
+	}
+	if len(active) > 0 {
+		exhausted, err := m.Client.ValidateOneTimePrekeys(m.IdentityCard.ID, active)
+		if err != nil {
+			return err
+		}
+		for _, id := range exhausted {
+			if _, ok := index.OneTime[id]; ok {
+				index.OneTime[id] = m.currentTime()
+			}
+		}
+	}
+
+	grace := m.GracePeriod
+	if grace == 0 {
+		grace = DefaultPrekeyGracePeriod
+	}
+	expired := m.currentTime().Add(-grace)
+	for _, ids := range []map[string]time.Time{index.Retired, index.OneTime} {
+		for id, since := range ids {
+			if since.IsZero() || since.After(expired) {
+				continue
+			}
+			if err = m.Storage.Delete(id); err != nil && m.Storage.Exists(id) {
+				return err
+			}
+			delete(ids, id)
+		}
+	}
+	return m.storeIndex(index)
+}
+
+//CheckSupply returns the number of one-time prekeys left on the service and whether it is low
+func (m *PrekeyManager) CheckSupply() (count *PrekeyCount, low bool, err error) {
+	count, err = m.Client.CountOneTimePrekeys(m.IdentityCard.ID)
+	if err != nil {
+		return nil, false, err
+	}
+
+	threshold := m.LowSupplyThreshold
+	if threshold == 0 {
+		threshold = DefaultLowPrekeysThreshold
+	}
+	low = count.Active < threshold
+	if low && m.OnLowSupply != nil {
+		m.OnLowSupply(count)
+	}
+	return count, low, nil
+}
+
+//LoadPrivateKey returns the private key of the prekey card
+func (m *PrekeyManager) LoadPrivateKey(cardID string) (virgilcrypto.PrivateKey, error) {
+	item, err := m.Storage.Load(cardID)
+	if err != nil {
+		return nil, err
+	}
+	if item.Meta[identityCardIDMeta] != m.IdentityCard.ID {
+		return nil, errors.New("prekey does not belong to the identity card")
+	}
+	return Crypto().ImportPrivateKey(item.Data, m.KeyPassword)
+}
+
+//DeletePrivateKey removes the private key of the prekey card, for example after the one-time prekey has been used
+func (m *PrekeyManager) DeletePrivateKey(cardID string) error {
+	if err := m.Storage.Delete(cardID); err != nil {
+		return err
+	}
+	return m.updateIndex(func(index *prekeyIndex) {
+		delete(index.Retired, cardID)
+		delete(index.OneTime, cardID)
+	})
+}
+
+func (m *PrekeyManager) newOneTimePrekeys(count int) (reqs []*SignableRequest, ids []string, err error) {
+	for i := 0; i < count; i++ {
+		req, id, err := m.newPrekey(PrekeyTypeOneTime)
+		if err != nil {
+			return nil, ids, err
+		}
+		reqs = append(reqs, req)
+		ids = append(ids, id)
+	}
+	return reqs, ids, nil
+}
+
+//newPrekey generates a keypair, stores its private key and returns a card request signed by the identity key
+func (m *PrekeyManager) newPrekey(prekeyType string) (*SignableRequest, string, error) {
+	if m.IdentityCard == nil || m.IdentityKey == nil {
+		return nil, "", errors.New("identity card and key are required")
+	}
+
+	kp, err := Crypto().GenerateKeypair()
+	if err != nil {
+		return nil, "", err
+	}
+
+	prekey, err := virgilcrypto.SignPrekey(kp.PublicKey(), m.IdentityKey)
+	if err != nil {
+		return nil, "", err
+	}
+
+	req, err := NewCreateCardRequest(m.IdentityCard.Identity, m.IdentityCard.IdentityType, kp.PublicKey(), CardParams{
+		Scope:      m.IdentityCard.Scope,
+		DeviceInfo: m.IdentityCard.DeviceInfo,
+		Data: map[string]string{
+			PrekeySignatureField: base64.StdEncoding.EncodeToString(prekey.Signature),
+		},
+	})
+	if err != nil {
+		return nil, "", err
+	}
+
+	signer := &RequestSigner{}
+	if err = signer.AuthoritySign(req, m.IdentityCard.ID, m.IdentityKey); err != nil {
+		return nil, "", err
+	}
+
+	data, err := Crypto().ExportPrivateKey(kp.PrivateKey(), m.KeyPassword)
+	if err != nil {
+		return nil, "", err
+	}
+
+	id := hex.EncodeToString(Crypto().CalculateFingerprint(req.Snapshot))
+	err = m.Storage.Store(&StorageItem{
+		Name: id,
+		Data: data,
+		Meta: map[string]string{
+			prekeyTypeMeta:     prekeyType,
+			identityCardIDMeta: m.IdentityCard.ID,
+		},
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	return req, id, nil
+}
+
+func (m *PrekeyManager) deletePrivateKeys(ids []string) {
+	for _, id := range ids {
+		m.Storage.Delete(id)
+	}
+}
+
+func (m *PrekeyManager) indexName() string {
+	return "prekeys_" + m.IdentityCard.ID
+}
+
+func (m *PrekeyManager) currentTime() time.Time {
+	if m.now != nil {
+		return m.now()
+	}
+	return time.Now()
+}
+
+func (m *PrekeyManager) updateIndex(update func(index *prekeyIndex)) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	index, err := m.loadIndex()
+	if err != nil {
+		return err
+	}
+	update(index)
+	return m.storeIndex(index)
+}
+
+func (m *PrekeyManager) loadIndex() (*prekeyIndex, error) {
+	index := &prekeyIndex{}
+	if m.Storage.Exists(m.indexName()) {
+		item, err := m.Storage.Load(m.indexName())
+		if err != nil {
+			return nil, err
+		}
+		if err = json.Unmarshal(item.Data, index); err != nil {
+			return nil, errors.Wrap(err, "Cannot parse prekey index")
+		}
+	}
+	if index.Retired == nil {
+		index.Retired = make(map[string]time.Time)
+	}
+	if index.OneTime == nil {
+		index.OneTime = make(map[string]time.Time)
+	}
+	return index, nil
+}
+
+//storeIndex replaces the stored index, KeyStorage does not overwrite items
+func (m *PrekeyManager) storeIndex(index *prekeyIndex) error {
+	data, err := json.Marshal(index)
+	if err != nil {
+		return errors.Wrap(err, "Cannot marshal prekey index")
+	}
+	if m.Storage.Exists(m.indexName()) {
+		if err = m.Storage.Delete(m.indexName()); err != nil {
+			return err
+		}
+	}
+	return m.Storage.Store(&StorageItem{
+		Name: m.indexName(),
+		Data: data,
+		Meta: map[string]string{
+			prekeyTypeMeta:     prekeyIndexType,
+			identityCardIDMeta: m.IdentityCard.ID,
+		},
+	})
+}
@@ -0,0 +1,277 @@
+package virgil
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"gopkg.in/virgil.v4/errors"
+	"gopkg.in/virgil.v4/transport/endpoints"
+	"gopkg.in/virgil.v4/virgilcrypto"
+)
+
+//fakePrekeyService keeps prekeys of a single identity card in memory
+type fakePrekeyService struct {
+	identityCard *CardResponse
+	longTermCard *CardResponse
+	oneTimeCards []*CardResponse
+	exhausted    map[string]bool
+}
+
+func requestToResponse(req *SignableRequest) *CardResponse {
+	return &CardResponse{
+		ID:       hex.EncodeToString(Crypto().CalculateFingerprint(req.Snapshot)),
+		Snapshot: req.Snapshot,
+		Meta:     ResponseMeta{Signatures: req.Meta.Signatures},
+	}
+}
+
+func (s *fakePrekeyService) Call(endpoint endpoints.Endpoint, payload interface{}, returnObj interface{}, params ...interface{}) error {
+	var res interface{}
+	switch endpoint {
+	case endpoints.UploadPrekeys, endpoints.UploadOneTimePrekeys:
+		req := payload.(*PrekeysRequest)
+		var oneTime []*CardResponse
+		for _, r := range req.OneTimeCards {
+			oneTime = append(oneTime, requestToResponse(r))
+		}
+		s.oneTimeCards = append(s.oneTimeCards, oneTime...)
+		if endpoint == endpoints.UploadOneTimePrekeys {
+			res = oneTime
+			break
+		}
+		s.longTermCard = requestToResponse(req.LongTermCard)
+		res = &PrekeysResponse{LongTermCard: s.longTermCard, OneTimeCards: oneTime}
+	case endpoints.ClaimPrekeys:
+		bundle := &PrekeyBundleResponse{IdentityCard: s.identityCard, LongTermCard: s.longTermCard}
+		if len(s.oneTimeCards) > 0 {
+			bundle.OneTimeCard = s.oneTimeCards[0]
+			s.oneTimeCards = s.oneTimeCards[1:]
+			s.exhausted[bundle.OneTimeCard.ID] = true
+		}
+		res = []*PrekeyBundleResponse{bundle}
+	case endpoints.CountOneTimePrekeys:
+		res = &PrekeyCount{Active: len(s.oneTimeCards), Exhausted: len(s.exhausted)}
+	case endpoints.ValidateOneTimePrekeys:
+		resp := &ValidateOneTimePrekeysResponse{}
+		for _, id := range payload.(*ValidateOneTimePrekeysRequest).OneTimeCardIDs {
+			if s.exhausted[id] {
+				resp.Exhausted = append(resp.Exhausted, id)
+			}
+		}
+		res = resp
+	default:
+		return errors.New("unsupported endpoint")
+	}
+
+	d, _ := json.Marshal(res)
+	return json.Unmarshal(d, returnObj)
+}
+
+func (s *fakePrekeyService) SetToken(token string) {}
+
+func makePrekeyManager(t *testing.T) (*PrekeyManager, *fakePrekeyService) {
+	kp, err := Crypto().GenerateKeypair()
+	assert.NoError(t, err)
+	req, err := NewCreateCardRequest("alice", "username", kp.PublicKey(), CardParams{})
+	assert.NoError(t, err)
+	signer := &RequestSigner{}
+	assert.NoError(t, signer.SelfSign(req, kp.PrivateKey()))
+
+	service := &fakePrekeyService{identityCard: requestToResponse(req), exhausted: make(map[string]bool)}
+	identityCard, err := service.identityCard.ToCard()
+	assert.NoError(t, err)
+
+	client, err := NewClient("token", ClientTransport(service), ClientCardsValidator(nil))
+	assert.NoError(t, err)
+
+	dir, err := ioutil.TempDir("", "prekeys")
+	assert.NoError(t, err)
+
+	return &PrekeyManager{
+		Client:       client,
+		Storage:      &FileStorage{RootDir: dir},
+		IdentityCard: identityCard,
+		IdentityKey:  kp.PrivateKey(),
+		KeyPassword:  "secret",
+	}, service
+}
+
+func TestPrekeyManager(t *testing.T) {
+	m, _ := makePrekeyManager(t)
+	defer os.RemoveAll(m.Storage.(*FileStorage).RootDir)
+
+	var reported *PrekeyCount
+	m.LowSupplyThreshold = 3
+	m.OnLowSupply = func(count *PrekeyCount) { reported = count }
+
+	longTerm, oneTime, err := m.Publish(3)
+	assert.NoError(t, err)
+	assert.Len(t, oneTime, 3)
+
+	//prekeys are signed by the identity key
+	fp := Crypto().CalculateFingerprint(longTerm.Snapshot)
+	ok, err := Crypto().Verify(fp, longTerm.Signatures[m.IdentityCard.ID], m.IdentityCard.PublicKey)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+
+	count, low, err := m.CheckSupply()
+	assert.NoError(t, err)
+	assert.False(t, low)
+	assert.Equal(t, 3, count.Active)
+	assert.Nil(t, reported)
+
+	bundles, err := m.Client.ClaimPrekeys(m.IdentityCard.ID)
+	assert.NoError(t, err)
+	assert.Len(t, bundles, 1)
+	assert.Equal(t, m.IdentityCard.ID, bundles[0].IdentityCard.ID)
+	assert.Equal(t, longTerm.ID, bundles[0].LongTermCard.ID)
+	assert.Equal(t, oneTime[0].ID, bundles[0].OneTimeCard.ID)
+
+	prekey, err := bundles[0].LongTermCard.PrekeyCard()
+	assert.NoError(t, err)
+	assert.NoError(t, prekey.Verify(m.IdentityCard.PublicKey))
+
+	//private halves are in the storage
+	for _, card := range []*Card{bundles[0].LongTermCard, bundles[0].OneTimeCard} {
+		key, err := m.LoadPrivateKey(card.ID)
+		assert.NoError(t, err)
+		pub, err := key.ExtractPublicKey()
+		assert.NoError(t, err)
+		assert.Equal(t, card.PublicKey.ReceiverID(), pub.ReceiverID())
+	}
+
+	//claiming consumes the one-time prekey
+	exhausted, err := m.Client.ValidateOneTimePrekeys(m.IdentityCard.ID, []string{oneTime[0].ID, oneTime[1].ID})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{oneTime[0].ID}, exhausted)
+	assert.NoError(t, m.DeletePrivateKey(oneTime[0].ID))
+	_, err = m.LoadPrivateKey(oneTime[0].ID)
+	assert.Error(t, err)
+
+	count, low, err = m.CheckSupply()
+	assert.NoError(t, err)
+	assert.True(t, low)
+	assert.Equal(t, count, reported)
+	assert.Equal(t, 2, reported.Active)
+
+	added, err := m.AddOneTimePrekeys(2)
+	assert.NoError(t, err)
+	assert.Len(t, added, 2)
+
+	count, low, err = m.CheckSupply()
+	assert.NoError(t, err)
+	assert.False(t, low)
+	assert.Equal(t, 4, count.Active)
+
+	//rotation
+	rotated, _, err := m.Publish(0)
+	assert.NoError(t, err)
+	assert.NotEqual(t, longTerm.ID, rotated.ID)
+	bundles, err = m.Client.ClaimPrekeys(m.IdentityCard.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, rotated.ID, bundles[0].LongTermCard.ID)
+
+	//keys of other identity cards are rejected
+	other, _ := makePrekeyManager(t)
+	defer os.RemoveAll(other.Storage.(*FileStorage).RootDir)
+	other.Storage = m.Storage
+	_, err = other.LoadPrivateKey(rotated.ID)
+	assert.Error(t, err)
+
+	_, err = m.AddOneTimePrekeys(0)
+	assert.Error(t, err)
+}
+
+func TestPrekeyManager_Cleanup(t *testing.T) {
+	m, _ := makePrekeyManager(t)
+	defer os.RemoveAll(m.Storage.(*FileStorage).RootDir)
+	now := time.Now()
+	m.now = func() time.Time { return now }
+	m.GracePeriod = time.Hour
+
+	longTerm, oneTime, err := m.Publish(2)
+	assert.NoError(t, err)
+	bundles, err := m.Client.ClaimPrekeys(m.IdentityCard.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, oneTime[0].ID, bundles[0].OneTimeCard.ID)
+
+	//claimed and rotated keys are kept for the grace period
+	assert.NoError(t, m.Cleanup())
+	rotated, _, err := m.Publish(0)
+	assert.NoError(t, err)
+	for _, id := range []string{longTerm.ID, rotated.ID, oneTime[0].ID, oneTime[1].ID} {
+		_, err = m.LoadPrivateKey(id)
+		assert.NoError(t, err)
+	}
+
+	now = now.Add(30 * time.Minute)
+	assert.NoError(t, m.Cleanup())
+	_, err = m.LoadPrivateKey(longTerm.ID)
+	assert.NoError(t, err)
+
+	now = now.Add(time.Hour)
+	assert.NoError(t, m.Cleanup())
+	for _, id := range []string{longTerm.ID, oneTime[0].ID} {
+		_, err = m.LoadPrivateKey(id)
+		assert.Error(t, err)
+	}
+	for _, id := range []string{rotated.ID, oneTime[1].ID} {
+		_, err = m.LoadPrivateKey(id)
+		assert.NoError(t, err)
+	}
+
+	//used one-time key is removed from the index along with the key
+	assert.NoError(t, m.DeletePrivateKey(oneTime[1].ID))
+	index, err := m.loadIndex()
+	assert.NoError(t, err)
+	assert.Equal(t, rotated.ID, index.LongTerm)
+	assert.Empty(t, index.Retired)
+	assert.Empty(t, index.OneTime)
+}
+
+func TestClaimPrekeys_SubstitutedPrekey_ReturnErr(t *testing.T) {
+	m, service := makePrekeyManager(t)
+	defer os.RemoveAll(m.Storage.(*FileStorage).RootDir)
+	other, _ := makePrekeyManager(t)
+	defer os.RemoveAll(other.Storage.(*FileStorage).RootDir)
+
+	_, _, err := m.Publish(1)
+	assert.NoError(t, err)
+	otherLongTerm, _, err := other.newPrekey(PrekeyTypeLongTerm)
+	assert.NoError(t, err)
+	otherOneTime, _, err := other.newPrekey(PrekeyTypeOneTime)
+	assert.NoError(t, err)
+
+	//one-time prekey signed by another identity
+	service.oneTimeCards = []*CardResponse{requestToResponse(otherOneTime)}
+	_, err = m.Client.ClaimPrekeys(m.IdentityCard.ID)
+	assert.IsType(t, &virgilcrypto.InvalidPrekeyError{}, errors.Cause(err))
+
+	//long-term prekey signed by another identity
+	service.longTermCard = requestToResponse(otherLongTerm)
+	_, err = m.Client.ClaimPrekeys(m.IdentityCard.ID)
+	assert.IsType(t, &virgilcrypto.InvalidPrekeyError{}, errors.Cause(err))
+}
+
+func TestPrekeyManager_UploadFailed_RemovesKeys(t *testing.T) {
+	m, _ := makePrekeyManager(t)
+	defer os.RemoveAll(m.Storage.(*FileStorage).RootDir)
+
+	tr := makeFakeTransport()
+	tr.On("Call", endpoints.UploadPrekeys, mock.Anything, mock.Anything, m.IdentityCard.ID).Return(nil, errors.New("failed"))
+	m.Client, _ = NewClient("token", ClientTransport(tr))
+
+	_, _, err := m.Publish(2)
+	assert.Error(t, err)
+
+	files, err := ioutil.ReadDir(m.Storage.(*FileStorage).RootDir)
+	assert.NoError(t, err)
+	assert.Empty(t, files)
+
+}
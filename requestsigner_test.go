@@ -1,6 +1,9 @@
 package virgil
 
 import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
 	"encoding/hex"
 	"io"
 	"testing"
@@ -26,6 +29,9 @@ func (c *FakeCrypto) SetKeyType(keyType virgilcrypto.KeyType) error {
 	return errors.New("ERROR")
 }
 
+func (c *FakeCrypto) SetContentCipher(content virgilcrypto.ContentCipher) {
+}
+
 func (c *FakeCrypto) GenerateKeypair() (virgilcrypto.Keypair, error) {
 	return nil, errors.New("ERROR")
 }
@@ -53,6 +59,15 @@ func (c *FakeCrypto) Decrypt(data []byte, key virgilcrypto.PrivateKey) ([]byte,
 func (c *FakeCrypto) DecryptStream(in io.Reader, out io.Writer, key virgilcrypto.PrivateKey) error {
 	return errors.New("ERROR")
 }
+func (c *FakeCrypto) EncryptStreamWithPassword(in io.Reader, out io.Writer, password string) error {
+	return errors.New("ERROR")
+}
+func (c *FakeCrypto) DecryptStreamWithPassword(in io.Reader, out io.Writer, password string) error {
+	return errors.New("ERROR")
+}
+func (c *FakeCrypto) OpenSeekable(ciphertext io.ReaderAt, size int64, key virgilcrypto.PrivateKey) (*virgilcrypto.SeekableReader, error) {
+	return nil, errors.New("ERROR")
+}
 func (c *FakeCrypto) DecryptThenVerify(data []byte, privateKeyForDecryption virgilcrypto.PrivateKey, verifierKeys ...virgilcrypto.PublicKey) ([]byte, error) {
 	return nil, errors.New("ERROR")
 }
@@ -65,6 +80,21 @@ func (c *FakeCrypto) SignStream(in io.Reader, signer virgilcrypto.PrivateKey) ([
 func (c *FakeCrypto) SignThenEncrypt(data []byte, signerKey virgilcrypto.PrivateKey, recipients ...virgilcrypto.PublicKey) ([]byte, error) {
 	return nil, errors.New("ERROR")
 }
+func (c *FakeCrypto) SignThenEncryptMultiple(data []byte, signerKeys []virgilcrypto.PrivateKey, recipients ...virgilcrypto.PublicKey) ([]byte, error) {
+	return nil, errors.New("ERROR")
+}
+func (c *FakeCrypto) Countersign(data []byte, privateKeyForDecryption virgilcrypto.PrivateKey, signerKey virgilcrypto.PrivateKey) ([]byte, error) {
+	return nil, errors.New("ERROR")
+}
+func (c *FakeCrypto) DecryptThenVerifyWithPolicy(data []byte, privateKeyForDecryption virgilcrypto.PrivateKey, policy virgilcrypto.SignaturePolicy, verifierKeys ...virgilcrypto.PublicKey) ([]byte, []virgilcrypto.PublicKey, error) {
+	return nil, nil, errors.New("ERROR")
+}
+func (c *FakeCrypto) SignThenEncryptStream(in io.Reader, out io.Writer, signerKey virgilcrypto.PrivateKey, recipients ...virgilcrypto.PublicKey) error {
+	return errors.New("ERROR")
+}
+func (c *FakeCrypto) DecryptThenVerifyStream(in io.Reader, out io.Writer, privateKeyForDecryption virgilcrypto.PrivateKey, verifierKeys ...virgilcrypto.PublicKey) error {
+	return errors.New("ERROR")
+}
 func (c *FakeCrypto) Verify(data []byte, signature []byte, key virgilcrypto.PublicKey) (bool, error) {
 	return false, errors.New("ERROR")
 }
@@ -145,3 +175,21 @@ func TestAuthoritySign_AddSelfSign_ReturnNil(t *testing.T) {
 	actual := r.Meta.Signatures["test"]
 	assert.Equal(t, expected, actual)
 }
+
+func TestAuthoritySign_SignerPrivateKey_ReturnNil(t *testing.T) {
+	r, _ := makeRequest()
+
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	key, err := virgilcrypto.NewSignerPrivateKey(ecKey, nil)
+	assert.Nil(t, err)
+
+	s := RequestSigner{}
+	err = s.AuthoritySign(r, "test", key)
+	assert.Nil(t, err)
+
+	pub, _ := Crypto().ExtractPublicKey(key)
+	fp := Crypto().CalculateFingerprint(r.Snapshot)
+	ok, err := Crypto().Verify(fp, r.Meta.Signatures["test"], pub)
+	assert.Nil(t, err)
+	assert.True(t, ok)
+}
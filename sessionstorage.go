@@ -0,0 +1,309 @@
+package virgil
+
+import (
+	"bytes"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path"
+	"sync"
+
+	"gopkg.in/virgil.v4/errors"
+	"gopkg.in/virgil.v4/virgilcrypto"
+)
+
+//SessionStorage keeps PFS sessions by their SessionID along with the state which changes as messages are exchanged
+type SessionStorage interface {
+	//Store adds a new session, ErrorSessionAlreadyExists is returned if the session is already stored
+	Store(session *virgilcrypto.PFSSession) error
+	//Update overwrites the stored session, ErrorSessionNotFound is returned if there is nothing to overwrite
+	Update(session *virgilcrypto.PFSSession) error
+	Load(sessionID []byte) (*virgilcrypto.PFSSession, error)
+	Exists(sessionID []byte) bool
+	//Delete removes the session along with its state
+	Delete(sessionID []byte) error
+
+	//StoreState keeps opaque state of the stored session, such as RatchetSession.Marshal output, replacing the previous one
+	StoreState(sessionID, state []byte) error
+	LoadState(sessionID []byte) ([]byte, error)
+}
+
+var (
+	ErrorSessionAlreadyExists = errors.New("Session already exists")
+	ErrorSessionNotFound      = errors.New("Session not found")
+)
+
+//FileSessionStorage keeps every session in a separate file encrypted with Key
+type FileSessionStorage struct {
+	RootDir string
+	Key     []byte
+}
+
+func (s *FileSessionStorage) Store(session *virgilcrypto.PFSSession) error {
+	if s.Exists(session.SessionID) {
+		return ErrorSessionAlreadyExists
+	}
+	return s.write(session)
+}
+
+func (s *FileSessionStorage) Update(session *virgilcrypto.PFSSession) error {
+	if !s.Exists(session.SessionID) {
+		return ErrorSessionNotFound
+	}
+	return s.write(session)
+}
+
+func (s *FileSessionStorage) write(session *virgilcrypto.PFSSession) error {
+	data, err := virgilcrypto.EncryptPFSSession(session, s.Key)
+	if err != nil {
+		return errors.Wrap(err, "FileSessionStorage cannot encrypt session")
+	}
+	return s.writeFile(sessionFileName(session.SessionID), data)
+}
+
+func (s *FileSessionStorage) Load(sessionID []byte) (*virgilcrypto.PFSSession, error) {
+	if !s.Exists(sessionID) {
+		return nil, ErrorSessionNotFound
+	}
+	d, err := s.readFile(sessionFileName(sessionID))
+	if err != nil {
+		return nil, err
+	}
+	return loadSession(d, sessionID, s.Key)
+}
+
+func (s *FileSessionStorage) Exists(sessionID []byte) bool {
+	dir, err := s.getRootDir()
+	if err != nil {
+		return false
+	}
+	_, err = os.Stat(path.Join(dir, sessionFileName(sessionID)))
+	return !os.IsNotExist(err)
+}
+
+func (s *FileSessionStorage) Delete(sessionID []byte) error {
+	dir, err := s.getRootDir()
+	if err != nil {
+		return err
+	}
+	err = os.Remove(path.Join(dir, sessionFileName(sessionID)))
+	if os.IsNotExist(err) {
+		return ErrorSessionNotFound
+	}
+	if err != nil {
+		return err
+	}
+	err = os.Remove(path.Join(dir, stateFileName(sessionID)))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+func (s *FileSessionStorage) StoreState(sessionID, state []byte) error {
+	if !s.Exists(sessionID) {
+		return ErrorSessionNotFound
+	}
+	data, err := virgilcrypto.EncryptSessionState(sessionID, state, s.Key)
+	if err != nil {
+		return errors.Wrap(err, "FileSessionStorage cannot encrypt session state")
+	}
+	return s.writeFile(stateFileName(sessionID), data)
+}
+
+func (s *FileSessionStorage) LoadState(sessionID []byte) ([]byte, error) {
+	dir, err := s.getRootDir()
+	if err != nil {
+		return nil, err
+	}
+	if _, err = os.Stat(path.Join(dir, stateFileName(sessionID))); os.IsNotExist(err) {
+		return nil, ErrorSessionNotFound
+	}
+	d, err := s.readFile(stateFileName(sessionID))
+	if err != nil {
+		return nil, err
+	}
+	return loadState(d, sessionID, s.Key)
+}
+
+//writeFile replaces the file through a temporary one, so that an interrupted write never leaves a broken session
+func (s *FileSessionStorage) writeFile(name string, data []byte) error {
+	dir, err := s.getRootDir()
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(dir, name+".tmp")
+	if err != nil {
+		return errors.Wrap(err, "Cannot write file")
+	}
+	if err = os.Chmod(tmp.Name(), 0600); err == nil {
+		_, err = tmp.Write(data)
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path.Join(dir, name))
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return errors.Wrap(err, "Cannot write file")
+	}
+	return nil
+}
+
+func (s *FileSessionStorage) readFile(name string) ([]byte, error) {
+	dir, err := s.getRootDir()
+	if err != nil {
+		return nil, err
+	}
+	d, err := ioutil.ReadFile(path.Join(dir, name))
+	if err != nil {
+		return nil, errors.Wrap(err, "Cannot read file")
+	}
+	return d, nil
+}
+
+func (s *FileSessionStorage) getRootDir() (string, error) {
+	fs := &FileStorage{RootDir: s.RootDir}
+	dir, err := fs.getRootDir()
+	if err != nil {
+		return "", err
+	}
+	s.RootDir = dir
+	return dir, nil
+}
+
+//MemorySessionStorage keeps sessions encrypted with Key in memory. It is safe for concurrent use
+type MemorySessionStorage struct {
+	Key []byte
+
+	lock     sync.RWMutex
+	sessions map[string][]byte
+	states   map[string][]byte
+}
+
+func (s *MemorySessionStorage) Store(session *virgilcrypto.PFSSession) error {
+	return s.write(session, false)
+}
+
+func (s *MemorySessionStorage) Update(session *virgilcrypto.PFSSession) error {
+	return s.write(session, true)
+}
+
+func (s *MemorySessionStorage) write(session *virgilcrypto.PFSSession, overwrite bool) error {
+	data, err := virgilcrypto.EncryptPFSSession(session, s.Key)
+	if err != nil {
+		return errors.Wrap(err, "MemorySessionStorage cannot encrypt session")
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	name := sessionFileName(session.SessionID)
+	_, ok := s.sessions[name]
+	if ok && !overwrite {
+		return ErrorSessionAlreadyExists
+	}
+	if !ok && overwrite {
+		return ErrorSessionNotFound
+	}
+	if s.sessions == nil {
+		s.sessions = make(map[string][]byte)
+	}
+	s.sessions[name] = data
+	return nil
+}
+
+func (s *MemorySessionStorage) Load(sessionID []byte) (*virgilcrypto.PFSSession, error) {
+	s.lock.RLock()
+	data, ok := s.sessions[sessionFileName(sessionID)]
+	s.lock.RUnlock()
+
+	if !ok {
+		return nil, ErrorSessionNotFound
+	}
+	return loadSession(data, sessionID, s.Key)
+}
+
+func (s *MemorySessionStorage) Exists(sessionID []byte) bool {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	_, ok := s.sessions[sessionFileName(sessionID)]
+	return ok
+}
+
+func (s *MemorySessionStorage) Delete(sessionID []byte) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	name := sessionFileName(sessionID)
+	if _, ok := s.sessions[name]; !ok {
+		return ErrorSessionNotFound
+	}
+	delete(s.sessions, name)
+	delete(s.states, name)
+	return nil
+}
+
+func (s *MemorySessionStorage) StoreState(sessionID, state []byte) error {
+	data, err := virgilcrypto.EncryptSessionState(sessionID, state, s.Key)
+	if err != nil {
+		return errors.Wrap(err, "MemorySessionStorage cannot encrypt session state")
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	name := sessionFileName(sessionID)
+	if _, ok := s.sessions[name]; !ok {
+		return ErrorSessionNotFound
+	}
+	if s.states == nil {
+		s.states = make(map[string][]byte)
+	}
+	s.states[name] = data
+	return nil
+}
+
+func (s *MemorySessionStorage) LoadState(sessionID []byte) ([]byte, error) {
+	s.lock.RLock()
+	data, ok := s.states[sessionFileName(sessionID)]
+	s.lock.RUnlock()
+
+	if !ok {
+		return nil, ErrorSessionNotFound
+	}
+	return loadState(data, sessionID, s.Key)
+}
+
+func sessionFileName(sessionID []byte) string {
+	return hex.EncodeToString(sessionID)
+}
+
+func stateFileName(sessionID []byte) string {
+	return sessionFileName(sessionID) + ".state"
+}
+
+func loadSession(data, sessionID, key []byte) (*virgilcrypto.PFSSession, error) {
+	session, err := virgilcrypto.DecryptPFSSession(data, key)
+	if err != nil {
+		return nil, errors.Wrap(err, "Cannot decrypt session")
+	}
+	if !bytes.Equal(session.SessionID, sessionID) {
+		return nil, errors.New("Stored session does not match SessionID")
+	}
+	return session, nil
+}
+
+func loadState(data, sessionID, key []byte) ([]byte, error) {
+	storedID, state, err := virgilcrypto.DecryptSessionState(data, key)
+	if err != nil {
+		return nil, errors.Wrap(err, "Cannot decrypt session state")
+	}
+	if !bytes.Equal(storedID, sessionID) {
+		return nil, errors.New("Stored state does not match SessionID")
+	}
+	return state, nil
+}
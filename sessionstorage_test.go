@@ -0,0 +1,140 @@
+package virgil
+
+import (
+	"crypto/rand"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/virgil.v4/virgilcrypto"
+)
+
+func newTestSession() *virgilcrypto.PFSSession {
+	s := &virgilcrypto.PFSSession{
+		SK:        make([]byte, 32),
+		AD:        make([]byte, 32),
+		SessionID: make([]byte, 32),
+	}
+	rand.Read(s.SK)
+	rand.Read(s.AD)
+	rand.Read(s.SessionID)
+	return s
+}
+
+func testSessionStorage(t *testing.T, storage SessionStorage) {
+	session := newTestSession()
+
+	assert.False(t, storage.Exists(session.SessionID))
+	_, err := storage.Load(session.SessionID)
+	assert.Equal(t, ErrorSessionNotFound, err)
+
+	assert.NoError(t, storage.Store(session))
+	assert.True(t, storage.Exists(session.SessionID))
+	assert.Equal(t, ErrorSessionAlreadyExists, storage.Store(session))
+
+	loaded, err := storage.Load(session.SessionID)
+	assert.NoError(t, err)
+	assert.Equal(t, session, loaded)
+
+	//overwrite
+	updated := newTestSession()
+	updated.SessionID = session.SessionID
+	assert.NoError(t, storage.Update(updated))
+	loaded, err = storage.Load(session.SessionID)
+	assert.NoError(t, err)
+	assert.Equal(t, updated, loaded)
+	assert.Equal(t, ErrorSessionNotFound, storage.Update(newTestSession()))
+
+	//state is replaced on every store
+	_, err = storage.LoadState(session.SessionID)
+	assert.Equal(t, ErrorSessionNotFound, err)
+	assert.Equal(t, ErrorSessionNotFound, storage.StoreState(newTestSession().SessionID, []byte("state")))
+	for _, state := range []string{"state 1", "state 2"} {
+		assert.NoError(t, storage.StoreState(session.SessionID, []byte(state)))
+		loadedState, err := storage.LoadState(session.SessionID)
+		assert.NoError(t, err)
+		assert.Equal(t, state, string(loadedState))
+	}
+
+	assert.NoError(t, storage.Delete(session.SessionID))
+	assert.False(t, storage.Exists(session.SessionID))
+	assert.Equal(t, ErrorSessionNotFound, storage.Delete(session.SessionID))
+	_, err = storage.LoadState(session.SessionID)
+	assert.Equal(t, ErrorSessionNotFound, err)
+
+	//empty session
+	assert.Error(t, storage.Store(&virgilcrypto.PFSSession{}))
+}
+
+func TestMemorySessionStorage(t *testing.T) {
+	key := make([]byte, virgilcrypto.PFSSessionKeySize)
+	rand.Read(key)
+	testSessionStorage(t, &MemorySessionStorage{Key: key})
+
+	_, err := (&MemorySessionStorage{Key: key[:16]}).Load(nil)
+	assert.Error(t, err)
+	assert.Error(t, (&MemorySessionStorage{Key: key[:16]}).Store(newTestSession()))
+}
+
+func TestFileSessionStorage(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sessions")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	key := make([]byte, virgilcrypto.PFSSessionKeySize)
+	rand.Read(key)
+	testSessionStorage(t, &FileSessionStorage{RootDir: dir, Key: key})
+
+	//sessions survive storage restart but can not be read with another key
+	session := newTestSession()
+	assert.NoError(t, (&FileSessionStorage{RootDir: dir, Key: key}).Store(session))
+
+	loaded, err := (&FileSessionStorage{RootDir: dir, Key: key}).Load(session.SessionID)
+	assert.NoError(t, err)
+	assert.Equal(t, session, loaded)
+
+	otherKey := make([]byte, virgilcrypto.PFSSessionKeySize)
+	rand.Read(otherKey)
+	_, err = (&FileSessionStorage{RootDir: dir, Key: otherKey}).Load(session.SessionID)
+	assert.Error(t, err)
+}
+
+func TestSessionStorage_RatchetState(t *testing.T) {
+	key := make([]byte, virgilcrypto.PFSSessionKeySize)
+	rand.Read(key)
+	storage := &MemorySessionStorage{Key: key}
+
+	c := Crypto()
+	ICa, _ := c.GenerateKeypair()
+	EKa, _ := c.GenerateKeypair()
+	ICb, _ := c.GenerateKeypair()
+	LTCb, _ := c.GenerateKeypair()
+	prekey, err := virgilcrypto.SignPrekey(LTCb.PublicKey(), ICb.PrivateKey())
+	assert.NoError(t, err)
+	session, err := c.(virgilcrypto.PFS).StartInitiatorSession(ICb.PublicKey(), prekey, nil, ICa.PrivateKey(), EKa.PrivateKey(), "alice", "bob")
+	assert.NoError(t, err)
+	assert.NoError(t, storage.Store(session))
+
+	ratchet, err := virgilcrypto.NewRatchetInitiatorSession(session, LTCb.PublicKey())
+	assert.NoError(t, err)
+	for i := 0; i < 2; i++ {
+		_, err = ratchet.Encrypt([]byte("message"))
+		assert.NoError(t, err)
+		state, err := ratchet.Marshal()
+		assert.NoError(t, err)
+		assert.NoError(t, storage.StoreState(session.SessionID, state))
+	}
+
+	state, err := storage.LoadState(session.SessionID)
+	assert.NoError(t, err)
+	restored, err := virgilcrypto.UnmarshalRatchetSession(state)
+	assert.NoError(t, err)
+	assert.Equal(t, session.SessionID, restored.SessionID())
+	expected, _ := ratchet.Encrypt([]byte("next"))
+	next, err := restored.Encrypt([]byte("next"))
+	assert.NoError(t, err)
+	assert.Equal(t, 2, next.Counter)
+	assert.Equal(t, expected.Counter, next.Counter)
+	assert.Equal(t, expected.PublicKey, next.PublicKey)
+}
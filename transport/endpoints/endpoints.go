@@ -12,4 +12,9 @@ const (
 	ValidateIdentity
 	AddRelation
 	DeleteRelation
+	UploadPrekeys
+	UploadOneTimePrekeys
+	ClaimPrekeys
+	CountOneTimePrekeys
+	ValidateOneTimePrekeys
 )
@@ -1,8 +1,30 @@
 package transport
 
-import "gopkg.in/virgil.v4/transport/endpoints"
+import (
+	"context"
+
+	"gopkg.in/virgil.v4/transport/endpoints"
+)
 
 type Client interface {
 	SetToken(token string)
 	Call(endpoint endpoints.Endpoint, payload interface{}, returnObj interface{}, params ...interface{}) error
 }
+
+// ContextClient is a Client which stops waiting for the response when the context is done
+type ContextClient interface {
+	Client
+	CallContext(ctx context.Context, endpoint endpoints.Endpoint, payload interface{}, returnObj interface{}, params ...interface{}) error
+}
+
+// CallContext calls the endpoint with ctx if the client supports it.
+// Other clients are called only if ctx is not done yet and can't be interrupted
+func CallContext(ctx context.Context, c Client, endpoint endpoints.Endpoint, payload interface{}, returnObj interface{}, params ...interface{}) error {
+	if cc, ok := c.(ContextClient); ok {
+		return cc.CallContext(ctx, endpoint, payload, returnObj, params...)
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return c.Call(endpoint, payload, returnObj, params...)
+}
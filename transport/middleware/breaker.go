@@ -0,0 +1,144 @@
+package middleware
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"gopkg.in/virgil.v4/errors"
+	"gopkg.in/virgil.v4/transport"
+	"gopkg.in/virgil.v4/transport/endpoints"
+)
+
+// ErrCircuitOpen is returned without calling the service while its circuit is open
+var ErrCircuitOpen = errors.New("service is unavailable, circuit breaker is open")
+
+// BreakerSettings configures CircuitBreaker. Zero fields take the default values
+type BreakerSettings struct {
+	// FailureThreshold is the number of consecutive failures which opens the circuit, 5 by default
+	FailureThreshold int
+	// OpenTimeout is the time the circuit stays open before a trial call is let through, 30s by default
+	OpenTimeout time.Duration
+	// Service groups endpoints which share a circuit, ServiceName by default
+	Service func(endpoint endpoints.Endpoint) string
+	// Temporary tells which errors count as failures of the service, IsTemporary by default
+	Temporary func(err error) bool
+}
+
+func (s BreakerSettings) withDefaults() BreakerSettings {
+	if s.FailureThreshold < 1 {
+		s.FailureThreshold = 5
+	}
+	if s.OpenTimeout <= 0 {
+		s.OpenTimeout = 30 * time.Second
+	}
+	if s.Service == nil {
+		s.Service = ServiceName
+	}
+	if s.Temporary == nil {
+		s.Temporary = IsTemporary
+	}
+	return s
+}
+
+// CircuitBreaker stops calling a service after FailureThreshold consecutive failures and returns ErrCircuitOpen instead.
+// After OpenTimeout a single trial call is made, its success closes the circuit. Every service has its own circuit
+func CircuitBreaker(settings BreakerSettings) Middleware {
+	settings = settings.withDefaults()
+	return func(next transport.Client) transport.Client {
+		b := &breaker{
+			settings: settings,
+			next:     next,
+			circuits: make(map[string]*circuit),
+			now:      time.Now,
+		}
+		return &client{next: next, call: b.call}
+	}
+}
+
+type circuitState int
+
+const (
+	circuitClosed circuitState = iota
+	circuitOpen
+	circuitHalfOpen
+)
+
+type circuit struct {
+	state    circuitState
+	failures int
+	openedAt time.Time
+}
+
+type breaker struct {
+	settings BreakerSettings
+	next     transport.Client
+	now      func() time.Time
+
+	lock     sync.Mutex
+	circuits map[string]*circuit
+}
+
+func (b *breaker) call(ctx context.Context, endpoint endpoints.Endpoint, payload interface{}, returnObj interface{}, params ...interface{}) error {
+	service := b.settings.Service(endpoint)
+	if !b.allow(service) {
+		return ErrCircuitOpen
+	}
+	err := transport.CallContext(ctx, b.next, endpoint, payload, returnObj, params...)
+	b.done(service, err)
+	return err
+}
+
+func (b *breaker) allow(service string) bool {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	c, ok := b.circuits[service]
+	if !ok {
+		c = &circuit{}
+		b.circuits[service] = c
+	}
+	switch c.state {
+	case circuitOpen:
+		if b.now().Sub(c.openedAt) < b.settings.OpenTimeout {
+			return false
+		}
+		c.state = circuitHalfOpen
+		return true
+	case circuitHalfOpen:
+		//the trial call is in progress
+		return false
+	}
+	return true
+}
+
+func (b *breaker) done(service string, err error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	c := b.circuits[service]
+	if ctxError(err) {
+		//cancelled calls tell nothing about the service, the next call makes the trial again
+		if c.state == circuitHalfOpen {
+			c.state = circuitOpen
+			c.openedAt = time.Time{}
+		}
+		return
+	}
+	if !b.settings.Temporary(err) {
+		c.state = circuitClosed
+		c.failures = 0
+		return
+	}
+
+	c.failures++
+	if c.state == circuitHalfOpen || c.failures >= b.settings.FailureThreshold {
+		c.state = circuitOpen
+		c.openedAt = b.now()
+	}
+}
+
+func ctxError(err error) bool {
+	cause := errors.Cause(err)
+	return cause == context.Canceled || cause == context.DeadlineExceeded
+}
@@ -0,0 +1,104 @@
+// Package middleware provides wrappers around transport.Client which retry failed calls and stop calling a failing service.
+// The wrappers are composed with Chain:
+//
+//	client := middleware.Chain(virgilhttp.NewTransportClient(...),
+//		middleware.Retry(middleware.RetryPolicy{}),
+//		middleware.CircuitBreaker(middleware.BreakerSettings{}))
+package middleware
+
+import (
+	"context"
+	stderrors "errors"
+	"io"
+	"net"
+	"net/http"
+
+	"github.com/valyala/fasthttp"
+	"gopkg.in/virgil.v4/errors"
+	"gopkg.in/virgil.v4/transport"
+	"gopkg.in/virgil.v4/transport/endpoints"
+	"gopkg.in/virgil.v4/transport/virgilhttp"
+)
+
+// Middleware wraps a transport client with additional behavior
+type Middleware func(next transport.Client) transport.Client
+
+// Chain wraps the client with the middlewares, the first one is the outermost
+func Chain(client transport.Client, middlewares ...Middleware) transport.Client {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		client = middlewares[i](client)
+	}
+	return client
+}
+
+// callFunc is the part of the middleware which differs, SetToken and Call are the same for all of them
+type callFunc func(ctx context.Context, endpoint endpoints.Endpoint, payload interface{}, returnObj interface{}, params ...interface{}) error
+
+type client struct {
+	next transport.Client
+	call callFunc
+}
+
+func (c *client) SetToken(token string) {
+	c.next.SetToken(token)
+}
+
+func (c *client) Call(endpoint endpoints.Endpoint, payload interface{}, returnObj interface{}, params ...interface{}) error {
+	return c.call(context.Background(), endpoint, payload, returnObj, params...)
+}
+
+func (c *client) CallContext(ctx context.Context, endpoint endpoints.Endpoint, payload interface{}, returnObj interface{}, params ...interface{}) error {
+	return c.call(ctx, endpoint, payload, returnObj, params...)
+}
+
+// IsTemporary reports whether the call may succeed if repeated: network errors, 5xx and 429 responses.
+// Other service errors and cancelled contexts are not temporary
+func IsTemporary(err error) bool {
+	if err == nil {
+		return false
+	}
+	if ctxError(err) {
+		return false
+	}
+	if e, ok := errors.ToSdkError(err); ok {
+		code := e.HTTPErrorCode()
+		return code >= http.StatusInternalServerError || code == http.StatusTooManyRequests
+	}
+	//fasthttp wraps dial errors
+	var netErr net.Error
+	if stderrors.As(err, &netErr) {
+		return true
+	}
+	for _, e := range []error{io.EOF, io.ErrUnexpectedEOF, fasthttp.ErrConnectionClosed, fasthttp.ErrNoFreeConns} {
+		if stderrors.Is(err, e) {
+			return true
+		}
+	}
+	return false
+}
+
+// IsIdempotent reports whether the endpoint only reads data, so it's safe to call it again
+func IsIdempotent(endpoint endpoints.Endpoint) bool {
+	switch endpoint {
+	case endpoints.GetCard, endpoints.SearchCards, endpoints.ValidateIdentity,
+		endpoints.CountOneTimePrekeys, endpoints.ValidateOneTimePrekeys:
+		return true
+	}
+	return false
+}
+
+var serviceNames = map[virgilhttp.ServiceType]string{
+	virgilhttp.Cardservice:     "cards",
+	virgilhttp.ROCardService:   "cards-ro",
+	virgilhttp.IdentityService: "identity",
+	virgilhttp.VRAService:      "vra",
+	virgilhttp.PFSService:      "pfs",
+}
+
+// ServiceName returns the name of the service which serves the endpoint in the HTTP transport
+func ServiceName(endpoint endpoints.Endpoint) string {
+	if ep, ok := virgilhttp.HTTPEndpoints[endpoint]; ok {
+		return serviceNames[ep.ServiceType]
+	}
+	return ""
+}
@@ -0,0 +1,212 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/virgil.v4/errors"
+	"gopkg.in/virgil.v4/transport"
+	"gopkg.in/virgil.v4/transport/endpoints"
+	"gopkg.in/virgil.v4/transport/virgilhttp"
+)
+
+//fakeServer answers with the queued responses, then with 200
+type fakeServer struct {
+	*httptest.Server
+	lock      sync.Mutex
+	responses []fakeResponse
+	requests  map[string]int
+}
+
+type fakeResponse struct {
+	status     int
+	retryAfter string
+}
+
+func newFakeServer(responses ...fakeResponse) *fakeServer {
+	s := &fakeServer{responses: responses, requests: make(map[string]int)}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.lock.Lock()
+		s.requests[r.URL.Path]++
+		res := fakeResponse{status: http.StatusOK}
+		if len(s.responses) > 0 {
+			res, s.responses = s.responses[0], s.responses[1:]
+		}
+		s.lock.Unlock()
+
+		if res.retryAfter != "" {
+			w.Header().Set("Retry-After", res.retryAfter)
+		}
+		w.WriteHeader(res.status)
+		if res.status == http.StatusOK {
+			w.Write([]byte(`{"id":"card"}`))
+		} else {
+			w.Write([]byte(`{"code":10000}`))
+		}
+	}))
+	return s
+}
+
+func (s *fakeServer) count(path string) int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.requests[path]
+}
+
+func (s *fakeServer) client(middlewares ...Middleware) transport.Client {
+	return Chain(virgilhttp.NewTransportClient(s.URL, s.URL, s.URL, s.URL), middlewares...)
+}
+
+func getCard(c transport.Client) error {
+	var res map[string]interface{}
+	return c.Call(endpoints.GetCard, nil, &res, "card")
+}
+
+func TestRetry_TemporaryErrors_Retried(t *testing.T) {
+	s := newFakeServer(fakeResponse{status: http.StatusServiceUnavailable}, fakeResponse{status: http.StatusTooManyRequests})
+	defer s.Close()
+	c := s.client(Retry(RetryPolicy{BaseDelay: time.Millisecond}))
+
+	assert.NoError(t, getCard(c))
+	assert.Equal(t, 3, s.count("/v4/card/card"))
+}
+
+func TestRetry_AttemptsExhausted_ReturnLastErr(t *testing.T) {
+	s := newFakeServer(
+		fakeResponse{status: http.StatusBadGateway},
+		fakeResponse{status: http.StatusBadGateway},
+		fakeResponse{status: http.StatusBadGateway})
+	defer s.Close()
+	c := s.client(Retry(RetryPolicy{MaxAttempts: 2, BaseDelay: time.Millisecond}))
+
+	err := getCard(c)
+	sdkErr, ok := errors.ToSdkError(err)
+	assert.True(t, ok)
+	assert.Equal(t, http.StatusBadGateway, sdkErr.HTTPErrorCode())
+	assert.Equal(t, 2, s.count("/v4/card/card"))
+}
+
+func TestRetry_NotTemporaryOrNotIdempotent_NotRetried(t *testing.T) {
+	s := newFakeServer(fakeResponse{status: http.StatusBadRequest}, fakeResponse{status: http.StatusServiceUnavailable})
+	defer s.Close()
+	c := s.client(Retry(RetryPolicy{BaseDelay: time.Millisecond}))
+
+	assert.Error(t, getCard(c))
+	assert.Equal(t, 1, s.count("/v4/card/card"))
+
+	var res map[string]interface{}
+	assert.Error(t, c.Call(endpoints.CreateCard, map[string]string{}, &res))
+	assert.Equal(t, 1, s.count("/v1/card"))
+}
+
+func TestRetry_RetryAfter_Honored(t *testing.T) {
+	s := newFakeServer(fakeResponse{status: http.StatusServiceUnavailable, retryAfter: "1"})
+	defer s.Close()
+	c := s.client(Retry(RetryPolicy{BaseDelay: time.Millisecond, MaxDelay: 2 * time.Second}))
+
+	start := time.Now()
+	assert.NoError(t, getCard(c))
+	assert.True(t, time.Since(start) >= time.Second)
+	assert.Equal(t, 2, s.count("/v4/card/card"))
+
+	//the service asks to wait longer than allowed
+	s.lock.Lock()
+	s.responses = []fakeResponse{{status: http.StatusServiceUnavailable, retryAfter: "10"}}
+	s.lock.Unlock()
+	assert.Error(t, getCard(c))
+	assert.Equal(t, 3, s.count("/v4/card/card"))
+}
+
+func TestRetry_ContextDone_StopsWaiting(t *testing.T) {
+	s := newFakeServer(fakeResponse{status: http.StatusServiceUnavailable, retryAfter: "1"})
+	defer s.Close()
+	c := s.client(Retry(RetryPolicy{}))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	var res map[string]interface{}
+	err := transport.CallContext(ctx, c, endpoints.GetCard, nil, &res, "card")
+	assert.Equal(t, context.DeadlineExceeded, err)
+	assert.Equal(t, 1, s.count("/v4/card/card"))
+}
+
+func TestCircuitBreaker_OpensPerService(t *testing.T) {
+	s := newFakeServer(
+		fakeResponse{status: http.StatusInternalServerError},
+		fakeResponse{status: http.StatusInternalServerError})
+	defer s.Close()
+	c := s.client(CircuitBreaker(BreakerSettings{FailureThreshold: 2, OpenTimeout: 50 * time.Millisecond}))
+
+	assert.Error(t, getCard(c))
+	assert.Error(t, getCard(c))
+	assert.Equal(t, ErrCircuitOpen, getCard(c))
+	assert.Equal(t, 2, s.count("/v4/card/card"))
+
+	//other services are not affected
+	var res map[string]interface{}
+	assert.NoError(t, c.Call(endpoints.VerifyIdentity, map[string]string{}, &res))
+
+	//a successful trial closes the circuit
+	time.Sleep(60 * time.Millisecond)
+	assert.NoError(t, getCard(c))
+	assert.NoError(t, getCard(c))
+}
+
+func TestCircuitBreaker_FailedTrial_Reopens(t *testing.T) {
+	s := newFakeServer(
+		fakeResponse{status: http.StatusInternalServerError},
+		fakeResponse{status: http.StatusInternalServerError})
+	defer s.Close()
+	c := s.client(CircuitBreaker(BreakerSettings{FailureThreshold: 1, OpenTimeout: 50 * time.Millisecond}))
+
+	assert.Error(t, getCard(c))
+	assert.Equal(t, ErrCircuitOpen, getCard(c))
+
+	time.Sleep(60 * time.Millisecond)
+	err := getCard(c)
+	assert.Error(t, err)
+	assert.NotEqual(t, ErrCircuitOpen, err)
+	assert.Equal(t, ErrCircuitOpen, getCard(c))
+}
+
+func TestChain_RetryAroundBreaker_OpenCircuitNotRetried(t *testing.T) {
+	s := newFakeServer(
+		fakeResponse{status: http.StatusInternalServerError},
+		fakeResponse{status: http.StatusInternalServerError},
+		fakeResponse{status: http.StatusInternalServerError})
+	defer s.Close()
+	c := s.client(
+		Retry(RetryPolicy{MaxAttempts: 5, BaseDelay: time.Millisecond}),
+		CircuitBreaker(BreakerSettings{FailureThreshold: 2}))
+
+	assert.Equal(t, ErrCircuitOpen, getCard(c))
+	assert.Equal(t, 2, s.count("/v4/card/card"))
+}
+
+func TestIsTemporary(t *testing.T) {
+	assert.False(t, IsTemporary(nil))
+	assert.False(t, IsTemporary(context.Canceled))
+	assert.False(t, IsTemporary(errors.Wrap(context.DeadlineExceeded, "")))
+	assert.False(t, IsTemporary(errors.NewHttpError(http.StatusNotFound, "")))
+	assert.True(t, IsTemporary(errors.Wrap(errors.NewHttpError(http.StatusServiceUnavailable, ""), "")))
+
+	//nothing listens on the port of a closed server
+	s := newFakeServer()
+	s.Close()
+	assert.True(t, IsTemporary(getCard(s.client())))
+	assert.True(t, IsTemporary(getCard(virgilhttp.NewNetTransportClient(s.URL, s.URL, s.URL, s.URL))))
+}
+
+func TestRetry_NetTransportClient_Retried(t *testing.T) {
+	s := newFakeServer(fakeResponse{status: http.StatusServiceUnavailable})
+	defer s.Close()
+	c := Chain(virgilhttp.NewNetTransportClient(s.URL, s.URL, s.URL, s.URL), Retry(RetryPolicy{BaseDelay: time.Millisecond}))
+
+	assert.NoError(t, getCard(c))
+	assert.Equal(t, 2, s.count("/v4/card/card"))
+}
@@ -0,0 +1,109 @@
+package middleware
+
+import (
+	"context"
+	"math/rand"
+	"sync"
+	"time"
+
+	"gopkg.in/virgil.v4/errors"
+	"gopkg.in/virgil.v4/transport"
+	"gopkg.in/virgil.v4/transport/endpoints"
+)
+
+// RetryPolicy configures Retry. Zero fields take the default values
+type RetryPolicy struct {
+	// MaxAttempts is the number of calls including the first one, 3 by default
+	MaxAttempts int
+	// BaseDelay is the upper bound of the first delay, which doubles with every attempt. 100ms by default
+	BaseDelay time.Duration
+	// MaxDelay limits the delay, 5s by default. A call is not repeated if the service asks to wait longer with Retry-After
+	MaxDelay time.Duration
+	// Endpoints tells which endpoints may be called again, IsIdempotent by default
+	Endpoints func(endpoint endpoints.Endpoint) bool
+	// Temporary tells which errors are worth another attempt, IsTemporary by default
+	Temporary func(err error) bool
+}
+
+func (p RetryPolicy) withDefaults() RetryPolicy {
+	if p.MaxAttempts < 1 {
+		p.MaxAttempts = 3
+	}
+	if p.BaseDelay <= 0 {
+		p.BaseDelay = 100 * time.Millisecond
+	}
+	if p.MaxDelay <= 0 {
+		p.MaxDelay = 5 * time.Second
+	}
+	if p.Endpoints == nil {
+		p.Endpoints = IsIdempotent
+	}
+	if p.Temporary == nil {
+		p.Temporary = IsTemporary
+	}
+	return p
+}
+
+// Retry repeats failed calls of idempotent endpoints with exponential backoff and full jitter.
+// The delay requested by the service with Retry-After is used instead of the backoff
+func Retry(policy RetryPolicy) Middleware {
+	policy = policy.withDefaults()
+	return func(next transport.Client) transport.Client {
+		r := &retrier{
+			policy: policy,
+			next:   next,
+			rand:   rand.New(rand.NewSource(time.Now().UnixNano())),
+		}
+		return &client{next: next, call: r.call}
+	}
+}
+
+type retrier struct {
+	policy RetryPolicy
+	next   transport.Client
+
+	randLock sync.Mutex
+	rand     *rand.Rand
+}
+
+func (r *retrier) call(ctx context.Context, endpoint endpoints.Endpoint, payload interface{}, returnObj interface{}, params ...interface{}) error {
+	if !r.policy.Endpoints(endpoint) {
+		return transport.CallContext(ctx, r.next, endpoint, payload, returnObj, params...)
+	}
+
+	for attempt := 0; ; attempt++ {
+		err := transport.CallContext(ctx, r.next, endpoint, payload, returnObj, params...)
+		if err == nil || attempt+1 >= r.policy.MaxAttempts || !r.policy.Temporary(err) {
+			return err
+		}
+
+		delay := r.backoff(attempt)
+		if e, ok := errors.ToSdkError(err); ok && e.RetryAfter() > 0 {
+			if e.RetryAfter() > r.policy.MaxDelay {
+				return err
+			}
+			delay = e.RetryAfter()
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		}
+	}
+}
+
+// backoff returns a random delay up to BaseDelay * 2^attempt, limited by MaxDelay
+func (r *retrier) backoff(attempt int) time.Duration {
+	limit := r.policy.MaxDelay
+	if attempt < 30 {
+		if d := r.policy.BaseDelay << uint(attempt); d > 0 && d < limit {
+			limit = d
+		}
+	}
+	r.randLock.Lock()
+	defer r.randLock.Unlock()
+	return time.Duration(r.rand.Int63n(int64(limit) + 1))
+}
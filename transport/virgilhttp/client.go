@@ -1,9 +1,11 @@
 package virgilhttp
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"strconv"
 	"strings"
 
 	"time"
@@ -23,14 +25,18 @@ func TransportClientDoer(client Doer) func(t *TransportClient) {
 	}
 }
 
+// TransportClientPFSServiceURL sets URL of the PFS service which keeps prekeys
+func TransportClientPFSServiceURL(url string) func(t *TransportClient) {
+	return func(t *TransportClient) {
+		t.pfsServiceURL = strings.TrimRight(url, "/")
+	}
+}
+
 // NewTransportClient create a new instance of HTTP Transport protocol for Virgil Client
 // You can send nil for second paramter and by defaolt will be used http.Client
 func NewTransportClient(serviceURL string, roServiceURL string, identityServiceURL string, vraServiceURL string, opts ...func(t *TransportClient)) *TransportClient {
 	t := &TransportClient{
-		cardServiceURL:     strings.TrimRight(serviceURL, "/"),
-		roCardServiceURL:   strings.TrimRight(roServiceURL, "/"),
-		identityServiceURL: strings.TrimRight(identityServiceURL, "/"),
-		vraServiceURL:      strings.TrimRight(vraServiceURL, "/"),
+		services: newServices(serviceURL, roServiceURL, identityServiceURL, vraServiceURL),
 		client: &fasthttp.Client{
 			MaxIdleConnDuration: 24 * time.Hour,
 			TLSConfig: &tls.Config{
@@ -49,52 +55,90 @@ type Doer interface {
 	Do(*fasthttp.Request, *fasthttp.Response) error
 }
 
+// DeadlineDoer is a Doer which can stop the request at the deadline, like fasthttp.Client
+type DeadlineDoer interface {
+	Doer
+	DoDeadline(req *fasthttp.Request, resp *fasthttp.Response, deadline time.Time) error
+}
+
 // TransportClient is implementation for virgil client transport protocol
 type TransportClient struct {
+	services
+	client Doer
+}
+
+// services keeps URLs of the services and the access token, they are the same for all transport clients
+type services struct {
 	cardServiceURL     string
 	roCardServiceURL   string
 	identityServiceURL string
 	vraServiceURL      string
-	client             Doer
+	pfsServiceURL      string
 	token              string
 }
 
+func newServices(serviceURL string, roServiceURL string, identityServiceURL string, vraServiceURL string) services {
+	return services{
+		cardServiceURL:     strings.TrimRight(serviceURL, "/"),
+		roCardServiceURL:   strings.TrimRight(roServiceURL, "/"),
+		identityServiceURL: strings.TrimRight(identityServiceURL, "/"),
+		vraServiceURL:      strings.TrimRight(vraServiceURL, "/"),
+		pfsServiceURL:      "https://pfs.virgilsecurity.com",
+	}
+}
+
 func (c *TransportClient) Call(endpoint endpoints.Endpoint, payload interface{}, returnObj interface{}, params ...interface{}) error {
+	return c.CallContext(context.Background(), endpoint, payload, returnObj, params...)
+}
+
+// CallContext returns ctx.Err() as soon as ctx is done. The deadline of ctx is passed to the doer if it implements DeadlineDoer
+func (c *TransportClient) CallContext(ctx context.Context, endpoint endpoints.Endpoint, payload interface{}, returnObj interface{}, params ...interface{}) error {
+	ep, url, err := c.endpointURL(endpoint, params)
+	if err != nil {
+		return err
+	}
+
+	res, err := c.getBody(c.do(ctx, ep.Method, url, payload))
+	if err != nil {
+		return err
+	}
+	return decodeBody(res, returnObj)
+}
 
+// endpointURL returns the endpoint along with its URL made of the params
+func (c *services) endpointURL(endpoint endpoints.Endpoint, params []interface{}) (*HTTPEndpoint, string, error) {
 	var ep *HTTPEndpoint
 
 	if e, ok := HTTPEndpoints[endpoint]; !ok {
-		return errors.Errorf("endpoint %d is not supported", endpoint)
+		return nil, "", errors.Errorf("endpoint %d is not supported", endpoint)
 	} else {
 		ep = e
 	}
 
 	url, err := c.ToServiceURL(ep.ServiceType)
 	if err != nil {
-		return err
+		return nil, "", err
 	}
 	if len(params) != ep.Params {
-		return errors.Errorf("expected %d params but got %d", ep.Params, len(params))
+		return nil, "", errors.Errorf("expected %d params but got %d", ep.Params, len(params))
 	}
 
 	urlParams := make([]interface{}, 1)
 	urlParams[0] = url
 	urlParams = append(urlParams, params...)
 
-	url = fmt.Sprintf(ep.URL, urlParams...)
+	return ep, fmt.Sprintf(ep.URL, urlParams...), nil
+}
 
-	res, err := c.getBody(c.do(ep.Method, url, payload))
-	if err != nil {
-		return err
-	}
-	err = json.Unmarshal(res, &returnObj)
+func decodeBody(body []byte, returnObj interface{}) error {
+	err := json.Unmarshal(body, &returnObj)
 	if err != nil {
 		return errors.Wrap(err, "Cannot unmarshal response body")
 	}
 	return nil
 }
 
-func (c *TransportClient) ToServiceURL(serviceType ServiceType) (string, error) {
+func (c *services) ToServiceURL(serviceType ServiceType) (string, error) {
 	switch serviceType {
 	case Cardservice:
 		return c.cardServiceURL, nil
@@ -104,6 +148,8 @@ func (c *TransportClient) ToServiceURL(serviceType ServiceType) (string, error)
 		return c.identityServiceURL, nil
 	case VRAService:
 		return c.vraServiceURL, nil
+	case PFSService:
+		return c.pfsServiceURL, nil
 
 	default:
 		return "", errors.Errorf("service %d not supported", serviceType)
@@ -111,7 +157,7 @@ func (c *TransportClient) ToServiceURL(serviceType ServiceType) (string, error)
 	}
 }
 
-func (c *TransportClient) SetToken(token string) {
+func (c *services) SetToken(token string) {
 	c.token = token
 }
 
@@ -120,33 +166,57 @@ type responseError struct {
 }
 
 func (c *TransportClient) getBody(resp *fasthttp.Response, err error) ([]byte, error) {
-	if resp == nil {
-		return nil, errors.New("nil response")
-	}
-
 	if err != nil {
 		return nil, errors.Wrap(err, "")
 	}
 
-	body := resp.Body()
+	if resp == nil {
+		return nil, errors.New("nil response")
+	}
+
+	return checkResponse(resp.Header.StatusCode(), string(resp.Header.Peek("Retry-After")), resp.Body())
+}
 
-	if resp.Header.StatusCode() == http.StatusNotFound {
+// checkResponse returns the body of a successful response or the error the service answered with
+func checkResponse(statusCode int, retryAfterHeader string, body []byte) ([]byte, error) {
+	if statusCode == http.StatusNotFound {
 		return nil, errors.Wrap(transport.ErrNotFound, "")
 	}
 
-	if resp.Header.StatusCode() != http.StatusOK {
+	if statusCode != http.StatusOK {
+		retryAfter := parseRetryAfter(retryAfterHeader, time.Now())
 		verr := &responseError{}
-		err = json.Unmarshal(body, verr)
+		err := json.Unmarshal(body, verr)
 		if err != nil {
-			return nil, errors.Wrap(transport.ErrByTransportCode(resp.Header.StatusCode(), string(body)), "")
+			return nil, errors.Wrap(errors.WithRetryAfter(transport.ErrByTransportCode(statusCode, string(body)), retryAfter), "")
 		}
-		return nil, errors.Wrap(transport.GetErrByCode(resp.Header.StatusCode(), verr.Code), "")
+		return nil, errors.Wrap(errors.WithRetryAfter(transport.GetErrByCode(statusCode, verr.Code), retryAfter), "")
 
 	}
 	return body, nil
 }
 
-func (c *TransportClient) do(method, url string, model interface{}) (*fasthttp.Response, error) {
+// parseRetryAfter returns the delay of the Retry-After header which is either a number of seconds or an HTTP date
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0
+		}
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(value); err == nil && date.After(now) {
+		return date.Sub(now)
+	}
+	return 0
+}
+
+func (c *TransportClient) do(ctx context.Context, method, url string, model interface{}) (*fasthttp.Response, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
 
 	var req fasthttp.Request
 	req.Header.SetMethod(method)
@@ -165,6 +235,31 @@ func (c *TransportClient) do(method, url string, model interface{}) (*fasthttp.R
 	}
 
 	var resp fasthttp.Response
-	err := c.client.Do(&req, &resp)
-	return &resp, err
+	if ctx.Done() == nil {
+		err := c.client.Do(&req, &resp)
+		return &resp, err
+	}
+
+	//fasthttp can't cancel a request, so the response is not waited for once ctx is done.
+	//The request and the response are not reused, so the call may finish in the background
+	done := make(chan error, 1)
+	go func() {
+		if deadline, ok := ctx.Deadline(); ok {
+			if d, ok := c.client.(DeadlineDoer); ok {
+				done <- d.DoDeadline(&req, &resp, deadline)
+				return
+			}
+		}
+		done <- c.client.Do(&req, &resp)
+	}()
+
+	select {
+	case err := <-done:
+		if err != nil && ctx.Err() != nil {
+			err = ctx.Err()
+		}
+		return &resp, err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
 }
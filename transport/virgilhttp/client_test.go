@@ -2,9 +2,11 @@ package virgilhttp
 
 import (
 	"bytes"
+	"context"
 	"io/ioutil"
 	"net/http"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
@@ -132,3 +134,61 @@ func Test_ClientReturnStatusNotOkAndBodyBroken_ReturnErr(t *testing.T) {
 		assert.Contains(t, err.Error(), "unmarshal")
 	}
 }
+
+type blockingDoer struct {
+	release  chan struct{}
+	deadline time.Time
+}
+
+func (d *blockingDoer) Do(req *fasthttp.Request, resp *fasthttp.Response) error {
+	<-d.release
+	resp.SetBody([]byte(`{}`))
+	return nil
+}
+
+func (d *blockingDoer) DoDeadline(req *fasthttp.Request, resp *fasthttp.Response, deadline time.Time) error {
+	d.deadline = deadline
+	return d.Do(req, resp)
+}
+
+func TestCallContext_Cancel_ReturnCtxErr(t *testing.T) {
+	d := &blockingDoer{release: make(chan struct{})}
+	defer close(d.release)
+	tc := NewTransportClient("serviceURL", "roServiceURL", "identityUrl", "vraurl", TransportClientDoer(d))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		cancel()
+	}()
+	var res map[string]interface{}
+	err := tc.CallContext(ctx, endpoints.GetCard, nil, &res, "id")
+	assert.Equal(t, context.Canceled, errors.Cause(err))
+
+	//done context is not called at all
+	err = tc.CallContext(ctx, endpoints.GetCard, nil, &res, "id")
+	assert.Equal(t, context.Canceled, errors.Cause(err))
+}
+
+func TestCallContext_Deadline_PassedToDoer(t *testing.T) {
+	d := &blockingDoer{release: make(chan struct{})}
+	close(d.release)
+	tc := NewTransportClient("serviceURL", "roServiceURL", "identityUrl", "vraurl", TransportClientDoer(d))
+
+	deadline := time.Now().Add(time.Minute)
+	ctx, cancel := context.WithDeadline(context.Background(), deadline)
+	defer cancel()
+	var res map[string]interface{}
+	assert.NoError(t, tc.CallContext(ctx, endpoints.GetCard, nil, &res, "id"))
+	assert.True(t, deadline.Equal(d.deadline))
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2017, 6, 1, 12, 0, 0, 0, time.UTC)
+	assert.Equal(t, time.Duration(0), parseRetryAfter("", now))
+	assert.Equal(t, 120*time.Second, parseRetryAfter("120", now))
+	assert.Equal(t, time.Duration(0), parseRetryAfter("-1", now))
+	assert.Equal(t, 30*time.Second, parseRetryAfter("Thu, 01 Jun 2017 12:00:30 GMT", now))
+	assert.Equal(t, time.Duration(0), parseRetryAfter("Thu, 01 Jun 2017 11:00:00 GMT", now))
+	assert.Equal(t, time.Duration(0), parseRetryAfter("soon", now))
+}
@@ -13,6 +13,7 @@ const (
 	ROCardService
 	IdentityService
 	VRAService
+	PFSService
 )
 
 type HTTPEndpoint struct {
@@ -72,4 +73,33 @@ var HTTPEndpoints = map[Endpoint]*HTTPEndpoint{
 		ServiceType: Cardservice,
 		Params:      1,
 	},
+	UploadPrekeys: {
+		Method:      http.MethodPost,
+		URL:         "%s/v1/recipient/%s",
+		ServiceType: PFSService,
+		Params:      1,
+	},
+	UploadOneTimePrekeys: {
+		Method:      http.MethodPost,
+		URL:         "%s/v1/recipient/%s/actions/push-otcs",
+		ServiceType: PFSService,
+		Params:      1,
+	},
+	ClaimPrekeys: {
+		Method:      http.MethodPost,
+		URL:         "%s/v1/recipient/actions/search-by-ids",
+		ServiceType: PFSService,
+	},
+	CountOneTimePrekeys: {
+		Method:      http.MethodPost,
+		URL:         "%s/v1/recipient/%s/actions/count-otcs",
+		ServiceType: PFSService,
+		Params:      1,
+	},
+	ValidateOneTimePrekeys: {
+		Method:      http.MethodPost,
+		URL:         "%s/v1/recipient/%s/actions/validate-otcs",
+		ServiceType: PFSService,
+		Params:      1,
+	},
 }
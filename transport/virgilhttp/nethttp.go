@@ -0,0 +1,111 @@
+package virgilhttp
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"gopkg.in/virgil.v4/errors"
+	"gopkg.in/virgil.v4/transport/endpoints"
+)
+
+// NetTransportClientHTTPClient sets the net/http client which makes requests, so its transport can add proxies, TLS client certificates or tracing
+func NetTransportClientHTTPClient(client *http.Client) func(t *NetTransportClient) {
+	return func(t *NetTransportClient) {
+		t.client = client
+	}
+}
+
+// NetTransportClientPFSServiceURL sets URL of the PFS service which keeps prekeys
+func NetTransportClientPFSServiceURL(url string) func(t *NetTransportClient) {
+	return func(t *NetTransportClient) {
+		t.pfsServiceURL = strings.TrimRight(url, "/")
+	}
+}
+
+// NewNetTransportClient create a new instance of HTTP Transport protocol for Virgil Client which uses net/http instead of fasthttp.
+// By default http.DefaultClient is used, so proxies are taken from the environment
+func NewNetTransportClient(serviceURL string, roServiceURL string, identityServiceURL string, vraServiceURL string, opts ...func(t *NetTransportClient)) *NetTransportClient {
+	t := &NetTransportClient{
+		services: newServices(serviceURL, roServiceURL, identityServiceURL, vraServiceURL),
+		client:   http.DefaultClient,
+	}
+	for _, option := range opts {
+		option(t)
+	}
+	return t
+}
+
+// NetTransportClient is implementation for virgil client transport protocol over net/http
+type NetTransportClient struct {
+	services
+	client *http.Client
+}
+
+func (c *NetTransportClient) Call(endpoint endpoints.Endpoint, payload interface{}, returnObj interface{}, params ...interface{}) error {
+	return c.CallContext(context.Background(), endpoint, payload, returnObj, params...)
+}
+
+// CallContext passes ctx to the request, so the request is cancelled as soon as ctx is done
+func (c *NetTransportClient) CallContext(ctx context.Context, endpoint endpoints.Endpoint, payload interface{}, returnObj interface{}, params ...interface{}) error {
+	ep, url, err := c.endpointURL(endpoint, params)
+	if err != nil {
+		return err
+	}
+
+	res, err := c.do(ctx, ep.Method, url, payload)
+	if err != nil {
+		return err
+	}
+	return decodeBody(res, returnObj)
+}
+
+func (c *NetTransportClient) do(ctx context.Context, method, url string, model interface{}) ([]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, errors.Wrap(err, "")
+	}
+
+	var body io.Reader
+	if model != nil {
+		reqBody, err := json.Marshal(model)
+		if err != nil {
+			return nil, errors.Wrap(err, "Cannot marshal model")
+		}
+		body = bytes.NewReader(reqBody)
+	}
+
+	req, err := http.NewRequest(method, url, body)
+	if err != nil {
+		return nil, errors.Wrap(err, "")
+	}
+	req = req.WithContext(ctx)
+	if model != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if len(c.token) > 0 {
+		req.Header.Set("Authorization", fmt.Sprintf("VIRGIL %s", c.token))
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		if ctx.Err() != nil {
+			err = ctx.Err()
+		}
+		return nil, errors.Wrap(err, "")
+	}
+	defer resp.Body.Close()
+
+	respBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		if ctx.Err() != nil {
+			err = ctx.Err()
+		}
+		return nil, errors.Wrap(err, "")
+	}
+	return checkResponse(resp.StatusCode, resp.Header.Get("Retry-After"), respBody)
+}
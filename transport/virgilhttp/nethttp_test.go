@@ -0,0 +1,125 @@
+package virgilhttp
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/virgil.v4/errors"
+	"gopkg.in/virgil.v4/transport"
+	"gopkg.in/virgil.v4/transport/endpoints"
+)
+
+type countingRoundTripper struct {
+	calls int
+}
+
+func (rt *countingRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	rt.calls++
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func TestNewNetTransportClient_InitByDefault_DefaultClient(t *testing.T) {
+	v := NewNetTransportClient("test url/", "test ro url", "test ident url", "test vra url", NetTransportClientPFSServiceURL("test pfs url/"))
+	assert.Equal(t, "test url", v.cardServiceURL)
+	assert.Equal(t, "test pfs url", v.pfsServiceURL)
+	assert.Equal(t, http.DefaultClient, v.client)
+}
+
+func TestNetTransportClient_Call(t *testing.T) {
+	var request *http.Request
+	var body string
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		request = r
+		b, _ := ioutil.ReadAll(r.Body)
+		body = string(b)
+		w.Write([]byte(`{"id":"card"}`))
+	}))
+	defer s.Close()
+
+	rt := &countingRoundTripper{}
+	c := NewNetTransportClient(s.URL, s.URL, s.URL, s.URL, NetTransportClientHTTPClient(&http.Client{Transport: rt}))
+	c.SetToken("token")
+
+	var res map[string]string
+	assert.NoError(t, c.Call(endpoints.GetCard, nil, &res, "card"))
+	assert.Equal(t, "card", res["id"])
+	assert.Equal(t, http.MethodGet, request.Method)
+	assert.Equal(t, "/v4/card/card", request.URL.Path)
+	assert.Equal(t, "VIRGIL token", request.Header.Get("Authorization"))
+	assert.Empty(t, body)
+
+	assert.NoError(t, c.Call(endpoints.SearchCards, map[string]string{"scope": "global"}, &res))
+	assert.Equal(t, http.MethodPost, request.Method)
+	assert.Equal(t, `{"scope":"global"}`, body)
+	assert.Equal(t, 2, rt.calls)
+}
+
+func TestNetTransportClient_InvalidEndpointOrParams_ReturnErr(t *testing.T) {
+	c := NewNetTransportClient("serviceURL", "roServiceURL", "identityUrl", "vraurl")
+	assert.Error(t, c.Call(1000, nil, nil))
+	assert.Error(t, c.Call(endpoints.GetCard, nil, nil, 0, 1))
+}
+
+func TestNetTransportClient_StatusNotOk_ReturnDecodedErr(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v4/card/missing":
+			w.WriteHeader(http.StatusNotFound)
+		case "/v4/card/broken":
+			w.WriteHeader(http.StatusBadGateway)
+			w.Write([]byte(`asdf;asdf`))
+		default:
+			w.Header().Set("Retry-After", "120")
+			w.WriteHeader(http.StatusTooManyRequests)
+			w.Write([]byte(`{"code":10000}`))
+		}
+	}))
+	defer s.Close()
+	c := NewNetTransportClient(s.URL, s.URL, s.URL, s.URL)
+
+	var res map[string]interface{}
+	err := c.Call(endpoints.GetCard, nil, &res, "missing")
+	assert.Equal(t, transport.ErrNotFound, errors.Cause(err))
+
+	err = c.Call(endpoints.GetCard, nil, &res, "broken")
+	sdkErr, ok := errors.ToSdkError(err)
+	assert.True(t, ok)
+	assert.Equal(t, http.StatusBadGateway, sdkErr.HTTPErrorCode())
+
+	err = c.Call(endpoints.GetCard, nil, &res, "card")
+	sdkErr, ok = errors.ToSdkError(err)
+	assert.True(t, ok)
+	assert.Equal(t, 10000, sdkErr.ServiceErrorCode())
+	assert.Equal(t, 120*time.Second, sdkErr.RetryAfter())
+}
+
+func TestNetTransportClient_CallContext_Cancel_ReturnCtxErr(t *testing.T) {
+	release := make(chan struct{})
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer s.Close()
+	defer close(release)
+	c := NewNetTransportClient(s.URL, s.URL, s.URL, s.URL)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		cancel()
+	}()
+	var res map[string]interface{}
+	err := c.CallContext(ctx, endpoints.GetCard, nil, &res, "id")
+	assert.Equal(t, context.Canceled, errors.Cause(err))
+
+	//done context is not called at all
+	err = c.CallContext(ctx, endpoints.GetCard, nil, &res, "id")
+	assert.Equal(t, context.Canceled, errors.Cause(err))
+}
@@ -36,11 +36,20 @@ func NewWithConfig(config Config) (*Api, error) {
 	if err := virgil.Crypto().SetKeyType(config.KeyType); err != nil {
 		return nil, err
 	}
+	if config.ContentCipher != nil {
+		virgil.Crypto().SetContentCipher(config.ContentCipher)
+	}
 
 	if config.ClientParams != nil {
 		clientParams := config.ClientParams
-		params = append(params, virgil.ClientTransport(virgilhttp.NewTransportClient(clientParams.CardServiceURL,
-			clientParams.ReadOnlyCardServiceURL, clientParams.IdentityServiceURL, clientParams.VRAServiceURL)))
+		if clientParams.HTTPClient != nil {
+			params = append(params, virgil.ClientTransport(virgilhttp.NewNetTransportClient(clientParams.CardServiceURL,
+				clientParams.ReadOnlyCardServiceURL, clientParams.IdentityServiceURL, clientParams.VRAServiceURL,
+				virgilhttp.NetTransportClientHTTPClient(clientParams.HTTPClient))))
+		} else {
+			params = append(params, virgil.ClientTransport(virgilhttp.NewTransportClient(clientParams.CardServiceURL,
+				clientParams.ReadOnlyCardServiceURL, clientParams.IdentityServiceURL, clientParams.VRAServiceURL)))
+		}
 	}
 
 	var validator virgil.CardsValidator
@@ -80,9 +89,12 @@ func NewWithConfig(config Config) (*Api, error) {
 	}
 	var key *appKey
 	if config.Credentials != nil {
-		k, err := virgil.Crypto().ImportPrivateKey(config.Credentials.PrivateKey, config.Credentials.PrivateKeyPassword)
-		if err != nil {
-			return nil, err
+		k := config.Credentials.Key
+		if k == nil {
+			k, err = virgil.Crypto().ImportPrivateKey(config.Credentials.PrivateKey, config.Credentials.PrivateKeyPassword)
+			if err != nil {
+				return nil, err
+			}
 		}
 		key = &appKey{id: config.Credentials.AppId, key: k}
 	}
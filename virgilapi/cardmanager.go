@@ -1,6 +1,7 @@
 package virgilapi
 
 import (
+	"context"
 	"encoding/base64"
 	"encoding/hex"
 
@@ -12,17 +13,26 @@ import (
 
 type CardManager interface {
 	Get(id string) (*Card, error)
+	GetContext(ctx context.Context, id string) (*Card, error)
 	Create(identity string, key *Key, customFields map[string]string) (*Card, error)
 	CreateGlobal(identity string, key *Key) (*Card, error)
 	Import(card string) (*Card, error)
 	VerifyIdentity(identity string) (actionId string, err error)
+	VerifyIdentityContext(ctx context.Context, identity string) (actionId string, err error)
 	ConfirmIdentity(actionId string, confirmationCode string) (validationToken string, err error)
+	ConfirmIdentityContext(ctx context.Context, actionId string, confirmationCode string) (validationToken string, err error)
 	Publish(card *Card) (*Card, error)
+	PublishContext(ctx context.Context, card *Card) (*Card, error)
 	PublishGlobal(card *Card, validationToken string) (*Card, error)
+	PublishGlobalContext(ctx context.Context, card *Card, validationToken string) (*Card, error)
 	Revoke(card *Card, reason virgil.Enum) error
+	RevokeContext(ctx context.Context, card *Card, reason virgil.Enum) error
 	RevokeGlobal(card *Card, reason virgil.Enum, key *Key, validationToken string) error
+	RevokeGlobalContext(ctx context.Context, card *Card, reason virgil.Enum, key *Key, validationToken string) error
 	Find(identities ...string) (Cards, error)
+	FindContext(ctx context.Context, identities ...string) (Cards, error)
 	FindGlobal(identityType string, identities ...string) (Cards, error)
+	FindGlobalContext(ctx context.Context, identityType string, identities ...string) (Cards, error)
 }
 
 type cardManager struct {
@@ -30,7 +40,11 @@ type cardManager struct {
 }
 
 func (c *cardManager) Get(id string) (*Card, error) {
-	card, err := c.context.client.GetCard(id)
+	return c.GetContext(context.Background(), id)
+}
+
+func (c *cardManager) GetContext(ctx context.Context, id string) (*Card, error) {
+	card, err := c.context.client.GetCardContext(ctx, id)
 	if err != nil {
 		return nil, err
 	}
@@ -156,12 +170,16 @@ func (c *cardManager) Import(card string) (*Card, error) {
 }
 
 func (c *cardManager) VerifyIdentity(identity string) (actionId string, err error) {
+	return c.VerifyIdentityContext(context.Background(), identity)
+}
+
+func (c *cardManager) VerifyIdentityContext(ctx context.Context, identity string) (actionId string, err error) {
 	req := &virgil.VerifyRequest{
 		Type:  "email",
 		Value: identity,
 	}
 
-	resp, err := c.context.client.VerifyIdentity(req)
+	resp, err := c.context.client.VerifyIdentityContext(ctx, req)
 	if err != nil {
 		return "", err
 	}
@@ -169,6 +187,10 @@ func (c *cardManager) VerifyIdentity(identity string) (actionId string, err erro
 }
 
 func (c *cardManager) ConfirmIdentity(actionId string, confirmationCode string) (validationToken string, err error) {
+	return c.ConfirmIdentityContext(context.Background(), actionId, confirmationCode)
+}
+
+func (c *cardManager) ConfirmIdentityContext(ctx context.Context, actionId string, confirmationCode string) (validationToken string, err error) {
 
 	req := &virgil.ConfirmRequest{
 		ActionId:         actionId,
@@ -178,7 +200,7 @@ func (c *cardManager) ConfirmIdentity(actionId string, confirmationCode string)
 			TimeToLive:  3600,
 		},
 	}
-	resp, err := c.context.client.ConfirmIdentity(req)
+	resp, err := c.context.client.ConfirmIdentityContext(ctx, req)
 	if err != nil {
 		return "", err
 	}
@@ -188,6 +210,10 @@ func (c *cardManager) ConfirmIdentity(actionId string, confirmationCode string)
 // Publish will sign request with app signature and try to publish it to the server
 // The signature will be added to request
 func (c *cardManager) Publish(card *Card) (*Card, error) {
+	return c.PublishContext(context.Background(), card)
+}
+
+func (c *cardManager) PublishContext(ctx context.Context, card *Card) (*Card, error) {
 	if c.context.appKey == nil || c.context.appKey.key == nil {
 		return nil, errors.New("No app private key provided for request signing")
 	}
@@ -203,7 +229,7 @@ func (c *cardManager) Publish(card *Card) (*Card, error) {
 		return nil, err
 	}
 
-	res, err := c.context.client.CreateCard(req)
+	res, err := c.context.client.CreateCardContext(ctx, req)
 	if err != nil {
 		return nil, err
 	}
@@ -215,6 +241,10 @@ func (c *cardManager) Publish(card *Card) (*Card, error) {
 }
 
 func (c *cardManager) PublishGlobal(card *Card, validationToken string) (*Card, error) {
+	return c.PublishGlobalContext(context.Background(), card, validationToken)
+}
+
+func (c *cardManager) PublishGlobalContext(ctx context.Context, card *Card, validationToken string) (*Card, error) {
 	req, err := card.ToRequest()
 
 	if err != nil {
@@ -224,7 +254,7 @@ func (c *cardManager) PublishGlobal(card *Card, validationToken string) (*Card,
 	req.Meta.Validation = &virgil.ValidationInfo{}
 
 	req.Meta.Validation.Token = validationToken
-	res, err := c.context.client.CreateCard(req)
+	res, err := c.context.client.CreateCardContext(ctx, req)
 	if err != nil {
 		return nil, err
 	}
@@ -236,6 +266,10 @@ func (c *cardManager) PublishGlobal(card *Card, validationToken string) (*Card,
 }
 
 func (c *cardManager) Revoke(card *Card, reason virgil.Enum) error {
+	return c.RevokeContext(context.Background(), card, reason)
+}
+
+func (c *cardManager) RevokeContext(ctx context.Context, card *Card, reason virgil.Enum) error {
 	if c.context.appKey == nil || c.context.appKey.key == nil {
 		return errors.New("No app private key provided for request signing")
 	}
@@ -250,10 +284,14 @@ func (c *cardManager) Revoke(card *Card, reason virgil.Enum) error {
 		return err
 	}
 
-	return c.context.client.RevokeCard(req)
+	return c.context.client.RevokeCardContext(ctx, req)
 }
 
 func (c *cardManager) RevokeGlobal(card *Card, reason virgil.Enum, signerKey *Key, validationToken string) error {
+	return c.RevokeGlobalContext(context.Background(), card, reason, signerKey, validationToken)
+}
+
+func (c *cardManager) RevokeGlobalContext(ctx context.Context, card *Card, reason virgil.Enum, signerKey *Key, validationToken string) error {
 
 	req, err := virgil.NewRevokeCardRequest(card.ID, reason)
 	if err != nil {
@@ -267,12 +305,16 @@ func (c *cardManager) RevokeGlobal(card *Card, reason virgil.Enum, signerKey *Ke
 	req.Meta.Validation = &virgil.ValidationInfo{}
 	req.Meta.Validation.Token = validationToken
 
-	return c.context.client.RevokeCard(req)
+	return c.context.client.RevokeCardContext(ctx, req)
 }
 
 func (c *cardManager) Find(identities ...string) (Cards, error) {
+	return c.FindContext(context.Background(), identities...)
+}
+
+func (c *cardManager) FindContext(ctx context.Context, identities ...string) (Cards, error) {
 
-	cards, err := c.context.client.SearchCards(virgil.SearchCriteriaByIdentities(identities...))
+	cards, err := c.context.client.SearchCardsContext(ctx, virgil.SearchCriteriaByIdentities(identities...))
 	if err != nil {
 		return nil, err
 	}
@@ -288,8 +330,12 @@ func (c *cardManager) Find(identities ...string) (Cards, error) {
 }
 
 func (c *cardManager) FindGlobal(identityType string, identities ...string) (Cards, error) {
+	return c.FindGlobalContext(context.Background(), identityType, identities...)
+}
+
+func (c *cardManager) FindGlobalContext(ctx context.Context, identityType string, identities ...string) (Cards, error) {
 
-	cards, err := c.context.client.SearchCards(&virgil.Criteria{
+	cards, err := c.context.client.SearchCardsContext(ctx, &virgil.Criteria{
 		IdentityType: identityType,
 		Identities:   identities,
 		Scope:        virgil.CardScope.Global,
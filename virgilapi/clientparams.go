@@ -1,8 +1,12 @@
 package virgilapi
 
+import "net/http"
+
 type ClientParams struct {
 	CardServiceURL,
 	ReadOnlyCardServiceURL,
 	IdentityServiceURL,
 	VRAServiceURL string
+	//HTTPClient makes requests with net/http instead of fasthttp if set
+	HTTPClient *http.Client
 }
@@ -9,5 +9,6 @@ type Config struct {
 	KeyStoragePath       string
 	CardVerifiers        map[string]Buffer
 	KeyType              virgilcrypto.KeyType
+	ContentCipher        virgilcrypto.ContentCipher
 	SkipBuiltInVerifiers bool
 }
@@ -1,7 +1,11 @@
 package virgilapi
 
+import "gopkg.in/virgil.v4/virgilcrypto"
+
 type AppCredentials struct {
 	AppId              string
 	PrivateKey         Buffer
 	PrivateKeyPassword string
+	//Key is used instead of PrivateKey when app key can't be exported, see virgilcrypto.NewSignerPrivateKey
+	Key virgilcrypto.PrivateKey
 }
@@ -0,0 +1,353 @@
+package virgilapi
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"sync"
+
+	"gopkg.in/virgil.v4"
+	"gopkg.in/virgil.v4/errors"
+	"gopkg.in/virgil.v4/virgilcrypto"
+)
+
+type SecureChatParams struct {
+	IdentityCard *Card
+	IdentityKey  *Key
+	//Sessions keeps established sessions. In-memory storage with a random key is used if nil
+	Sessions virgil.SessionStorage
+	//PrekeyPassword protects private prekeys kept in the key storage
+	PrekeyPassword string
+}
+
+//SecureChat establishes PFS sessions with other cards using their prekeys
+type SecureChat struct {
+	context      *Context
+	identityCard *Card
+	identityKey  *Key
+	sessions     virgil.SessionStorage
+	//Prekeys publishes prekeys of the identity card, so that others can start sessions with it
+	Prekeys *virgil.PrekeyManager
+
+	lock sync.Mutex
+	//active keeps the session StartSession returns for every recipient card id
+	active map[string]*SecureSession
+	//known keeps every session of the chat by its SessionID, so that messages are decrypted by the same object which encrypts
+	known map[string]*SecureSession
+}
+
+//SecureSession encrypts messages with the session key
+type SecureSession struct {
+	session *virgilcrypto.PFSSession
+
+	lock sync.Mutex
+	//handshake is sent by the initiator until the first reply is received
+	handshake *SecureHandshake
+}
+
+//SecureHandshake lets the responder compute the session key
+type SecureHandshake struct {
+	InitiatorCardID string `json:"initiator_card_id"`
+	EphemeralKey    []byte `json:"ephemeral_key"`
+	LongTermCardID  string `json:"long_term_card_id"`
+	OneTimeCardID   string `json:"one_time_card_id,omitempty"`
+}
+
+//SecureMessage is sent over the wire. Messages of the initiator carry the handshake until the responder replies,
+//so that the responder can create the session from any of them
+type SecureMessage struct {
+	SessionID  []byte           `json:"session_id"`
+	Handshake  *SecureHandshake `json:"handshake,omitempty"`
+	Salt       []byte           `json:"salt"`
+	Ciphertext []byte           `json:"ciphertext"`
+}
+
+func (a *Api) SecureChat(params SecureChatParams) (*SecureChat, error) {
+	if params.IdentityCard == nil || params.IdentityKey == nil {
+		return nil, errors.New("identity card and key are required")
+	}
+
+	sessions := params.Sessions
+	if sessions == nil {
+		key := make([]byte, virgilcrypto.PFSSessionKeySize)
+		if _, err := rand.Read(key); err != nil {
+			return nil, errors.Wrap(err, "")
+		}
+		sessions = &virgil.MemorySessionStorage{Key: key}
+	}
+
+	return &SecureChat{
+		context:      a.context,
+		identityCard: params.IdentityCard,
+		identityKey:  params.IdentityKey,
+		sessions:     sessions,
+		Prekeys: &virgil.PrekeyManager{
+			Client:       a.context.client,
+			Storage:      a.context.storage,
+			IdentityCard: params.IdentityCard.Card,
+			IdentityKey:  params.IdentityKey.privateKey,
+			KeyPassword:  params.PrekeyPassword,
+		},
+		active: make(map[string]*SecureSession),
+		known:  make(map[string]*SecureSession),
+	}, nil
+}
+
+//StartSession returns the active session with the recipient or starts a new one using recipient's prekeys.
+//The first session established with the recipient stays active, whichever side started it, so when both sides
+//start sessions at the same time each of them keeps sending with its own one
+func (c *SecureChat) StartSession(recipient *Card) (*SecureSession, error) {
+	c.lock.Lock()
+	s, ok := c.active[recipient.ID]
+	c.lock.Unlock()
+	if ok {
+		return s, nil
+	}
+
+	//prekeys are claimed without the lock, so that a slow service doesn't block other sessions
+	s, err := c.initiate(recipient)
+	if err != nil {
+		return nil, err
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if active, ok := c.active[recipient.ID]; ok && c.sessions.Exists(active.session.SessionID) {
+		return active, nil
+	}
+	if err = c.sessions.Store(s.session); err != nil {
+		return nil, err
+	}
+	c.active[recipient.ID] = s
+	c.known[sessionKey(s.session.SessionID)] = s
+	return s, nil
+}
+
+func (c *SecureChat) initiate(recipient *Card) (*SecureSession, error) {
+	pfs, err := pfsCrypto()
+	if err != nil {
+		return nil, err
+	}
+
+	bundles, err := c.context.client.ClaimPrekeys(recipient.ID)
+	if err != nil {
+		return nil, err
+	}
+	if len(bundles) != 1 || bundles[0].IdentityCard.ID != recipient.ID {
+		return nil, errors.New("prekeys of the recipient were not found")
+	}
+	bundle := bundles[0]
+
+	ephemeral, err := virgil.Crypto().GenerateKeypair()
+	if err != nil {
+		return nil, err
+	}
+	ephemeralKey, err := ephemeral.PublicKey().Encode()
+	if err != nil {
+		return nil, err
+	}
+
+	handshake := &SecureHandshake{
+		InitiatorCardID: c.identityCard.ID,
+		EphemeralKey:    ephemeralKey,
+		LongTermCardID:  bundle.LongTermCard.ID,
+	}
+	var oneTime *virgilcrypto.PrekeyCard
+	if bundle.OneTimeCard != nil {
+		if oneTime, err = bundle.OneTimeCard.PrekeyCard(); err != nil {
+			return nil, err
+		}
+		handshake.OneTimeCardID = bundle.OneTimeCard.ID
+	}
+
+	longTerm, err := bundle.LongTermCard.PrekeyCard()
+	if err != nil {
+		return nil, err
+	}
+
+	session, err := pfs.StartInitiatorSession(recipient.PublicKey, longTerm, oneTime,
+		c.identityKey.privateKey, ephemeral.PrivateKey(), c.identityCard.ID, recipient.ID)
+	if err != nil {
+		return nil, err
+	}
+	return &SecureSession{session: session, handshake: handshake}, nil
+}
+
+//ResumeSession loads a previously established session from the session storage
+func (c *SecureChat) ResumeSession(sessionID Buffer) (*SecureSession, error) {
+	session, err := c.sessions.Load(sessionID)
+	if err != nil {
+		return nil, err
+	}
+	return &SecureSession{session: session}, nil
+}
+
+//SessionFromMessage returns the session the message belongs to. If the message is the first one from the initiator
+//the responder session is created and the used one-time prekey is removed
+func (c *SecureChat) SessionFromMessage(message Buffer) (*SecureSession, error) {
+	msg, err := parseSecureMessage(message)
+	if err != nil {
+		return nil, err
+	}
+
+	c.lock.Lock()
+	s, err := c.knownSession(msg.SessionID)
+	c.lock.Unlock()
+	if err != virgil.ErrorSessionNotFound {
+		return s, err
+	}
+	if msg.Handshake == nil {
+		return nil, virgil.ErrorSessionNotFound
+	}
+
+	//initiator card is fetched without the lock, so that a slow service doesn't block other sessions
+	initiator, err := c.context.client.GetCard(msg.Handshake.InitiatorCardID)
+	if err != nil {
+		return nil, err
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if s, err = c.knownSession(msg.SessionID); err != virgil.ErrorSessionNotFound {
+		return s, err
+	}
+	return c.respond(msg, initiator)
+}
+
+//knownSession returns the session used by the chat or loads it from the storage, c.lock must be held
+func (c *SecureChat) knownSession(sessionID []byte) (*SecureSession, error) {
+	if s, ok := c.known[sessionKey(sessionID)]; ok {
+		return s, nil
+	}
+	if !c.sessions.Exists(sessionID) {
+		return nil, virgil.ErrorSessionNotFound
+	}
+	s, err := c.ResumeSession(sessionID)
+	if err != nil {
+		return nil, err
+	}
+	c.known[sessionKey(sessionID)] = s
+	return s, nil
+}
+
+//DecryptMessage decrypts a message of any session, creating the responder session if needed
+func (c *SecureChat) DecryptMessage(message Buffer) (Buffer, error) {
+	s, err := c.SessionFromMessage(message)
+	if err != nil {
+		return nil, err
+	}
+	return s.DecryptMessage(message)
+}
+
+//respond creates the responder session, c.lock must be held
+func (c *SecureChat) respond(msg *SecureMessage, initiator *virgil.Card) (*SecureSession, error) {
+	pfs, err := pfsCrypto()
+	if err != nil {
+		return nil, err
+	}
+
+	h := msg.Handshake
+	ephemeral, err := virgil.Crypto().ImportPublicKey(h.EphemeralKey)
+	if err != nil {
+		return nil, err
+	}
+	longTerm, err := c.Prekeys.LoadPrivateKey(h.LongTermCardID)
+	if err != nil {
+		return nil, errors.Wrap(err, "long-term prekey was not found")
+	}
+	var oneTime virgilcrypto.PrivateKey
+	if h.OneTimeCardID != "" {
+		if oneTime, err = c.Prekeys.LoadPrivateKey(h.OneTimeCardID); err != nil {
+			return nil, errors.Wrap(err, "one-time prekey was not found")
+		}
+	}
+
+	session, err := pfs.StartResponderSession(initiator.PublicKey, ephemeral, c.identityKey.privateKey, longTerm, oneTime,
+		initiator.ID, c.identityCard.ID)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(session.SessionID, msg.SessionID) {
+		return nil, errors.New("session id does not match the handshake")
+	}
+	if err = c.sessions.Store(session); err != nil {
+		return nil, err
+	}
+	if oneTime != nil {
+		if err = c.Prekeys.DeletePrivateKey(h.OneTimeCardID); err != nil {
+			return nil, err
+		}
+	}
+	s := &SecureSession{session: session}
+	c.known[sessionKey(session.SessionID)] = s
+	if _, ok := c.active[initiator.ID]; !ok {
+		c.active[initiator.ID] = s
+	}
+	return s, nil
+}
+
+func (s *SecureSession) ID() Buffer {
+	return s.session.SessionID
+}
+
+func (s *SecureSession) EncryptMessage(message Buffer) (Buffer, error) {
+	s.lock.Lock()
+	handshake := s.handshake
+	s.lock.Unlock()
+
+	salt, ciphertext := s.session.Encrypt(message)
+	return json.Marshal(&SecureMessage{
+		SessionID:  s.session.SessionID,
+		Handshake:  handshake,
+		Salt:       salt,
+		Ciphertext: ciphertext,
+	})
+}
+
+func (s *SecureSession) EncryptString(message string) (Buffer, error) {
+	return s.EncryptMessage(BufferFromString(message))
+}
+
+func (s *SecureSession) DecryptMessage(message Buffer) (Buffer, error) {
+	msg, err := parseSecureMessage(message)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(msg.SessionID, s.session.SessionID) {
+		return nil, errors.Errorf("message belongs to session %s", hex.EncodeToString(msg.SessionID))
+	}
+	plaintext, err := s.session.Decrypt(msg.Salt, msg.Ciphertext)
+	if err != nil {
+		return nil, errors.Wrap(err, "Cannot decrypt message")
+	}
+
+	//the responder has the session once it replies, so the handshake isn't needed anymore
+	s.lock.Lock()
+	s.handshake = nil
+	s.lock.Unlock()
+	return plaintext, nil
+}
+
+func parseSecureMessage(message Buffer) (*SecureMessage, error) {
+	msg := &SecureMessage{}
+	if err := json.Unmarshal(message, msg); err != nil {
+		return nil, errors.Wrap(err, "Cannot parse message")
+	}
+	if len(msg.SessionID) == 0 || len(msg.Salt) == 0 {
+		return nil, errors.New("message is incomplete")
+	}
+	return msg, nil
+}
+
+func sessionKey(sessionID []byte) string {
+	return hex.EncodeToString(sessionID)
+}
+
+func pfsCrypto() (virgilcrypto.PFS, error) {
+	pfs, ok := virgil.Crypto().(virgilcrypto.PFS)
+	if !ok {
+		return nil, errors.New("crypto does not support PFS")
+	}
+	return pfs, nil
+}
@@ -0,0 +1,278 @@
+package virgilapi
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/virgil.v4"
+	"gopkg.in/virgil.v4/errors"
+	"gopkg.in/virgil.v4/transport/endpoints"
+	"gopkg.in/virgil.v4/virgilcrypto"
+)
+
+//fakePFSService serves cards and prekeys from memory
+type fakePFSService struct {
+	cards    map[string]*virgil.CardResponse
+	longTerm map[string]*virgil.CardResponse
+	oneTime  map[string][]*virgil.CardResponse
+}
+
+func newFakePFSService() *fakePFSService {
+	return &fakePFSService{
+		cards:    make(map[string]*virgil.CardResponse),
+		longTerm: make(map[string]*virgil.CardResponse),
+		oneTime:  make(map[string][]*virgil.CardResponse),
+	}
+}
+
+func toCardResponse(req *virgil.SignableRequest) *virgil.CardResponse {
+	return &virgil.CardResponse{
+		ID:       hex.EncodeToString(virgil.Crypto().CalculateFingerprint(req.Snapshot)),
+		Snapshot: req.Snapshot,
+		Meta:     virgil.ResponseMeta{Signatures: req.Meta.Signatures},
+	}
+}
+
+func (s *fakePFSService) Call(endpoint endpoints.Endpoint, payload interface{}, returnObj interface{}, params ...interface{}) error {
+	var res interface{}
+	switch endpoint {
+	case endpoints.GetCard:
+		card, ok := s.cards[params[0].(string)]
+		if !ok {
+			return virgil.ErrNotFound
+		}
+		res = card
+	case endpoints.UploadPrekeys:
+		id := params[0].(string)
+		req := payload.(*virgil.PrekeysRequest)
+		resp := &virgil.PrekeysResponse{LongTermCard: toCardResponse(req.LongTermCard)}
+		for _, r := range req.OneTimeCards {
+			resp.OneTimeCards = append(resp.OneTimeCards, toCardResponse(r))
+		}
+		s.longTerm[id] = resp.LongTermCard
+		s.oneTime[id] = append(s.oneTime[id], resp.OneTimeCards...)
+		res = resp
+	case endpoints.ClaimPrekeys:
+		var bundles []*virgil.PrekeyBundleResponse
+		for _, id := range payload.(*virgil.ClaimPrekeysRequest).IdentityCardIDs {
+			bundle := &virgil.PrekeyBundleResponse{IdentityCard: s.cards[id], LongTermCard: s.longTerm[id]}
+			if len(s.oneTime[id]) > 0 {
+				bundle.OneTimeCard = s.oneTime[id][0]
+				s.oneTime[id] = s.oneTime[id][1:]
+			}
+			bundles = append(bundles, bundle)
+		}
+		res = bundles
+	default:
+		return errors.New("unsupported endpoint")
+	}
+	d, _ := json.Marshal(res)
+	return json.Unmarshal(d, returnObj)
+}
+
+func (s *fakePFSService) SetToken(token string) {}
+
+func newSecureChat(t *testing.T, service *fakePFSService, identity string) *SecureChat {
+	client, err := virgil.NewClient("token", virgil.ClientTransport(service), virgil.ClientCardsValidator(nil))
+	assert.NoError(t, err)
+	dir, err := ioutil.TempDir("", "securechat")
+	assert.NoError(t, err)
+
+	context := &Context{
+		client:        client,
+		storage:       &virgil.FileStorage{RootDir: dir},
+		requestSigner: &virgil.RequestSigner{},
+	}
+	api := &Api{context: context, Cards: &cardManager{context: context}, Keys: &keyManager{context: context}}
+
+	key, err := api.Keys.Generate()
+	assert.NoError(t, err)
+	card, err := api.Cards.Create(identity, key, nil)
+	assert.NoError(t, err)
+	req, err := card.ToRequest()
+	assert.NoError(t, err)
+	service.cards[card.ID] = toCardResponse(req)
+
+	chat, err := api.SecureChat(SecureChatParams{IdentityCard: card, IdentityKey: key})
+	assert.NoError(t, err)
+	return chat
+}
+
+func TestSecureChat(t *testing.T) {
+	service := newFakePFSService()
+	alice := newSecureChat(t, service, "alice")
+	bob := newSecureChat(t, service, "bob")
+	defer os.RemoveAll(alice.context.storage.(*virgil.FileStorage).RootDir)
+	defer os.RemoveAll(bob.context.storage.(*virgil.FileStorage).RootDir)
+
+	_, oneTime, err := bob.Prekeys.Publish(1)
+	assert.NoError(t, err)
+
+	aliceSession, err := alice.StartSession(bob.identityCard)
+	assert.NoError(t, err)
+	same, err := alice.StartSession(bob.identityCard)
+	assert.NoError(t, err)
+	assert.Equal(t, aliceSession, same)
+
+	msg, err := aliceSession.EncryptString("hello bob")
+	assert.NoError(t, err)
+	parsed, err := parseSecureMessage(msg)
+	assert.NoError(t, err)
+	assert.NotNil(t, parsed.Handshake)
+
+	//bob knows nothing about the session before the first message
+	plaintext, err := bob.DecryptMessage(msg)
+	assert.NoError(t, err)
+	assert.Equal(t, "hello bob", plaintext.ToString())
+
+	//one-time prekey is used only once
+	_, err = bob.Prekeys.LoadPrivateKey(oneTime[0].ID)
+	assert.Error(t, err)
+
+	bobSession, err := bob.SessionFromMessage(msg)
+	assert.NoError(t, err)
+	assert.Equal(t, aliceSession.ID(), bobSession.ID())
+
+	reply, err := bobSession.EncryptString("hello alice")
+	assert.NoError(t, err)
+	plaintext, err = aliceSession.DecryptMessage(reply)
+	assert.NoError(t, err)
+	assert.Equal(t, "hello alice", plaintext.ToString())
+
+	//after the reply the handshake isn't sent anymore
+	msg, err = aliceSession.EncryptString("no handshake")
+	assert.NoError(t, err)
+	parsed, err = parseSecureMessage(msg)
+	assert.NoError(t, err)
+	assert.Nil(t, parsed.Handshake)
+	plaintext, err = bob.DecryptMessage(msg)
+	assert.NoError(t, err)
+	assert.Equal(t, "no handshake", plaintext.ToString())
+
+	resumed, err := alice.ResumeSession(aliceSession.ID())
+	assert.NoError(t, err)
+	plaintext, err = resumed.DecryptMessage(reply)
+	assert.NoError(t, err)
+	assert.Equal(t, "hello alice", plaintext.ToString())
+
+	//without one-time prekeys sessions still work
+	carol := newSecureChat(t, service, "carol")
+	defer os.RemoveAll(carol.context.storage.(*virgil.FileStorage).RootDir)
+	carolSession, err := carol.StartSession(bob.identityCard)
+	assert.NoError(t, err)
+	msg, err = carolSession.EncryptString("hello from carol")
+	assert.NoError(t, err)
+	plaintext, err = bob.DecryptMessage(msg)
+	assert.NoError(t, err)
+	assert.Equal(t, "hello from carol", plaintext.ToString())
+
+	_, err = aliceSession.DecryptMessage(msg)
+	assert.Error(t, err)
+
+	//substituted long-term prekey is rejected
+	dave := newSecureChat(t, service, "dave")
+	defer os.RemoveAll(dave.context.storage.(*virgil.FileStorage).RootDir)
+	_, _, err = dave.Prekeys.Publish(0)
+	assert.NoError(t, err)
+	bobLongTerm := service.longTerm[bob.identityCard.ID]
+	service.longTerm[bob.identityCard.ID] = service.longTerm[dave.identityCard.ID]
+	_, err = dave.StartSession(bob.identityCard)
+	assert.IsType(t, &virgilcrypto.InvalidPrekeyError{}, err)
+
+	//substituted one-time prekey is rejected
+	service.longTerm[bob.identityCard.ID] = bobLongTerm
+	_, _, err = dave.Prekeys.Publish(1)
+	assert.NoError(t, err)
+	service.oneTime[bob.identityCard.ID] = service.oneTime[dave.identityCard.ID]
+	_, err = dave.StartSession(bob.identityCard)
+	assert.IsType(t, &virgilcrypto.InvalidPrekeyError{}, errors.Cause(err))
+
+	//unknown session without handshake
+	reply, err = bobSession.EncryptString("lost")
+	assert.NoError(t, err)
+	_, err = carol.DecryptMessage(reply)
+	assert.Equal(t, virgil.ErrorSessionNotFound, err)
+}
+
+func TestSecureChat_DecryptReplyThroughChat_StopsHandshake(t *testing.T) {
+	service := newFakePFSService()
+	alice := newSecureChat(t, service, "alice")
+	bob := newSecureChat(t, service, "bob")
+	defer os.RemoveAll(alice.context.storage.(*virgil.FileStorage).RootDir)
+	defer os.RemoveAll(bob.context.storage.(*virgil.FileStorage).RootDir)
+
+	_, _, err := bob.Prekeys.Publish(1)
+	assert.NoError(t, err)
+
+	aliceSession, err := alice.StartSession(bob.identityCard)
+	assert.NoError(t, err)
+	msg, err := aliceSession.EncryptString("hello bob")
+	assert.NoError(t, err)
+	_, err = bob.DecryptMessage(msg)
+	assert.NoError(t, err)
+
+	bobSession, err := bob.SessionFromMessage(msg)
+	assert.NoError(t, err)
+	reply, err := bobSession.EncryptString("hello alice")
+	assert.NoError(t, err)
+	plaintext, err := alice.DecryptMessage(reply)
+	assert.NoError(t, err)
+	assert.Equal(t, "hello alice", plaintext.ToString())
+
+	session, err := alice.StartSession(bob.identityCard)
+	assert.NoError(t, err)
+	msg, err = session.EncryptString("no handshake")
+	assert.NoError(t, err)
+	parsed, err := parseSecureMessage(msg)
+	assert.NoError(t, err)
+	assert.Nil(t, parsed.Handshake)
+}
+
+func TestSecureChat_SimultaneousStart_KeepsOwnSessions(t *testing.T) {
+	service := newFakePFSService()
+	alice := newSecureChat(t, service, "alice")
+	bob := newSecureChat(t, service, "bob")
+	defer os.RemoveAll(alice.context.storage.(*virgil.FileStorage).RootDir)
+	defer os.RemoveAll(bob.context.storage.(*virgil.FileStorage).RootDir)
+
+	_, _, err := alice.Prekeys.Publish(1)
+	assert.NoError(t, err)
+	_, _, err = bob.Prekeys.Publish(1)
+	assert.NoError(t, err)
+
+	aliceSession, err := alice.StartSession(bob.identityCard)
+	assert.NoError(t, err)
+	bobSession, err := bob.StartSession(alice.identityCard)
+	assert.NoError(t, err)
+	assert.NotEqual(t, aliceSession.ID(), bobSession.ID())
+
+	fromAlice, err := aliceSession.EncryptString("from alice")
+	assert.NoError(t, err)
+	fromBob, err := bobSession.EncryptString("from bob")
+	assert.NoError(t, err)
+
+	plaintext, err := bob.DecryptMessage(fromAlice)
+	assert.NoError(t, err)
+	assert.Equal(t, "from alice", plaintext.ToString())
+	plaintext, err = alice.DecryptMessage(fromBob)
+	assert.NoError(t, err)
+	assert.Equal(t, "from bob", plaintext.ToString())
+
+	//sessions each side started stay active, so messages already sent on them remain valid
+	active, err := alice.StartSession(bob.identityCard)
+	assert.NoError(t, err)
+	assert.True(t, aliceSession == active)
+	active, err = bob.StartSession(alice.identityCard)
+	assert.NoError(t, err)
+	assert.True(t, bobSession == active)
+
+	msg, err := aliceSession.EncryptString("again")
+	assert.NoError(t, err)
+	plaintext, err = bob.DecryptMessage(msg)
+	assert.NoError(t, err)
+	assert.Equal(t, "again", plaintext.ToString())
+}
@@ -51,8 +51,36 @@ var (
 
 	oidPbkdf2 = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 12}
 	oidPbeS2  = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 13}
+	oidScrypt = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 11591, 4, 11}
+	//Argon2id has no registered OID, Virgil Security private arc is used
+	oidArgon2id = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 54811, 1, 1}
+
+	//id-alg-AEADChaCha20Poly1305, RFC 8103
+	oidChaCha20Poly1305 = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 16, 3, 18}
 
 	oidEd25519key = asn1.ObjectIdentifier{1, 3, 101, 112}
+
+	oidEcPublicKey = asn1.ObjectIdentifier{1, 2, 840, 10045, 2, 1}
+	oidSecp256r1   = asn1.ObjectIdentifier{1, 2, 840, 10045, 3, 1, 7}
+	oidSecp384r1   = asn1.ObjectIdentifier{1, 3, 132, 0, 34}
+	oidSecp521r1   = asn1.ObjectIdentifier{1, 3, 132, 0, 35}
+
+	oidRsaEncryption = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 1}
+	oidRsaesOAEP     = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 7}
+	oidMgf1          = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 8}
+	oidSha1          = asn1.ObjectIdentifier{1, 3, 14, 3, 2, 26}
+	oidSha256        = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1}
+	oidSha512        = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 3}
+)
+
+//RFC 5652 SignedData
+var (
+	oidSignedData        = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 2}
+	oidAttrContentType   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 3}
+	oidAttrMessageDigest = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 4}
+	oidAttrSigningTime   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 5}
+	oidEcdsaWithSha384   = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 3}
+	oidRsassaPSS         = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 10}
 )
 
 //ASN.1 structures
@@ -85,7 +113,7 @@ type Envelope struct {
 
 type CustomParam struct {
 	Key   string        `asn1:"utf8"`
-	Value asn1.RawValue `asn1:"tag:2,explicit"`
+	Value asn1.RawValue
 }
 
 type CMSEnvelope struct {
@@ -107,11 +135,62 @@ type envelopedData struct {
 }
 type issuerAndSerial []byte
 
-type publicKeyRecipientInfo struct {
+//keyTransRecipientInfo keeps symmetric key encrypted with recipient's public key. EncryptedKey format depends on the key algorithm
+type keyTransRecipientInfo struct {
 	Version                int
 	RecipientID            issuerAndSerial `asn1:"tag:0,explicit"`
-	KeyEncryptionAlgorithm algorithmIdentifierWithOidParameter
-	EncryptedKey           []byte //serialized EncryptedKeyWithPublicKey
+	KeyEncryptionAlgorithm pkix.AlgorithmIdentifier
+	EncryptedKey           []byte
+}
+
+type rsaesOAEPParams struct {
+	HashAlgorithm    pkix.AlgorithmIdentifier `asn1:"optional,explicit,tag:0"`
+	MaskGenAlgorithm pkix.AlgorithmIdentifier `asn1:"optional,explicit,tag:1"`
+}
+
+type rsassaPSSParams struct {
+	HashAlgorithm    pkix.AlgorithmIdentifier `asn1:"optional,explicit,tag:0"`
+	MaskGenAlgorithm pkix.AlgorithmIdentifier `asn1:"optional,explicit,tag:1"`
+	SaltLength       int                      `asn1:"optional,explicit,tag:2,default:20"`
+	TrailerField     int                      `asn1:"optional,explicit,tag:3,default:1"`
+}
+
+//contentInfo wraps SignedData. Content is the [0] tagged SignedData
+type contentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     asn1.RawValue `asn1:"explicit,tag:0"`
+}
+
+type signedData struct {
+	Version          int
+	DigestAlgorithms []pkix.AlgorithmIdentifier `asn1:"set"`
+	EncapContentInfo encapsulatedContentInfo
+	Certificates     asn1.RawValue `asn1:"optional,tag:0"`
+	CRLs             asn1.RawValue `asn1:"optional,tag:1"`
+	SignerInfos      []signerInfo  `asn1:"set"`
+}
+
+//encapsulatedContentInfo has no EContent if the signature is detached
+type encapsulatedContentInfo struct {
+	EContentType asn1.ObjectIdentifier
+	EContent     []byte `asn1:"explicit,optional,tag:0"`
+}
+
+//signerInfo identifies the signer by subjectKeyIdentifier, which is the ReceiverID of the key.
+//SignedAttrs are kept raw, because the signature covers their original encoding
+type signerInfo struct {
+	Version            int
+	SID                asn1.RawValue
+	DigestAlgorithm    pkix.AlgorithmIdentifier
+	SignedAttrs        asn1.RawValue `asn1:"optional,tag:0"`
+	SignatureAlgorithm pkix.AlgorithmIdentifier
+	Signature          []byte
+	UnsignedAttrs      asn1.RawValue `asn1:"optional,tag:1"`
+}
+
+type attribute struct {
+	Type   asn1.ObjectIdentifier
+	Values asn1.RawValue //SET OF values
 }
 
 type encryptedKeyWithPublicKey struct {
@@ -180,7 +259,8 @@ type validator interface {
 	Validate() error
 }
 
-func makePublicKeyRecipient(id []byte, publicKey []byte, mac []byte, key []byte, keyIv []byte) (*asn1.RawValue, error) {
+//makeECIESKey serializes ECIES result, it's used as encrypted key by ed25519 & NIST curve recipients
+func makeECIESKey(algorithm algorithmIdentifierWithOidParameter, publicKey []byte, mac []byte, key []byte, keyIv []byte) ([]byte, error) {
 
 	encryptedKey := encryptedData{
 		CipherParams: algorithmIdentifier{
@@ -205,7 +285,7 @@ func makePublicKeyRecipient(id []byte, publicKey []byte, mac []byte, key []byte,
 	}
 
 	pk := publicKeyDescription{
-		Algorithm: ed25519Algo,
+		Algorithm: algorithm,
 		PublicKey: asn1.BitString{Bytes: publicKey},
 	}
 
@@ -220,12 +300,29 @@ func makePublicKeyRecipient(id []byte, publicKey []byte, mac []byte, key []byte,
 	if err != nil {
 		return nil, cryptoError(err, "")
 	}
+	return contentBytes, nil
+}
+
+func decodeECIESKey(data []byte) (*encryptedKeyWithPublicKey, error) {
+	encryptedKey := &encryptedKeyWithPublicKey{}
+	_, err := asn1.Unmarshal(data, encryptedKey)
+	if err != nil {
+		return nil, cryptoError(err, "")
+	}
+
+	if err = encryptedKey.Validate(); err != nil {
+		return nil, err
+	}
+	return encryptedKey, nil
+}
 
-	recipient := publicKeyRecipientInfo{
+func makePublicKeyRecipient(id []byte, algorithm pkix.AlgorithmIdentifier, encryptedKey []byte) (*asn1.RawValue, error) {
+
+	recipient := keyTransRecipientInfo{
 		Version:                2,
 		RecipientID:            []byte(id),
-		KeyEncryptionAlgorithm: ed25519Algo,
-		EncryptedKey:           contentBytes,
+		KeyEncryptionAlgorithm: algorithm,
+		EncryptedKey:           encryptedKey,
 	}
 
 	raw, err := asn1.Marshal(recipient)
@@ -238,9 +335,9 @@ func makePublicKeyRecipient(id []byte, publicKey []byte, mac []byte, key []byte,
 	}, nil
 
 }
-func makePasswordRecipient(kdfIv []byte, iterations int, key, keyIv []byte) (*asn1.RawValue, error) {
+func makePasswordRecipient(keyDerivationFunc pkix.AlgorithmIdentifier, encryptionScheme algorithmIdentifier, key []byte) (*asn1.RawValue, error) {
 
-	keyEncryptionAlgorithm, err := encodeKeyEncryptionAlgorithm(kdfIv, iterations, keyIv)
+	keyEncryptionAlgorithm, err := encodeKeyEncryptionAlgorithm(keyDerivationFunc, encryptionScheme)
 
 	if err != nil {
 		return nil, err
@@ -283,12 +380,12 @@ func decodeSignature(signatureBytes []byte) ([]byte, error) {
 	}
 	return signature.S, nil
 }
-func composeCMSMessage(nonce []byte, recipients []*asn1.RawValue, customParams map[string]interface{}) (resBytes []byte, err error) {
+func composeCMSMessage(content ContentCipher, nonce []byte, recipients []*asn1.RawValue, customParams map[string]interface{}) (resBytes []byte, err error) {
 
 	ciphertextInfo := encryptedContentInfo{
 		ContentType: oidData,
 		ContentEncryptionAlgorithm: algorithmIdentifier{
-			Algorithm:  oidAesGCM,
+			Algorithm:  content.OID(),
 			Parameters: nonce,
 		},
 	}
@@ -344,6 +441,26 @@ func composeCMSMessage(nonce []byte, recipients []*asn1.RawValue, customParams m
 	}
 	return resBytes, nil
 }
+//appendCMSCustomParams adds custom params to the envelope of the message, the rest of the message is kept as is
+func appendCMSCustomParams(data []byte, customParams map[string]interface{}) ([]byte, error) {
+	envelope := &Envelope{}
+	ciphertext, err := asn1.Unmarshal(data, envelope)
+	if err != nil {
+		return nil, cryptoError(err, "")
+	}
+	for k, v := range customParams {
+		param, err := makeParam(k, v)
+		if err != nil {
+			return nil, err
+		}
+		envelope.CustomParams = append(envelope.CustomParams, param)
+	}
+	res, err := asn1.Marshal(*envelope)
+	if err != nil {
+		return nil, cryptoError(err, "")
+	}
+	return append(res, ciphertext...), nil
+}
 func makeParam(key string, v interface{}) (CustomParam, error) {
 	asnValue, err := asn1.Marshal(v)
 	if err != nil {
@@ -366,7 +483,7 @@ func makeParam(key string, v interface{}) (CustomParam, error) {
 	return param, nil
 
 }
-func decodeCMSMessage(data []byte) (customParams map[string]interface{}, ciphertext, nonce []byte, recipients []recipient, err error) {
+func decodeCMSMessage(data []byte) (customParams map[string]interface{}, ciphertext []byte, contentCipher ContentCipher, nonce []byte, recipients []recipient, err error) {
 
 	envelope := &Envelope{}
 	if ciphertext, err = asn1.Unmarshal(data, envelope); err != nil {
@@ -387,7 +504,11 @@ func decodeCMSMessage(data []byte) (customParams map[string]interface{}, ciphert
 		return
 	}
 
-	nonce = content.EncryptedContentInfo.ContentEncryptionAlgorithm.Parameters
+	algorithm := content.EncryptedContentInfo.ContentEncryptionAlgorithm
+	if contentCipher, err = findContentCipher(algorithm.Algorithm); err != nil {
+		return
+	}
+	nonce = algorithm.Parameters
 
 	if len(envelope.CustomParams) > 0 {
 		customParams = make(map[string]interface{})
@@ -477,34 +598,19 @@ func decodeRecipients(value *asn1.RawValue) (models []recipient, err error) {
 	return models, nil
 }
 func decodeKeyRecipient(value *asn1.RawValue) (recipient, error) {
-	recipient := &publicKeyRecipientInfo{}
-	_, err := asn1.Unmarshal(value.FullBytes, recipient)
-	if err != nil {
-		return nil, cryptoError(err, "")
-	}
-	if err = recipient.Validate(); err != nil {
-		return nil, err
-	}
-
-	encryptedKey := &encryptedKeyWithPublicKey{}
-	_, err = asn1.Unmarshal(recipient.EncryptedKey, encryptedKey)
-
+	info := &keyTransRecipientInfo{}
+	_, err := asn1.Unmarshal(value.FullBytes, info)
 	if err != nil {
 		return nil, cryptoError(err, "")
 	}
-
-	if err = encryptedKey.Validate(); err != nil {
+	if err = info.Validate(); err != nil {
 		return nil, err
 	}
 
-	publicKey := encryptedKey.PublicKey.PublicKey.Bytes
-
 	return &publicKeyRecipient{
-		ID:           recipient.RecipientID,
-		encryptedKey: encryptedKey.EncryptedData.Value,
-		tag:          encryptedKey.Hmac.Value,
-		iv:           encryptedKey.EncryptedData.CipherParams.Parameters,
-		PublicKey:    publicKey,
+		ID:           info.RecipientID,
+		algorithm:    info.KeyEncryptionAlgorithm,
+		encryptedKey: info.EncryptedKey,
 	}, nil
 }
 func decodePasswordRecipient(value *asn1.RawValue) (recipient, error) {
@@ -519,43 +625,21 @@ func decodePasswordRecipient(value *asn1.RawValue) (recipient, error) {
 
 	algo := recipient.KeyEncryptionAlgorithm
 
-	keyIv, kdfIv, iterations, err := decodeKeyEncryptionAlgorithm(&algo)
+	encryptionScheme, keyDerivationFunc, err := decodeKeyEncryptionAlgorithm(&algo)
 	if err != nil {
 		return nil, err
 	}
 	return &passwordRecipient{
-		encryptedKey: recipient.EncryptedKey,
-		keyIv:        keyIv,
-		kdfIv:        kdfIv,
-		iterations:   iterations,
+		encryptedKey:      recipient.EncryptedKey,
+		encryptionScheme:  encryptionScheme,
+		keyDerivationFunc: keyDerivationFunc,
 	}, nil
 }
 
-func encodeKeyEncryptionAlgorithm(kdfIv []byte, iterations int, keyIv []byte) (*pkix.AlgorithmIdentifier, error) {
-	keyDerivationParameters := pkdf2Params{Salt: kdfIv,
-		IterationsCount: iterations,
-		Prf:             algorithmIdentifier{Algorithm: oidHmacWithSha384},
-	}
-
-	serializedKeyDerivationParameters, err := asn1.Marshal(keyDerivationParameters)
-
-	if err != nil {
-		return nil, cryptoError(err, "")
-	}
-
-	keyDerivationFunc := pkix.AlgorithmIdentifier{
-		Algorithm:  oidPbkdf2,
-		Parameters: asn1.RawValue{FullBytes: serializedKeyDerivationParameters},
-	}
-
-	scheme := algorithmIdentifier{
-		Algorithm:  oidAES256CBC,
-		Parameters: keyIv,
-	}
-
+func encodeKeyEncryptionAlgorithm(keyDerivationFunc pkix.AlgorithmIdentifier, encryptionScheme algorithmIdentifier) (*pkix.AlgorithmIdentifier, error) {
 	keyEncryptionParameters := pbeS2Parameters{
 		KeyDerivationFunc: keyDerivationFunc,
-		EncryptionScheme:  scheme,
+		EncryptionScheme:  encryptionScheme,
 	}
 
 	serializedKeyEncryptionParameters, err := asn1.Marshal(keyEncryptionParameters)
@@ -568,7 +652,7 @@ func encodeKeyEncryptionAlgorithm(kdfIv []byte, iterations int, keyIv []byte) (*
 	}, nil
 }
 
-func decodeKeyEncryptionAlgorithm(alg *pkix.AlgorithmIdentifier) (keyIv, kdfIv []byte, iterations int, err error) {
+func decodeKeyEncryptionAlgorithm(alg *pkix.AlgorithmIdentifier) (encryptionScheme algorithmIdentifier, keyDerivationFunc pkix.AlgorithmIdentifier, err error) {
 	keyParams := &pbeS2Parameters{}
 
 	algo := *alg
@@ -582,21 +666,8 @@ func decodeKeyEncryptionAlgorithm(alg *pkix.AlgorithmIdentifier) (keyIv, kdfIv [
 		return
 	}
 
-	keyIv = keyParams.EncryptionScheme.Parameters
-
-	kdfParams := &pkdf2Params{}
-
-	_, err = asn1.Unmarshal(keyParams.KeyDerivationFunc.Parameters.FullBytes, kdfParams)
-	if err != nil {
-		err = cryptoError(err, "")
-		return
-	}
-
-	if err = kdfParams.Validate(); err != nil {
-		return
-	}
-	kdfIv = kdfParams.Salt
-	iterations = kdfParams.IterationsCount
+	encryptionScheme = keyParams.EncryptionScheme
+	keyDerivationFunc = keyParams.KeyDerivationFunc
 	return
 }
 
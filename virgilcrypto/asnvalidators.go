@@ -35,6 +35,11 @@ STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING
 IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
 POSSIBILITY OF SUCH DAMAGE.
 */
+import (
+	"crypto"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+)
 
 func unsupported(msg string) error {
 	return CryptoError("Unsupported " + msg)
@@ -79,8 +84,8 @@ func (content *envelopedData) Validate() error {
 
 	}
 
-	if !info.ContentEncryptionAlgorithm.Algorithm.Equal(oidAesGCM) {
-		return unsupported("encryption algorithm")
+	if _, err := findContentCipher(info.ContentEncryptionAlgorithm.Algorithm); err != nil {
+		return err
 	}
 
 	if len(info.ContentEncryptionAlgorithm.Parameters) != 12 {
@@ -89,23 +94,44 @@ func (content *envelopedData) Validate() error {
 
 	return nil
 }
-func (info *publicKeyRecipientInfo) Validate() error {
+func (info *keyTransRecipientInfo) Validate() error {
 	if info.Version != 2 {
-		return unsupported("public key recipient version")
+		return unsupported("key transport recipient version")
 	}
 
 	if len(info.RecipientID) == 0 {
 		return unsupported("empty recipient id for public key")
 	}
 
-	if !info.KeyEncryptionAlgorithm.Algorithm.Equal(oidEd25519key) {
-		return unsupported("key encryption algorithm")
+	if len(info.EncryptedKey) == 0 {
+		return unsupported("encrypted key data length")
 	}
 
-	if len(info.EncryptedKey) != 226 {
-		return unsupported("encrypted key data length")
+	return nil
+}
+func (p *rsaesOAEPParams) Validate() error {
+	hash, err := hashByOid(p.HashAlgorithm.Algorithm)
+	if err != nil {
+		return err
 	}
 
+	mgfHash := crypto.SHA1
+	if len(p.MaskGenAlgorithm.Algorithm) > 0 {
+		if !p.MaskGenAlgorithm.Algorithm.Equal(oidMgf1) {
+			return unsupported("mask generation function")
+		}
+		mgfHashAlgo := &pkix.AlgorithmIdentifier{}
+		if _, err = asn1.Unmarshal(p.MaskGenAlgorithm.Parameters.FullBytes, mgfHashAlgo); err != nil {
+			return cryptoError(err, "")
+		}
+		if mgfHash, err = hashByOid(mgfHashAlgo.Algorithm); err != nil {
+			return err
+		}
+	}
+
+	if hash != mgfHash {
+		return unsupported("OAEP hash and MGF1 hash mismatch")
+	}
 	return nil
 }
 func (key *encryptedKeyWithPublicKey) Validate() error {
@@ -114,12 +140,18 @@ func (key *encryptedKeyWithPublicKey) Validate() error {
 	}
 
 	algo := key.PublicKey.Algorithm
-	if !algo.Algorithm.Equal(oidEd25519key) {
+	switch {
+	case algo.Algorithm.Equal(oidEd25519key):
+		if key.PublicKey.PublicKey.BitLength != 256 {
+			return unsupported("public key size")
+		}
+	case algo.Algorithm.Equal(oidEcPublicKey):
+		if _, err := curveByOid(algo.Parameters); err != nil {
+			return err
+		}
+	default:
 		return unsupported("key encryption algorithm")
 	}
-	if key.PublicKey.PublicKey.BitLength != 256 {
-		return unsupported("public key size")
-	}
 
 	kdf := key.KdfAlgo
 
@@ -158,10 +190,6 @@ func (info *passwordRecipientInfo) Validate() error {
 		return unsupported("key encryption scheme")
 	}
 
-	if len(info.KeyEncryptionAlgorithm.Parameters.FullBytes) != 82 {
-		return unsupported("key encryption parameters size")
-	}
-
 	return nil
 }
 func (p *pbeS2Parameters) Validate() error {
@@ -169,37 +197,79 @@ func (p *pbeS2Parameters) Validate() error {
 	scheme := p.EncryptionScheme
 	kdf := p.KeyDerivationFunc
 
-	if !scheme.Algorithm.Equal(oidAES256CBC) {
+	switch {
+	case scheme.Algorithm.Equal(oidAesGCM):
+		if len(scheme.Parameters) != 12 {
+			return unsupported("nonce size")
+		}
+	case scheme.Algorithm.Equal(oidAES256CBC):
+		if len(scheme.Parameters) != 16 {
+			return unsupported("IV size")
+		}
+	default:
 		return unsupported("key encryption algorighm")
 	}
 
-	if len(scheme.Parameters) != 16 {
-		return unsupported("IV size")
-	}
-
-	if !kdf.Algorithm.Equal(oidPbkdf2) {
+	if !kdf.Algorithm.Equal(oidPbkdf2) && !kdf.Algorithm.Equal(oidScrypt) && !kdf.Algorithm.Equal(oidArgon2id) {
 		return unsupported("kdf algorithm")
 	}
-	if len(kdf.Parameters.FullBytes) != 36 {
-		return unsupported("kdf parameters size")
-	}
 
 	return nil
 }
 func (p *pkdf2Params) Validate() error {
 
-	if p.IterationsCount < 3072 || p.IterationsCount > 8192 {
+	if p.IterationsCount < minPbkdf2Rounds || p.IterationsCount > maxPbkdf2Rounds {
 		return unsupported("iterations count")
 	}
 	if !p.Prf.Algorithm.Equal(oidHmacWithSha384) {
 		return unsupported("prf algorithm")
 	}
-	if len(p.Salt) != 16 {
+	if len(p.Salt) != kdfSaltSize {
 		return unsupported("prf kdf salt size")
 	}
 
 	return nil
 }
+func (p *argon2idParams) Validate() error {
+	if p.Iterations < 1 || p.Iterations > maxArgon2Time {
+		return unsupported("argon2 iterations count")
+	}
+	if p.Parallelism < 1 || p.Parallelism > 255 {
+		return unsupported("argon2 parallelism")
+	}
+	if p.Memory < 8*p.Parallelism || p.Memory > maxArgon2Memory {
+		return unsupported("argon2 memory size")
+	}
+	if int64(p.Memory)*int64(p.Iterations) > maxArgon2Work {
+		return unsupported("argon2 memory and iterations count")
+	}
+	if len(p.Salt) < 8 {
+		return unsupported("kdf salt size")
+	}
+	return nil
+}
+func (p *scryptParams) Validate() error {
+	n := p.CostParameter
+	if n < 2 || n > maxScryptN || n&(n-1) != 0 {
+		return unsupported("scrypt cost parameter")
+	}
+	if p.BlockSize < 1 || p.ParallelizationParameter < 1 || p.BlockSize*p.ParallelizationParameter > maxScryptRP {
+		return unsupported("scrypt block size or parallelization parameter")
+	}
+	if 128*int64(n)*int64(p.BlockSize) > maxScryptMemory {
+		return unsupported("scrypt memory size")
+	}
+	if int64(n)*int64(p.BlockSize)*int64(p.ParallelizationParameter) > maxScryptWork {
+		return unsupported("scrypt cost")
+	}
+	if p.KeyLength < 0 || p.KeyLength > maxKdfKeyLength {
+		return unsupported("kdf key length")
+	}
+	if len(p.Salt) < 8 {
+		return unsupported("kdf salt size")
+	}
+	return nil
+}
 func (k *publicKey) Validate() error {
 	if !(k.Algorithm.Algorithm.Equal(oidEd25519key)) {
 		return unsupported("public key type")
@@ -217,3 +287,72 @@ func (k *privateKeyAsn) Validate() error {
 	}
 	return nil
 }
+func (m *RatchetMessage) Validate() error {
+	if m == nil {
+		return CryptoError("message is empty")
+	}
+	if len(m.PublicKey) != ratchetKeySize {
+		return unsupported("ratchet key size")
+	}
+	if m.Counter < 0 || m.PreviousCounter < 0 {
+		return unsupported("message counter")
+	}
+	return nil
+}
+func (s *ratchetState) Validate() error {
+	if s.Version != 1 {
+		return unsupported("session version")
+	}
+	if len(s.RootKey) != ratchetKeySize || len(s.DHPrivate) != ratchetKeySize {
+		return unsupported("session key size")
+	}
+	if len(s.RemotePublic) != 0 && len(s.RemotePublic) != ratchetKeySize {
+		return unsupported("ratchet key size")
+	}
+	if s.SendCounter < 0 || s.ReceiveCounter < 0 || s.PreviousCounter < 0 || len(s.Skipped) > maxSkippedKeys {
+		return unsupported("session counters")
+	}
+	return nil
+}
+func (s *pfsSessionASN1) Validate() error {
+	if s.Version != pfsSessionVersion {
+		return unsupported("session version")
+	}
+	if len(s.SK) == 0 || len(s.AD) == 0 || len(s.SessionID) == 0 {
+		return CryptoError("session is empty")
+	}
+	return nil
+}
+
+func (ci *contentInfo) Validate() error {
+	if !ci.ContentType.Equal(oidSignedData) {
+		return unsupported("content type")
+	}
+	return nil
+}
+
+func (sd *signedData) Validate() error {
+	if sd.Version != 1 && sd.Version != 3 {
+		return unsupported("signed data version")
+	}
+	if len(sd.SignerInfos) == 0 {
+		return CryptoError("signed data has no signers")
+	}
+	for i := range sd.SignerInfos {
+		if err := sd.SignerInfos[i].Validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (si *signerInfo) Validate() error {
+	if si.Version != 1 && si.Version != 3 {
+		return unsupported("signer info version")
+	}
+	//message digest and content type are only bound to the signature by signed attributes
+	if len(si.SignedAttrs.Bytes) == 0 {
+		return unsupported("signer info without signed attributes")
+	}
+	return nil
+}
@@ -1,8 +1,8 @@
 package virgilcrypto
 
 import (
-	"crypto/aes"
 	"crypto/cipher"
+	"encoding/binary"
 	"io"
 
 	"gopkg.in/virgil.v4/virgilcrypto/gcm"
@@ -13,12 +13,30 @@ type VirgilChunkCipher interface {
 	Decrypt(key, nonce, ad []byte, chunkSize int, in io.Reader, out io.Writer) error
 }
 
+//ContentChunkCipher is a chunk cipher which can encrypt chunks with any ContentCipher, not only AES-GCM
+type ContentChunkCipher interface {
+	VirgilChunkCipher
+	WithContentCipher(content ContentCipher) VirgilChunkCipher
+}
+
 var DefaultChunkSize = 1024 * 1024
 
+//aesGCMChunkStreamCipher is the legacy (v1) framing. It has no last chunk marker, so it is used only to decrypt old streams
 type aesGCMChunkStreamCipher struct{}
 
+//framedChunkCipher (v2) follows the STREAM construction: chunk nonce is the stream nonce XOR (counter || last chunk flag),
+//so reordered, dropped or truncated chunks fail authentication. An empty plaintext is encrypted as a single empty last chunk.
+//Chunks are encrypted with AES-GCM unless another content cipher is set
+type framedChunkCipher struct {
+	content ContentCipher
+}
+
 const (
 	gcmTagSize = 16
+
+	chunkFramingKey     = "VIRGIL-STREAM-CHUNK-FRAMING"
+	chunkFramingVersion = 2
+	framedNonceFlag     = 0x80
 )
 
 func (c *aesGCMChunkStreamCipher) Encrypt(key, nonce, ad []byte, chunkSize int, in io.Reader, out io.Writer) error {
@@ -27,64 +45,201 @@ func (c *aesGCMChunkStreamCipher) Encrypt(key, nonce, ad []byte, chunkSize int,
 		return CryptoError("chunk size too small")
 	}
 
+	aesGCM, err := newChunkAEAD(AESGCM, key, nonce)
+	if err != nil {
+		return err
+	}
+
 	buf := make([]byte, chunkSize+gcmTagSize)
 
 	var counter = make([]byte, len(nonce))
 	var chunkNonce = make([]byte, len(nonce))
 
-	n, err := in.Read(buf[:chunkSize])
+	n, err := readChunk(in, buf[:chunkSize])
 	for n > 0 && err == nil {
 		gcm.XorBytes(chunkNonce, nonce, counter)
-		ciph, _ := aes.NewCipher(key)
-		aesGCM, _ := cipher.NewGCM(ciph)
 
 		res := aesGCM.Seal(buf[:0], chunkNonce, buf[:n], ad)
 
-		written, err := out.Write(res)
-		if written != len(res) || err != nil {
-			return CryptoError("Could not write to output buffer")
+		if err = writeChunk(out, res); err != nil {
+			return err
 		}
 
 		increment(counter)
-		n, err = in.Read(buf[:chunkSize])
+		n, err = readChunk(in, buf[:chunkSize])
 	}
 
-	if err != nil && err != io.EOF {
-		return err
-	}
-	return nil
+	return err
 }
 func (c *aesGCMChunkStreamCipher) Decrypt(key, nonce, ad []byte, chunkSize int, in io.Reader, out io.Writer) error {
 	if chunkSize < 1 {
 		return CryptoError("chunk size too small")
 	}
 
+	aesGCM, err := newChunkAEAD(AESGCM, key, nonce)
+	if err != nil {
+		return err
+	}
+
 	buf := make([]byte, chunkSize+gcmTagSize)
 
 	var counter = make([]byte, len(nonce))
 	var chunkNonce = make([]byte, len(nonce))
 
-	n, err := in.Read(buf)
+	n, err := readChunk(in, buf)
 	for n > 0 && err == nil {
 		gcm.XorBytes(chunkNonce, nonce, counter)
-		ciph, _ := aes.NewCipher(key)
-		aesGCM, _ := cipher.NewGCM(ciph)
 
-		res, err := aesGCM.Open(buf[:0], chunkNonce, buf[:n], ad)
-		if err != nil {
+		var res []byte
+		if res, err = aesGCM.Open(buf[:0], chunkNonce, buf[:n], ad); err != nil {
 			return err
 		}
-		written, err := out.Write(res)
-		if written != len(res) || err != nil {
-			return CryptoError("Could not write to output buffer")
+		if err = writeChunk(out, res); err != nil {
+			return err
 		}
 		increment(counter)
-		n, err = in.Read(buf)
+		n, err = readChunk(in, buf)
+	}
+
+	return err
+}
+
+func (c *framedChunkCipher) WithContentCipher(content ContentCipher) VirgilChunkCipher {
+	return &framedChunkCipher{content: content}
+}
+
+func (c *framedChunkCipher) Encrypt(key, nonce, ad []byte, chunkSize int, in io.Reader, out io.Writer) error {
+	if chunkSize < 1 {
+		return CryptoError("chunk size too small")
+	}
+	aead, err := newChunkAEAD(orAESGCM(c.content), key, nonce)
+	if err != nil {
+		return err
 	}
 
-	if err != nil && err != io.EOF {
+	buf := make([]byte, chunkSize+gcmTagSize)
+	next := make([]byte, chunkSize+gcmTagSize)
+	chunkNonce := make([]byte, len(nonce))
+
+	n, err := readChunk(in, buf[:chunkSize])
+	if err != nil {
 		return err
 	}
+	for counter := uint64(0); ; counter++ {
+		//the chunk is the last one if the next read returns nothing
+		m := 0
+		if n == chunkSize {
+			if m, err = readChunk(in, next[:chunkSize]); err != nil {
+				return err
+			}
+		}
+		last := m == 0
+
+		framedChunkNonce(chunkNonce, nonce, counter, last)
+		if err = writeChunk(out, aead.Seal(buf[:0], chunkNonce, buf[:n], ad)); err != nil {
+			return err
+		}
+		if last {
+			return nil
+		}
+		buf, next, n = next, buf, m
+	}
+}
+
+func (c *framedChunkCipher) Decrypt(key, nonce, ad []byte, chunkSize int, in io.Reader, out io.Writer) error {
+	if chunkSize < 1 {
+		return CryptoError("chunk size too small")
+	}
+	aead, err := newChunkAEAD(orAESGCM(c.content), key, nonce)
+	if err != nil {
+		return err
+	}
+
+	size := chunkSize + gcmTagSize
+	buf := make([]byte, size)
+	next := make([]byte, size)
+	chunkNonce := make([]byte, len(nonce))
+
+	n, err := readChunk(in, buf)
+	if err != nil {
+		return err
+	}
+	for counter := uint64(0); ; counter++ {
+		if n < gcmTagSize {
+			return CryptoError("stream is truncated")
+		}
+		m := 0
+		if n == size {
+			if m, err = readChunk(in, next); err != nil {
+				return err
+			}
+		}
+		last := m == 0
+
+		framedChunkNonce(chunkNonce, nonce, counter, last)
+		res, err := aead.Open(buf[:0], chunkNonce, buf[:n], ad)
+		if err != nil {
+			return CryptoError("chunk authentication failed, the stream is corrupted or truncated")
+		}
+		if err = writeChunk(out, res); err != nil {
+			return err
+		}
+		if last {
+			return nil
+		}
+		buf, next, n = next, buf, m
+	}
+}
+
+func newChunkAEAD(content ContentCipher, key, nonce []byte) (cipher.AEAD, error) {
+	aead, err := content.NewAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(nonce) != aead.NonceSize() {
+		return nil, CryptoError("invalid nonce size")
+	}
+	//chunk boundaries depend on the tag size
+	if aead.Overhead() != gcmTagSize {
+		return nil, unsupported("content cipher tag size")
+	}
+	return aead, nil
+}
+
+//framedChunkNonce XORs the nonce with the framing flag byte, then 8 byte big endian counter followed by the last chunk flag byte.
+//The framing flag keeps v2 nonces apart from v1 ones, which only use the last 8 bytes, so a v2 stream passed off as a legacy one
+//by removing the framing param fails authentication
+func framedChunkNonce(dst, nonce []byte, counter uint64, last bool) {
+	block := make([]byte, len(nonce))
+	block[0] = framedNonceFlag
+	binary.BigEndian.PutUint64(block[len(block)-9:], counter)
+	if last {
+		block[len(block)-1] = 1
+	}
+	gcm.XorBytes(dst, nonce, block)
+}
+
+//legacyChunkNonce is the nonce of the v1 chunk, which is XORed with the big endian chunk counter
+func legacyChunkNonce(dst, nonce []byte, counter uint64) {
+	block := make([]byte, len(nonce))
+	binary.BigEndian.PutUint64(block[len(block)-8:], counter)
+	gcm.XorBytes(dst, nonce, block)
+}
+
+//readChunk fills p unless the stream is over, so chunk boundaries do not depend on how the source splits the data
+func readChunk(in io.Reader, p []byte) (int, error) {
+	n, err := io.ReadFull(in, p)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		err = nil
+	}
+	return n, err
+}
+
+func writeChunk(out io.Writer, chunk []byte) error {
+	written, err := out.Write(chunk)
+	if written != len(chunk) || err != nil {
+		return CryptoError("Could not write to output buffer")
+	}
 	return nil
 }
 
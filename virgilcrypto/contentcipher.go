@@ -0,0 +1,79 @@
+package virgilcrypto
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/asn1"
+
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+//ContentCipher is the AEAD which encrypts the data itself. It is identified by its OID in the encryptedContentInfo,
+//so decryption picks the right one from the envelope. Keys are 256 bit and nonces are 96 bit for all content ciphers
+type ContentCipher interface {
+	OID() asn1.ObjectIdentifier
+	NewAEAD(key []byte) (cipher.AEAD, error)
+}
+
+var (
+	//AESGCM is AES-256-GCM, the default content cipher
+	AESGCM ContentCipher = &aesGCMContentCipher{}
+	//ChaCha20Poly1305 (RFC 8103) is faster than AES-GCM on CPUs without AES instructions.
+	//XChaCha20 is not needed here as every message is encrypted with its own random key
+	ChaCha20Poly1305 ContentCipher = &chaCha20Poly1305ContentCipher{}
+)
+
+var contentCiphers = []ContentCipher{AESGCM, ChaCha20Poly1305}
+
+type aesGCMContentCipher struct{}
+
+func (c *aesGCMContentCipher) OID() asn1.ObjectIdentifier {
+	return oidAesGCM
+}
+
+func (c *aesGCMContentCipher) NewAEAD(key []byte) (cipher.AEAD, error) {
+	ciph, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, cryptoError(err, "")
+	}
+	aesGCM, err := cipher.NewGCM(ciph)
+	if err != nil {
+		return nil, cryptoError(err, "")
+	}
+	return aesGCM, nil
+}
+
+type chaCha20Poly1305ContentCipher struct{}
+
+func (c *chaCha20Poly1305ContentCipher) OID() asn1.ObjectIdentifier {
+	return oidChaCha20Poly1305
+}
+
+func (c *chaCha20Poly1305ContentCipher) NewAEAD(key []byte) (cipher.AEAD, error) {
+	aead, err := chacha20poly1305.New(key)
+	if err != nil {
+		return nil, cryptoError(err, "")
+	}
+	return aead, nil
+}
+
+func findContentCipher(oid asn1.ObjectIdentifier) (ContentCipher, error) {
+	for _, c := range contentCiphers {
+		if c.OID().Equal(oid) {
+			return c, nil
+		}
+	}
+	return nil, unsupported("encryption algorithm")
+}
+
+//orAESGCM returns AES-GCM if no content cipher is set
+func orAESGCM(c ContentCipher) ContentCipher {
+	if c == nil {
+		return AESGCM
+	}
+	return c
+}
+
+func isAESGCM(c ContentCipher) bool {
+	return c.OID().Equal(oidAesGCM)
+}
@@ -36,6 +36,7 @@ IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
 POSSIBILITY OF SUCH DAMAGE.
 */
 import (
+	"crypto/elliptic"
 	"io"
 
 	"github.com/minio/sha256-simd"
@@ -47,6 +48,8 @@ import (
 type (
 	Crypto interface {
 		SetKeyType(keyType KeyType) error
+		//SetContentCipher selects the algorithm which encrypts the data, AES-GCM is used if nil
+		SetContentCipher(content ContentCipher)
 		GenerateKeypair() (Keypair, error)
 		ImportPrivateKey(data []byte, password string) (PrivateKey, error)
 		ImportPublicKey(data []byte) (PublicKey, error)
@@ -56,10 +59,22 @@ type (
 		EncryptStream(in io.Reader, out io.Writer, recipients ...PublicKey) error
 		Decrypt(data []byte, key PrivateKey) ([]byte, error)
 		DecryptStream(in io.Reader, out io.Writer, key PrivateKey) error
+		EncryptStreamWithPassword(in io.Reader, out io.Writer, password string) error
+		DecryptStreamWithPassword(in io.Reader, out io.Writer, password string) error
+		//OpenSeekable returns a reader with random access to the stream encrypted by EncryptStream
+		OpenSeekable(ciphertext io.ReaderAt, size int64, key PrivateKey) (*SeekableReader, error)
 		DecryptThenVerify(data []byte, privateKeyForDecryption PrivateKey, verifierKey ...PublicKey) ([]byte, error)
+		//DecryptThenVerifyWithPolicy returns the verifier keys which have a valid signature of the message
+		DecryptThenVerifyWithPolicy(data []byte, privateKeyForDecryption PrivateKey, policy SignaturePolicy, verifierKey ...PublicKey) ([]byte, []PublicKey, error)
 		Sign(data []byte, signer PrivateKey) ([]byte, error)
 		SignStream(in io.Reader, signer PrivateKey) ([]byte, error)
 		SignThenEncrypt(data []byte, signerKey PrivateKey, recipients ...PublicKey) ([]byte, error)
+		SignThenEncryptMultiple(data []byte, signerKeys []PrivateKey, recipients ...PublicKey) ([]byte, error)
+		//Countersign adds the signature of signerKey to the message, the decryption key must belong to one of its recipients
+		Countersign(data []byte, privateKeyForDecryption PrivateKey, signerKey PrivateKey) ([]byte, error)
+		SignThenEncryptStream(in io.Reader, out io.Writer, signerKey PrivateKey, recipients ...PublicKey) error
+		//DecryptThenVerifyStream writes data to out before the signature is checked, the output must be discarded on error
+		DecryptThenVerifyStream(in io.Reader, out io.Writer, privateKeyForDecryption PrivateKey, verifierKey ...PublicKey) error
 		//Verify must return non nil error if the result is false
 		Verify(data []byte, signature []byte, key PublicKey) (bool, error)
 		VerifyStream(in io.Reader, signature []byte, key PublicKey) (bool, error)
@@ -68,21 +83,63 @@ type (
 	}
 
 	VirgilCrypto struct {
-		Cipher func() Cipher
+		Cipher        func() Cipher
+		keyType       KeyType
+		contentCipher ContentCipher
 	}
 )
 
 var DefaultCrypto Crypto
 
 func (c *VirgilCrypto) SetKeyType(keyType KeyType) error {
-	if keyType != keytypes.Default && keyType != keytypes.FAST_EC_ED25519 {
-		return errors.New("Only ED25519 keys are supported")
+	switch keyType {
+	case keytypes.Default,
+		keytypes.FAST_EC_ED25519,
+		keytypes.EC_SECP256R1,
+		keytypes.EC_SECP384R1,
+		keytypes.EC_SECP521R1,
+		keytypes.RSA_2048,
+		keytypes.RSA_3072,
+		keytypes.RSA_4096,
+		keytypes.RSA_8192:
+		c.keyType = keyType
+		return nil
 	}
-	return nil
+	return errors.New("Unsupported key type")
+}
+
+func (c *VirgilCrypto) SetContentCipher(content ContentCipher) {
+	c.contentCipher = content
+}
+
+//newCipher returns a cipher for encryption with the selected content cipher
+func (c *VirgilCrypto) newCipher() Cipher {
+	cipher := c.Cipher()
+	if c.contentCipher != nil {
+		cipher.SetContentCipher(c.contentCipher)
+	}
+	return cipher
 }
 
 func (c *VirgilCrypto) GenerateKeypair() (Keypair, error) {
 
+	switch c.keyType {
+	case keytypes.EC_SECP256R1:
+		return generateECKeypair(elliptic.P256())
+	case keytypes.EC_SECP384R1:
+		return generateECKeypair(elliptic.P384())
+	case keytypes.EC_SECP521R1:
+		return generateECKeypair(elliptic.P521())
+	case keytypes.RSA_2048:
+		return generateRSAKeypair(2048)
+	case keytypes.RSA_3072:
+		return generateRSAKeypair(3072)
+	case keytypes.RSA_4096:
+		return generateRSAKeypair(4096)
+	case keytypes.RSA_8192:
+		return generateRSAKeypair(8192)
+	}
+
 	keypair, err := NewKeypair()
 	return keypair, err
 }
@@ -118,23 +175,27 @@ func (c *VirgilCrypto) ExportPublicKey(key PublicKey) ([]byte, error) {
 }
 
 func (c *VirgilCrypto) Encrypt(data []byte, recipients ...PublicKey) ([]byte, error) {
-	cipher := c.Cipher()
+	cipher := c.newCipher()
 	for _, k := range recipients {
 		if k == nil || k.Empty() {
 			return nil, errors.New("key is nil")
 		}
-		cipher.AddKeyRecipient(k.(*ed25519PublicKey))
+		if err := cipher.AddKeyRecipient(k); err != nil {
+			return nil, err
+		}
 	}
 	return cipher.Encrypt(data)
 }
 
 func (c *VirgilCrypto) EncryptStream(in io.Reader, out io.Writer, recipients ...PublicKey) error {
-	cipher := c.Cipher()
+	cipher := c.newCipher()
 	for _, k := range recipients {
 		if k == nil || k.Empty() {
 			return errors.New("key is nil")
 		}
-		cipher.AddKeyRecipient(k.(*ed25519PublicKey))
+		if err := cipher.AddKeyRecipient(k); err != nil {
+			return err
+		}
 	}
 	return cipher.EncryptStream(in, out)
 }
@@ -143,14 +204,37 @@ func (c *VirgilCrypto) Decrypt(data []byte, key PrivateKey) ([]byte, error) {
 	if key == nil || key.Empty() {
 		return nil, errors.New("key is nil")
 	}
-	return c.Cipher().DecryptWithPrivateKey(data, key.(*ed25519PrivateKey))
+	return c.Cipher().DecryptWithPrivateKey(data, key)
 }
 
 func (c *VirgilCrypto) DecryptStream(in io.Reader, out io.Writer, key PrivateKey) error {
 	if key == nil || key.Empty() {
 		return errors.New("key is nil")
 	}
-	return c.Cipher().DecryptStream(in, out, key.(*ed25519PrivateKey))
+	return c.Cipher().DecryptStream(in, out, key)
+}
+
+func (c *VirgilCrypto) EncryptStreamWithPassword(in io.Reader, out io.Writer, password string) error {
+	if password == "" {
+		return errors.New("password is empty")
+	}
+	cipher := c.newCipher()
+	cipher.AddPasswordRecipient([]byte(password))
+	return cipher.EncryptStream(in, out)
+}
+
+func (c *VirgilCrypto) DecryptStreamWithPassword(in io.Reader, out io.Writer, password string) error {
+	if password == "" {
+		return errors.New("password is empty")
+	}
+	return c.Cipher().DecryptStreamWithPassword(in, out, []byte(password))
+}
+
+func (c *VirgilCrypto) OpenSeekable(ciphertext io.ReaderAt, size int64, key PrivateKey) (*SeekableReader, error) {
+	if key == nil || key.Empty() {
+		return nil, errors.New("key is nil")
+	}
+	return c.Cipher().OpenSeekable(ciphertext, size, key)
 }
 
 func (c *VirgilCrypto) Sign(data []byte, signer PrivateKey) ([]byte, error) {
@@ -193,14 +277,16 @@ func (c *VirgilCrypto) SignThenEncrypt(data []byte, signerKey PrivateKey, recipi
 	if signerKey == nil || signerKey.Empty() {
 		return nil, errors.New("key is nil")
 	}
-	cipher := c.Cipher()
+	cipher := c.newCipher()
 	for _, k := range recipients {
 		if k == nil || k.Empty() {
 			return nil, errors.New("key is nil")
 		}
-		cipher.AddKeyRecipient(k.(*ed25519PublicKey))
+		if err := cipher.AddKeyRecipient(k); err != nil {
+			return nil, err
+		}
 	}
-	return cipher.SignThenEncrypt(data, signerKey.(*ed25519PrivateKey))
+	return cipher.SignThenEncrypt(data, signerKey)
 }
 
 func (c *VirgilCrypto) DecryptThenVerify(data []byte, decryptionKey PrivateKey, verifierKeys ...PublicKey) ([]byte, error) {
@@ -209,12 +295,87 @@ func (c *VirgilCrypto) DecryptThenVerify(data []byte, decryptionKey PrivateKey,
 		return nil, errors.New("key is nil")
 	}
 
-	verifiers := make([]*ed25519PublicKey, 0, len(verifierKeys))
 	for _, v := range verifierKeys {
-		verifiers = append(verifiers, v.(*ed25519PublicKey))
+		if v == nil || v.Empty() {
+			return nil, errors.New("key is nil")
+		}
+	}
+
+	return c.Cipher().DecryptThenVerify(data, decryptionKey, verifierKeys...)
+}
+
+func (c *VirgilCrypto) SignThenEncryptMultiple(data []byte, signerKeys []PrivateKey, recipients ...PublicKey) ([]byte, error) {
+	if len(signerKeys) == 0 {
+		return nil, errors.New("key is nil")
+	}
+	for _, s := range signerKeys {
+		if s == nil || s.Empty() {
+			return nil, errors.New("key is nil")
+		}
+	}
+	cipher := c.newCipher()
+	for _, k := range recipients {
+		if k == nil || k.Empty() {
+			return nil, errors.New("key is nil")
+		}
+		if err := cipher.AddKeyRecipient(k); err != nil {
+			return nil, err
+		}
+	}
+	return cipher.SignThenEncryptMultiple(data, signerKeys...)
+}
+
+func (c *VirgilCrypto) Countersign(data []byte, decryptionKey PrivateKey, signerKey PrivateKey) ([]byte, error) {
+	if decryptionKey == nil || decryptionKey.Empty() || signerKey == nil || signerKey.Empty() {
+		return nil, errors.New("key is nil")
+	}
+	return c.Cipher().Countersign(data, decryptionKey, signerKey)
+}
+
+func (c *VirgilCrypto) DecryptThenVerifyWithPolicy(data []byte, decryptionKey PrivateKey, policy SignaturePolicy, verifierKeys ...PublicKey) ([]byte, []PublicKey, error) {
+
+	if decryptionKey == nil || decryptionKey.Empty() || len(verifierKeys) == 0 {
+		return nil, nil, errors.New("key is nil")
+	}
+
+	for _, v := range verifierKeys {
+		if v == nil || v.Empty() {
+			return nil, nil, errors.New("key is nil")
+		}
+	}
+
+	return c.Cipher().DecryptThenVerifyWithPolicy(data, decryptionKey, policy, verifierKeys...)
+}
+
+func (c *VirgilCrypto) SignThenEncryptStream(in io.Reader, out io.Writer, signerKey PrivateKey, recipients ...PublicKey) error {
+	if signerKey == nil || signerKey.Empty() {
+		return errors.New("key is nil")
+	}
+	cipher := c.newCipher()
+	for _, k := range recipients {
+		if k == nil || k.Empty() {
+			return errors.New("key is nil")
+		}
+		if err := cipher.AddKeyRecipient(k); err != nil {
+			return err
+		}
+	}
+	return cipher.SignThenEncryptStream(in, out, signerKey)
+}
+
+func (c *VirgilCrypto) DecryptThenVerifyStream(in io.Reader, out io.Writer, decryptionKey PrivateKey, verifierKeys ...PublicKey) error {
+
+	if decryptionKey == nil || decryptionKey.Empty() || len(verifierKeys) == 0 {
+		return errors.New("key is nil")
+	}
+
+	for _, v := range verifierKeys {
+		if v == nil || v.Empty() {
+			return errors.New("key is nil")
+		}
 	}
 
-	return c.Cipher().DecryptThenVerify(data, decryptionKey.(*ed25519PrivateKey), verifiers...)
+	return c.Cipher().DecryptThenVerifyStream(in, out, decryptionKey, verifierKeys...)
 }
 
 func (c *VirgilCrypto) ExtractPublicKey(key PrivateKey) (PublicKey, error) {
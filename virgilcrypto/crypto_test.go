@@ -3,7 +3,13 @@ package virgilcrypto
 import (
 	"bytes"
 	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
 	"testing"
+	"testing/iotest"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/virgil.v4/virgilcrypto/keytypes"
 )
 
 func TestSignEncrypt(t *testing.T) {
@@ -33,3 +39,194 @@ func TestSignEncrypt(t *testing.T) {
 	}
 
 }
+
+func TestSignThenEncryptStream(t *testing.T) {
+	crypto := DefaultCrypto
+
+	keypair, err := crypto.GenerateKeypair()
+	assert.NoError(t, err)
+
+	signerKeypair, err := NewKeypair()
+	assert.NoError(t, err)
+
+	otherKeypair, err := NewKeypair()
+	assert.NoError(t, err)
+
+	for _, size := range []int{0, 257, DefaultChunkSize - 1, DefaultChunkSize*2 + 5} {
+		data := make([]byte, size)
+		rand.Read(data)
+
+		cipherText := &bytes.Buffer{}
+		err = crypto.SignThenEncryptStream(iotest.HalfReader(bytes.NewReader(data)), cipherText, signerKeypair.PrivateKey(), keypair.PublicKey())
+		assert.NoError(t, err)
+
+		plainText := &bytes.Buffer{}
+		err = crypto.DecryptThenVerifyStream(iotest.HalfReader(bytes.NewReader(cipherText.Bytes())), plainText, keypair.PrivateKey(), otherKeypair.PublicKey(), signerKeypair.PublicKey())
+		assert.NoError(t, err)
+		assert.True(t, bytes.Equal(data, plainText.Bytes()))
+
+		err = crypto.DecryptThenVerifyStream(bytes.NewReader(cipherText.Bytes()), &bytes.Buffer{}, keypair.PrivateKey(), otherKeypair.PublicKey())
+		assert.Error(t, err)
+
+		//signed stream can't be decrypted without verification
+		plainText.Reset()
+		err = crypto.DecryptStream(bytes.NewReader(cipherText.Bytes()), plainText, keypair.PrivateKey())
+		assert.Error(t, err)
+		assert.Empty(t, plainText.Bytes())
+	}
+
+	//unsigned stream
+	cipherText := &bytes.Buffer{}
+	err = crypto.EncryptStream(bytes.NewReader([]byte("test data")), cipherText, keypair.PublicKey())
+	assert.NoError(t, err)
+	err = crypto.DecryptThenVerifyStream(bytes.NewReader(cipherText.Bytes()), &bytes.Buffer{}, keypair.PrivateKey(), signerKeypair.PublicKey())
+	assert.Error(t, err)
+}
+
+func TestNistCurves(t *testing.T) {
+	for _, keyType := range []KeyType{keytypes.EC_SECP256R1, keytypes.EC_SECP384R1, keytypes.EC_SECP521R1} {
+		crypto := &VirgilCrypto{Cipher: NewCipher}
+		assert.NoError(t, crypto.SetKeyType(keyType))
+
+		keypair, err := crypto.GenerateKeypair()
+		assert.NoError(t, err)
+
+		edKeypair, err := NewKeypair()
+		assert.NoError(t, err)
+
+		//import & export
+		pub, err := crypto.ExportPublicKey(keypair.PublicKey())
+		assert.NoError(t, err)
+		importedPub, err := crypto.ImportPublicKey(pem.EncodeToMemory(&pem.Block{Type: PUBLIC_KEY, Bytes: pub}))
+		assert.NoError(t, err)
+		assert.Equal(t, keypair.PublicKey().ReceiverID(), importedPub.ReceiverID())
+
+		priv, err := crypto.ExportPrivateKey(keypair.PrivateKey(), "")
+		assert.NoError(t, err)
+		importedPriv, err := crypto.ImportPrivateKey(priv, "")
+		assert.NoError(t, err)
+		assert.Equal(t, keypair.PrivateKey().ReceiverID(), importedPriv.ReceiverID())
+
+		priv, err = crypto.ExportPrivateKey(keypair.PrivateKey(), "password")
+		assert.NoError(t, err)
+		importedPriv, err = crypto.ImportPrivateKey(priv, "password")
+		assert.NoError(t, err)
+		assert.Equal(t, keypair.PrivateKey().ReceiverID(), importedPriv.ReceiverID())
+
+		sec1, err := x509.MarshalECPrivateKey(keypair.PrivateKey().(*ecPrivateKey).key)
+		assert.NoError(t, err)
+		importedPriv, err = crypto.ImportPrivateKey(pem.EncodeToMemory(&pem.Block{Type: SEC1_PRIVATE_KEY, Bytes: sec1}), "")
+		assert.NoError(t, err)
+		assert.Equal(t, keypair.PrivateKey().ReceiverID(), importedPriv.ReceiverID())
+
+		//mixed recipients
+		data := make([]byte, 257)
+		rand.Read(data)
+
+		cipherText, err := crypto.Encrypt(data, keypair.PublicKey(), edKeypair.PublicKey())
+		assert.NoError(t, err)
+
+		plaintext, err := crypto.Decrypt(cipherText, importedPriv)
+		assert.NoError(t, err)
+		assert.Equal(t, data, plaintext)
+
+		plaintext, err = crypto.Decrypt(cipherText, edKeypair.PrivateKey())
+		assert.NoError(t, err)
+		assert.Equal(t, data, plaintext)
+
+		//signatures
+		signature, err := crypto.Sign(data, keypair.PrivateKey())
+		assert.NoError(t, err)
+
+		res, err := crypto.Verify(data, signature, importedPub)
+		assert.NoError(t, err)
+		assert.True(t, res)
+
+		res, err = crypto.Verify(data[1:], signature, importedPub)
+		assert.Error(t, err)
+		assert.False(t, res)
+
+		cipherText, err = crypto.SignThenEncrypt(data, keypair.PrivateKey(), edKeypair.PublicKey())
+		assert.NoError(t, err)
+
+		plaintext, err = crypto.DecryptThenVerify(cipherText, edKeypair.PrivateKey(), keypair.PublicKey())
+		assert.NoError(t, err)
+		assert.Equal(t, data, plaintext)
+	}
+
+	assert.Error(t, (&VirgilCrypto{Cipher: NewCipher}).SetKeyType(keytypes.EC_BP256R1))
+}
+
+func TestRSA(t *testing.T) {
+	crypto := &VirgilCrypto{Cipher: NewCipher}
+	assert.NoError(t, crypto.SetKeyType(keytypes.RSA_2048))
+
+	keypair, err := crypto.GenerateKeypair()
+	assert.NoError(t, err)
+
+	edKeypair, err := NewKeypair()
+	assert.NoError(t, err)
+
+	//PKCS#8 & SPKI
+	pub, err := crypto.ExportPublicKey(keypair.PublicKey())
+	assert.NoError(t, err)
+	importedPub, err := crypto.ImportPublicKey(pub)
+	assert.NoError(t, err)
+	assert.Equal(t, keypair.PublicKey().ReceiverID(), importedPub.ReceiverID())
+
+	priv, err := crypto.ExportPrivateKey(keypair.PrivateKey(), "password")
+	assert.NoError(t, err)
+	importedPriv, err := crypto.ImportPrivateKey(priv, "password")
+	assert.NoError(t, err)
+	assert.Equal(t, keypair.PrivateKey().ReceiverID(), importedPriv.ReceiverID())
+
+	//PKCS#1
+	pkcs1Pub, err := EncodePKCS1PublicKey(keypair.PublicKey())
+	assert.NoError(t, err)
+	importedPub, err = crypto.ImportPublicKey(pem.EncodeToMemory(&pem.Block{Type: RSA_PUBLIC_KEY, Bytes: pkcs1Pub}))
+	assert.NoError(t, err)
+	assert.Equal(t, keypair.PublicKey().ReceiverID(), importedPub.ReceiverID())
+
+	pkcs1Priv, err := EncodePKCS1PrivateKey(keypair.PrivateKey())
+	assert.NoError(t, err)
+	importedPriv, err = crypto.ImportPrivateKey(pkcs1Priv, "")
+	assert.NoError(t, err)
+	assert.Equal(t, keypair.PrivateKey().ReceiverID(), importedPriv.ReceiverID())
+
+	_, err = EncodePKCS1PrivateKey(edKeypair.PrivateKey())
+	assert.Error(t, err)
+
+	//mixed recipients
+	data := make([]byte, 257)
+	rand.Read(data)
+
+	cipherText, err := crypto.Encrypt(data, edKeypair.PublicKey(), importedPub)
+	assert.NoError(t, err)
+
+	plaintext, err := crypto.Decrypt(cipherText, importedPriv)
+	assert.NoError(t, err)
+	assert.Equal(t, data, plaintext)
+
+	plaintext, err = crypto.Decrypt(cipherText, edKeypair.PrivateKey())
+	assert.NoError(t, err)
+	assert.Equal(t, data, plaintext)
+
+	//signatures
+	signature, err := crypto.Sign(data, keypair.PrivateKey())
+	assert.NoError(t, err)
+
+	res, err := crypto.Verify(data, signature, importedPub)
+	assert.NoError(t, err)
+	assert.True(t, res)
+
+	res, err = crypto.Verify(data[1:], signature, importedPub)
+	assert.Error(t, err)
+	assert.False(t, res)
+
+	cipherText, err = crypto.SignThenEncrypt(data, keypair.PrivateKey(), keypair.PublicKey(), edKeypair.PublicKey())
+	assert.NoError(t, err)
+
+	plaintext, err = crypto.DecryptThenVerify(cipherText, keypair.PrivateKey(), keypair.PublicKey())
+	assert.NoError(t, err)
+	assert.Equal(t, data, plaintext)
+}
@@ -3,6 +3,7 @@ package virgilcrypto
 import (
 	"crypto/aes"
 	"crypto/cipher"
+	"crypto/ecdh"
 	"crypto/hmac"
 	"crypto/rand"
 	"crypto/subtle"
@@ -81,31 +82,7 @@ func decryptSymmetricKeyWithECIES(encryptedSymmetricKey, tag, ephPub, iv, privat
 		err = cryptoError(err, "")
 		return nil, err
 	}
-	//derive keys
-	keys := kdf2(common[:], 80, Hash.New)
-
-	//calculate mac
-	mac := hmac.New(Hash.New, keys[32:])
-	mac.Write(encryptedSymmetricKey)
-	macResult := mac.Sum(nil)
-
-	if subtle.ConstantTimeCompare(macResult, tag) == 1 {
-		//compare with tag
-		//decrypt symmetric key
-		ciph, err := aes.NewCipher(keys[:32])
-		if err != nil {
-			return nil, cryptoError(err, "")
-		}
-		aesCBC := cipher.NewCBCDecrypter(ciph, iv)
-		deciphered := make([]byte, len(encryptedSymmetricKey))
-		aesCBC.CryptBlocks(deciphered, encryptedSymmetricKey)
-		ciphertextKey, err := pkcs7Unpad(deciphered, aesCBC.BlockSize())
-		if err != nil {
-			return nil, cryptoError(err, "")
-		}
-		return ciphertextKey, nil
-	}
-	return nil, CryptoError("Tag does not match")
+	return decryptSymmetricKeyWithSharedSecret(common[:], encryptedSymmetricKey, tag, iv)
 }
 
 func encryptSymmetricKeyWithECIES(public_key, symmetricKey []byte) (encryptedSymmetricKey, tag, ephPub, iv []byte, err error) {
@@ -127,12 +104,6 @@ func encryptSymmetricKeyWithECIES(public_key, symmetricKey []byte) (encryptedSym
 	hisPublic := new([ed25519.PublicKeySize]byte)
 	hisCurvePublic := new([Curve25519PublicKeySize]byte)
 
-	iv = make([]byte, aes.BlockSize)
-	_, err = rand.Reader.Read(iv)
-	if err != nil {
-		err = cryptoError(err, "")
-		return
-	}
 	copy(hisPublic[:], public_key)
 	copy(ephPrivate[:], keypair.PrivateKey().(*ed25519PrivateKey).contents())
 
@@ -146,8 +117,21 @@ func encryptSymmetricKeyWithECIES(public_key, symmetricKey []byte) (encryptedSym
 		err = cryptoError(err, "")
 		return
 	}
+	encryptedSymmetricKey, tag, iv, err = encryptSymmetricKeyWithSharedSecret(sharedSecret[:], symmetricKey)
+	return encryptedSymmetricKey, tag, ephPub, iv, err
+}
+
+//encryptSymmetricKeyWithSharedSecret derives AES & HMAC keys from the DH result and wraps the symmetric key with them
+func encryptSymmetricKeyWithSharedSecret(sharedSecret, symmetricKey []byte) (encryptedSymmetricKey, tag, iv []byte, err error) {
+	iv = make([]byte, aes.BlockSize)
+	_, err = rand.Reader.Read(iv)
+	if err != nil {
+		err = cryptoError(err, "")
+		return
+	}
+
 	//derive keys
-	keys := kdf2(sharedSecret[:], 80, Hash.New) // 32 bytes - AES key + 48 bytes HMAC key
+	keys := kdf2(sharedSecret, 80, Hash.New) // 32 bytes - AES key + 48 bytes HMAC key
 
 	//encrypt symmetric key
 	ciph, err := aes.NewCipher(keys[:32])
@@ -169,7 +153,69 @@ func encryptSymmetricKeyWithECIES(public_key, symmetricKey []byte) (encryptedSym
 	mac.Write(encryptedSymmetricKey)
 	tag = mac.Sum(nil)
 
-	return encryptedSymmetricKey, tag, ephPub, iv, nil
+	return encryptedSymmetricKey, tag, iv, nil
+}
+
+func decryptSymmetricKeyWithSharedSecret(sharedSecret, encryptedSymmetricKey, tag, iv []byte) ([]byte, error) {
+	//derive keys
+	keys := kdf2(sharedSecret, 80, Hash.New)
+
+	//calculate mac
+	mac := hmac.New(Hash.New, keys[32:])
+	mac.Write(encryptedSymmetricKey)
+	macResult := mac.Sum(nil)
+
+	if subtle.ConstantTimeCompare(macResult, tag) == 1 {
+		//compare with tag
+		//decrypt symmetric key
+		ciph, err := aes.NewCipher(keys[:32])
+		if err != nil {
+			return nil, cryptoError(err, "")
+		}
+		if len(iv) != ciph.BlockSize() || len(encryptedSymmetricKey)%ciph.BlockSize() != 0 {
+			return nil, CryptoError("invalid encrypted key or iv size")
+		}
+		aesCBC := cipher.NewCBCDecrypter(ciph, iv)
+		deciphered := make([]byte, len(encryptedSymmetricKey))
+		aesCBC.CryptBlocks(deciphered, encryptedSymmetricKey)
+		ciphertextKey, err := pkcs7Unpad(deciphered, aesCBC.BlockSize())
+		if err != nil {
+			return nil, cryptoError(err, "")
+		}
+		return ciphertextKey, nil
+	}
+	return nil, CryptoError("Tag does not match")
+}
+
+//encryptSymmetricKeyWithNistECIES does the same as encryptSymmetricKeyWithECIES but for NIST curves using ECDH
+func encryptSymmetricKeyWithNistECIES(publicKey *ecdh.PublicKey, symmetricKey []byte) (encryptedSymmetricKey, tag, ephPub, iv []byte, err error) {
+	ephPrivate, err := publicKey.Curve().GenerateKey(rand.Reader)
+	if err != nil {
+		err = cryptoError(err, "")
+		return
+	}
+
+	sharedSecret, err := ephPrivate.ECDH(publicKey)
+	if err != nil {
+		err = cryptoError(err, "")
+		return
+	}
+
+	encryptedSymmetricKey, tag, iv, err = encryptSymmetricKeyWithSharedSecret(sharedSecret, symmetricKey)
+	return encryptedSymmetricKey, tag, ephPrivate.PublicKey().Bytes(), iv, err
+}
+
+func decryptSymmetricKeyWithNistECIES(encryptedSymmetricKey, tag, ephPub, iv []byte, privateKey *ecdh.PrivateKey) ([]byte, error) {
+	hisPublic, err := privateKey.Curve().NewPublicKey(ephPub)
+	if err != nil {
+		return nil, cryptoError(err, "invalid ephemeral public key")
+	}
+
+	sharedSecret, err := privateKey.ECDH(hisPublic)
+	if err != nil {
+		return nil, cryptoError(err, "")
+	}
+	return decryptSymmetricKeyWithSharedSecret(sharedSecret, encryptedSymmetricKey, tag, iv)
 }
 
 func checkSharedSecret(sk []byte) error {
@@ -0,0 +1,327 @@
+package virgilcrypto
+
+/*
+Copyright (C) 2016-2017 Virgil Security Inc.
+
+Lead Maintainer: Virgil Security Inc. <support@virgilsecurity.com>
+
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions
+are met:
+
+  (1) Redistributions of source code must retain the above copyright
+  notice, this list of conditions and the following disclaimer.
+
+  (2) Redistributions in binary form must reproduce the above copyright
+  notice, this list of conditions and the following disclaimer in
+  the documentation and/or other materials provided with the
+  distribution.
+
+  (3) Neither the name of the copyright holder nor the names of its
+  contributors may be used to endorse or promote products derived
+  from this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE AUTHOR ''AS IS'' AND ANY EXPRESS OR
+IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY DIRECT,
+INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+(INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT,
+STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING
+IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+POSSIBILITY OF SUCH DAMAGE.
+*/
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+)
+
+//NIST curve keys (secp256r1, secp384r1, secp521r1)
+
+type ecPublicKey struct {
+	receiverID []byte
+	key        *ecdsa.PublicKey
+}
+
+type ecPrivateKey struct {
+	receiverID []byte
+	key        *ecdsa.PrivateKey
+}
+
+func generateECKeypair(curve elliptic.Curve) (Keypair, error) {
+	key, err := ecdsa.GenerateKey(curve, rand.Reader)
+	if err != nil {
+		return nil, cryptoError(err, "")
+	}
+
+	priv, err := newECPrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	pub := &ecPublicKey{key: &key.PublicKey}
+	pub.receiverID = make([]byte, len(priv.receiverID))
+	copy(pub.receiverID, priv.receiverID)
+
+	return &keypair{publicKey: pub, privateKey: priv}, nil
+}
+
+func newECPublicKey(key *ecdsa.PublicKey) (*ecPublicKey, error) {
+	if _, err := curveOid(key.Curve); err != nil {
+		return nil, err
+	}
+	pub := &ecPublicKey{key: key}
+	snapshot, err := pub.Encode()
+	if err != nil {
+		return nil, err
+	}
+	pub.receiverID = DefaultCrypto.CalculateFingerprint(snapshot)
+	return pub, nil
+}
+
+func newECPrivateKey(key *ecdsa.PrivateKey) (*ecPrivateKey, error) {
+	pub, err := newECPublicKey(&key.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+	return &ecPrivateKey{key: key, receiverID: pub.receiverID}, nil
+}
+
+func decodeECPublicKey(der []byte) (*ecPublicKey, error) {
+	key, err := x509.ParsePKIXPublicKey(der)
+	if err != nil {
+		return nil, cryptoError(err, "invalid data")
+	}
+	ecKey, ok := key.(*ecdsa.PublicKey)
+	if !ok {
+		return nil, unsupported("public key type")
+	}
+	return newECPublicKey(ecKey)
+}
+
+func decodeECPrivateKey(der []byte) (*ecPrivateKey, error) {
+	key, err := x509.ParsePKCS8PrivateKey(der)
+	if err != nil {
+		return nil, cryptoError(err, "invalid data")
+	}
+	ecKey, ok := key.(*ecdsa.PrivateKey)
+	if !ok {
+		return nil, unsupported("key type")
+	}
+	return newECPrivateKey(ecKey)
+}
+
+//decodeSEC1PrivateKey loads keys in "EC PRIVATE KEY" (RFC 5915) format
+func decodeSEC1PrivateKey(der []byte) (*ecPrivateKey, error) {
+	key, err := x509.ParseECPrivateKey(der)
+	if err != nil {
+		return nil, cryptoError(err, "invalid data")
+	}
+	return newECPrivateKey(key)
+}
+
+func (k *ecPublicKey) ReceiverID() []byte {
+	return k.receiverID
+}
+
+func (k *ecPublicKey) algorithm() algorithmIdentifierWithOidParameter {
+	oid, _ := curveOid(k.key.Curve)
+	return algorithmIdentifierWithOidParameter{
+		Algorithm:  oidEcPublicKey,
+		Parameters: oid,
+	}
+}
+
+func (k *ecPublicKey) Encode() ([]byte, error) {
+	if k.Empty() {
+		return nil, CryptoError("public key is empty")
+	}
+	rawKey, err := x509.MarshalPKIXPublicKey(k.key)
+	if err != nil {
+		return nil, cryptoError(err, "")
+	}
+	return rawKey, nil
+}
+
+func (k *ecPublicKey) Empty() bool {
+	return k == nil || k.key == nil
+}
+
+func (k *ecPrivateKey) ReceiverID() []byte {
+	return k.receiverID
+}
+
+func (k *ecPrivateKey) Encode(password []byte) ([]byte, error) {
+	if k.Empty() {
+		return nil, CryptoError("private key is empty")
+	}
+	serializedKey, err := x509.MarshalPKCS8PrivateKey(k.key)
+	if err != nil {
+		return nil, cryptoError(err, "")
+	}
+
+	if len(password) == 0 {
+		return serializedKey, nil
+	}
+	return encryptPrivateKey(serializedKey, password, false)
+}
+
+func (k *ecPrivateKey) Empty() bool {
+	return k == nil || k.key == nil
+}
+
+func (k *ecPrivateKey) ExtractPublicKey() (PublicKey, error) {
+	if k.Empty() {
+		return nil, CryptoError("private key is empty")
+	}
+	pub := &ecPublicKey{key: &k.key.PublicKey}
+	pub.receiverID = make([]byte, len(k.receiverID))
+	copy(pub.receiverID, k.receiverID)
+	return pub, nil
+}
+
+func curveOid(curve elliptic.Curve) (asn1.ObjectIdentifier, error) {
+	switch curve {
+	case elliptic.P256():
+		return oidSecp256r1, nil
+	case elliptic.P384():
+		return oidSecp384r1, nil
+	case elliptic.P521():
+		return oidSecp521r1, nil
+	}
+	return nil, unsupported("curve")
+}
+
+func curveByOid(oid asn1.ObjectIdentifier) (elliptic.Curve, error) {
+	switch {
+	case oid.Equal(oidSecp256r1):
+		return elliptic.P256(), nil
+	case oid.Equal(oidSecp384r1):
+		return elliptic.P384(), nil
+	case oid.Equal(oidSecp521r1):
+		return elliptic.P521(), nil
+	}
+	return nil, unsupported("curve")
+}
+
+type ecAlgorithm struct{}
+
+func (a *ecAlgorithm) OID() asn1.ObjectIdentifier {
+	return oidEcPublicKey
+}
+
+func (a *ecAlgorithm) SupportsPublicKey(key PublicKey) bool {
+	_, ok := key.(*ecPublicKey)
+	return ok
+}
+
+func (a *ecAlgorithm) SupportsPrivateKey(key PrivateKey) bool {
+	_, ok := key.(*ecPrivateKey)
+	return ok
+}
+
+func (a *ecAlgorithm) DecodePublicKey(der []byte) (PublicKey, error) {
+	return decodeECPublicKey(der)
+}
+
+func (a *ecAlgorithm) DecodePrivateKey(der []byte) (PrivateKey, error) {
+	return decodeECPrivateKey(der)
+}
+
+func (a *ecAlgorithm) EncryptKey(key PublicKey, symmetricKey []byte) (pkix.AlgorithmIdentifier, []byte, error) {
+	k := key.(*ecPublicKey)
+	keyAlgorithm := k.algorithm()
+
+	serializedCurve, err := asn1.Marshal(keyAlgorithm.Parameters)
+	if err != nil {
+		return pkix.AlgorithmIdentifier{}, nil, cryptoError(err, "")
+	}
+	algorithm := pkix.AlgorithmIdentifier{
+		Algorithm:  oidEcPublicKey,
+		Parameters: asn1.RawValue{FullBytes: serializedCurve},
+	}
+
+	pub, err := k.key.ECDH()
+	if err != nil {
+		return algorithm, nil, cryptoError(err, "invalid public key")
+	}
+
+	encryptedSymmetricKey, tag, ephPub, iv, err := encryptSymmetricKeyWithNistECIES(pub, symmetricKey)
+	if err != nil {
+		return algorithm, nil, err
+	}
+
+	encryptedKey, err := makeECIESKey(keyAlgorithm, ephPub, tag, encryptedSymmetricKey, iv)
+	return algorithm, encryptedKey, err
+}
+
+func (a *ecAlgorithm) DecryptKey(key PrivateKey, algorithm pkix.AlgorithmIdentifier, encryptedKey []byte) ([]byte, error) {
+	if !algorithm.Algorithm.Equal(oidEcPublicKey) {
+		return nil, unsupported("key encryption algorithm")
+	}
+
+	eciesKey, err := decodeECIESKey(encryptedKey)
+	if err != nil {
+		return nil, err
+	}
+
+	ephAlgorithm := eciesKey.PublicKey.Algorithm
+	if !ephAlgorithm.Algorithm.Equal(oidEcPublicKey) {
+		return nil, unsupported("ephemeral key algorithm")
+	}
+
+	k := key.(*ecPrivateKey)
+	curve, err := curveOid(k.key.Curve)
+	if err != nil {
+		return nil, err
+	}
+	if !ephAlgorithm.Parameters.Equal(curve) {
+		return nil, unsupported("ephemeral key curve")
+	}
+
+	priv, err := k.key.ECDH()
+	if err != nil {
+		return nil, cryptoError(err, "invalid private key")
+	}
+
+	return decryptSymmetricKeyWithNistECIES(eciesKey.EncryptedData.Value,
+		eciesKey.Hmac.Value,
+		eciesKey.PublicKey.PublicKey.Bytes,
+		eciesKey.EncryptedData.CipherParams.Parameters,
+		priv)
+}
+
+func (a *ecAlgorithm) Sign(hash []byte, key PrivateKey) ([]byte, error) {
+	return signECDSA(hash, key.(*ecPrivateKey))
+}
+
+func (a *ecAlgorithm) Verify(hash []byte, key PublicKey, signature []byte) (bool, error) {
+	return verifyECDSA(hash, key.(*ecPublicKey), signature)
+}
+
+func (a *ecAlgorithm) DH(priv PrivateKey, pub PublicKey) ([]byte, error) {
+	ecPriv, err := priv.(*ecPrivateKey).key.ECDH()
+	if err != nil {
+		return nil, cryptoError(err, "invalid private key")
+	}
+	ecPub, err := pub.(*ecPublicKey).key.ECDH()
+	if err != nil {
+		return nil, cryptoError(err, "invalid public key")
+	}
+	if ecPriv.Curve() != ecPub.Curve() {
+		return nil, unsupported("curve mismatch")
+	}
+	sk, err := ecPriv.ECDH(ecPub)
+	if err != nil {
+		return nil, cryptoError(err, "")
+	}
+	return sk, nil
+}
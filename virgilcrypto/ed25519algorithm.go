@@ -0,0 +1,114 @@
+package virgilcrypto
+
+/*
+Copyright (C) 2016-2017 Virgil Security Inc.
+
+Lead Maintainer: Virgil Security Inc. <support@virgilsecurity.com>
+
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions
+are met:
+
+  (1) Redistributions of source code must retain the above copyright
+  notice, this list of conditions and the following disclaimer.
+
+  (2) Redistributions in binary form must reproduce the above copyright
+  notice, this list of conditions and the following disclaimer in
+  the documentation and/or other materials provided with the
+  distribution.
+
+  (3) Neither the name of the copyright holder nor the names of its
+  contributors may be used to endorse or promote products derived
+  from this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE AUTHOR ''AS IS'' AND ANY EXPRESS OR
+IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY DIRECT,
+INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+(INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT,
+STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING
+IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+POSSIBILITY OF SUCH DAMAGE.
+*/
+import (
+	"crypto/x509/pkix"
+	"encoding/asn1"
+)
+
+type ed25519Algorithm struct{}
+
+func (a *ed25519Algorithm) OID() asn1.ObjectIdentifier {
+	return oidEd25519key
+}
+
+func (a *ed25519Algorithm) SupportsPublicKey(key PublicKey) bool {
+	_, ok := key.(*ed25519PublicKey)
+	return ok
+}
+
+func (a *ed25519Algorithm) SupportsPrivateKey(key PrivateKey) bool {
+	_, ok := key.(*ed25519PrivateKey)
+	return ok
+}
+
+func (a *ed25519Algorithm) DecodePublicKey(der []byte) (PublicKey, error) {
+	return decodeEd25519PublicKey(der)
+}
+
+func (a *ed25519Algorithm) DecodePrivateKey(der []byte) (PrivateKey, error) {
+	return loadEd25519PrivateKey(der)
+}
+
+func (a *ed25519Algorithm) EncryptKey(key PublicKey, symmetricKey []byte) (pkix.AlgorithmIdentifier, []byte, error) {
+	algorithm := pkix.AlgorithmIdentifier{Algorithm: oidEd25519key}
+
+	encryptedSymmetricKey, tag, ephPub, iv, err := encryptSymmetricKeyWithECIES(key.(*ed25519PublicKey).contents(), symmetricKey)
+	if err != nil {
+		return algorithm, nil, err
+	}
+
+	encryptedKey, err := makeECIESKey(ed25519Algo, ephPub, tag, encryptedSymmetricKey, iv)
+	return algorithm, encryptedKey, err
+}
+
+func (a *ed25519Algorithm) DecryptKey(key PrivateKey, algorithm pkix.AlgorithmIdentifier, encryptedKey []byte) ([]byte, error) {
+	if !algorithm.Algorithm.Equal(oidEd25519key) {
+		return nil, unsupported("key encryption algorithm")
+	}
+
+	if len(encryptedKey) != 226 {
+		return nil, unsupported("encrypted key data length")
+	}
+
+	eciesKey, err := decodeECIESKey(encryptedKey)
+	if err != nil {
+		return nil, err
+	}
+
+	if !eciesKey.PublicKey.Algorithm.Algorithm.Equal(oidEd25519key) {
+		return nil, unsupported("ephemeral key algorithm")
+	}
+
+	return decryptSymmetricKeyWithECIES(eciesKey.EncryptedData.Value,
+		eciesKey.Hmac.Value,
+		eciesKey.PublicKey.PublicKey.Bytes,
+		eciesKey.EncryptedData.CipherParams.Parameters,
+		key.(*ed25519PrivateKey).contents())
+}
+
+func (a *ed25519Algorithm) Sign(hash []byte, key PrivateKey) ([]byte, error) {
+	return signInternal(hash, key.(*ed25519PrivateKey))
+}
+
+func (a *ed25519Algorithm) Verify(hash []byte, key PublicKey, signature []byte) (bool, error) {
+	return verifyInternal(hash, key.(*ed25519PublicKey), signature)
+}
+
+func (a *ed25519Algorithm) DH(priv PrivateKey, pub PublicKey) ([]byte, error) {
+	return dhED25519(priv.(*ed25519PrivateKey), pub.(*ed25519PublicKey))
+}
@@ -12,6 +12,11 @@ type WrongPasswordError struct {
 	CryptoError
 }
 
+//InvalidPrekeyError is returned when a prekey is not signed with the identity key of its owner
+type InvalidPrekeyError struct {
+	CryptoError
+}
+
 func cryptoError(err error, msg string) error {
 	if err == nil {
 		return nil
@@ -0,0 +1,175 @@
+package virgilcrypto
+
+/*
+Copyright (C) 2016-2017 Virgil Security Inc.
+
+Lead Maintainer: Virgil Security Inc. <support@virgilsecurity.com>
+
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions
+are met:
+
+  (1) Redistributions of source code must retain the above copyright
+  notice, this list of conditions and the following disclaimer.
+
+  (2) Redistributions in binary form must reproduce the above copyright
+  notice, this list of conditions and the following disclaimer in
+  the documentation and/or other materials provided with the
+  distribution.
+
+  (3) Neither the name of the copyright holder nor the names of its
+  contributors may be used to endorse or promote products derived
+  from this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE AUTHOR ''AS IS'' AND ANY EXPRESS OR
+IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY DIRECT,
+INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+(INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT,
+STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING
+IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+POSSIBILITY OF SUCH DAMAGE.
+*/
+import (
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"sync"
+)
+
+//KeyAlgorithm implements all key dependent operations for a family of keys.
+//Built in ed25519, NIST curve and RSA keys are registered by default, other key
+//implementations (HSM backed keys, test keys) can take part in encryption, decryption,
+//signing and verification by registering their algorithm with RegisterKeyAlgorithm
+type KeyAlgorithm interface {
+	//OID identifies the algorithm inside SubjectPublicKeyInfo and PKCS#8 structures
+	OID() asn1.ObjectIdentifier
+
+	SupportsPublicKey(key PublicKey) bool
+	SupportsPrivateKey(key PrivateKey) bool
+
+	//DecodePublicKey parses DER encoded SubjectPublicKeyInfo
+	DecodePublicKey(der []byte) (PublicKey, error)
+	//DecodePrivateKey parses DER encoded PKCS#8 private key
+	DecodePrivateKey(der []byte) (PrivateKey, error)
+
+	//EncryptKey encrypts symmetric key for the recipient. The result is stored in the KeyTransRecipientInfo
+	EncryptKey(key PublicKey, symmetricKey []byte) (algorithm pkix.AlgorithmIdentifier, encryptedKey []byte, err error)
+	//DecryptKey decrypts symmetric key taken from the KeyTransRecipientInfo
+	DecryptKey(key PrivateKey, algorithm pkix.AlgorithmIdentifier, encryptedKey []byte) ([]byte, error)
+
+	//Sign returns raw signature of the hash, it will be wrapped into Virgil signature structure
+	Sign(hash []byte, key PrivateKey) ([]byte, error)
+	Verify(hash []byte, key PublicKey, signature []byte) (bool, error)
+}
+
+//DHKeyAlgorithm is a KeyAlgorithm which can calculate Diffie-Hellman shared secrets. It is required for PFS
+type DHKeyAlgorithm interface {
+	KeyAlgorithm
+	DH(priv PrivateKey, pub PublicKey) ([]byte, error)
+}
+
+var (
+	keyAlgorithmsMutex sync.RWMutex
+	keyAlgorithms      []KeyAlgorithm
+)
+
+//RegisterKeyAlgorithm adds key algorithm to the registry. Algorithms are looked up in the order of registration,
+//so built in algorithms always handle their own keys and an algorithm with an OID which is already registered is rejected
+func RegisterKeyAlgorithm(algorithm KeyAlgorithm) error {
+	if algorithm == nil {
+		return CryptoError("key algorithm is nil")
+	}
+	keyAlgorithmsMutex.Lock()
+	defer keyAlgorithmsMutex.Unlock()
+
+	oid := algorithm.OID()
+	for _, a := range keyAlgorithms {
+		if len(oid) > 0 && oid.Equal(a.OID()) {
+			return CryptoError("key algorithm " + oid.String() + " is already registered")
+		}
+	}
+	keyAlgorithms = append(keyAlgorithms, algorithm)
+	return nil
+}
+
+//unregisterKeyAlgorithm removes the algorithm added with RegisterKeyAlgorithm, tests use it to restore the registry
+func unregisterKeyAlgorithm(algorithm KeyAlgorithm) {
+	keyAlgorithmsMutex.Lock()
+	defer keyAlgorithmsMutex.Unlock()
+	for i, a := range keyAlgorithms {
+		if a == algorithm {
+			keyAlgorithms = append(keyAlgorithms[:i:i], keyAlgorithms[i+1:]...)
+			return
+		}
+	}
+}
+
+func findKeyAlgorithm(match func(algorithm KeyAlgorithm) bool) KeyAlgorithm {
+	keyAlgorithmsMutex.RLock()
+	defer keyAlgorithmsMutex.RUnlock()
+	for _, a := range keyAlgorithms {
+		if match(a) {
+			return a
+		}
+	}
+	return nil
+}
+
+func keyAlgorithmForPublicKey(key PublicKey) (KeyAlgorithm, error) {
+	if key == nil || key.Empty() {
+		return nil, CryptoError("public key is empty")
+	}
+	algorithm := findKeyAlgorithm(func(a KeyAlgorithm) bool { return a.SupportsPublicKey(key) })
+	if algorithm == nil {
+		return nil, unsupported("public key type")
+	}
+	return algorithm, nil
+}
+
+func keyAlgorithmForPrivateKey(key PrivateKey) (KeyAlgorithm, error) {
+	if key == nil || key.Empty() {
+		return nil, CryptoError("private key is empty")
+	}
+	algorithm := findKeyAlgorithm(func(a KeyAlgorithm) bool { return a.SupportsPrivateKey(key) })
+	if algorithm == nil {
+		return nil, unsupported("private key type")
+	}
+	return algorithm, nil
+}
+
+func keyAlgorithmByOid(oid asn1.ObjectIdentifier) (KeyAlgorithm, error) {
+	algorithm := findKeyAlgorithm(func(a KeyAlgorithm) bool { return a.OID().Equal(oid) })
+	if algorithm == nil {
+		return nil, unsupported("key type")
+	}
+	return algorithm, nil
+}
+
+//dh calculates shared secret for a pair of keys which belong to the same DHKeyAlgorithm
+func dh(priv PrivateKey, pub PublicKey) ([]byte, error) {
+	if pub == nil || pub.Empty() {
+		return nil, CryptoError("public key is empty")
+	}
+	algorithm, err := keyAlgorithmForPrivateKey(priv)
+	if err != nil {
+		return nil, err
+	}
+	dhAlgorithm, ok := algorithm.(DHKeyAlgorithm)
+	if !ok || !dhAlgorithm.SupportsPublicKey(pub) {
+		return nil, unsupported("key type for DH")
+	}
+	return dhAlgorithm.DH(priv, pub)
+}
+
+func init() {
+	for _, algorithm := range []KeyAlgorithm{&ed25519Algorithm{}, &ecAlgorithm{}, &rsaAlgorithm{}, &signerAlgorithm{}} {
+		if err := RegisterKeyAlgorithm(algorithm); err != nil {
+			panic(err)
+		}
+	}
+}
@@ -0,0 +1,192 @@
+package virgilcrypto
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+//testKey emulates an opaque (HSM like) key which the library knows nothing about
+type testKey struct {
+	id     []byte
+	secret []byte
+}
+
+type testPublicKey struct{ *testKey }
+type testPrivateKey struct{ *testKey }
+
+//unregistered keys are never supported by any algorithm
+type unregisteredPublicKey struct{ testPublicKey }
+type unregisteredPrivateKey struct{ testPrivateKey }
+
+func (k *testKey) ReceiverID() []byte           { return k.id }
+func (k *testKey) Empty() bool                  { return k == nil || len(k.secret) == 0 }
+func (k testPublicKey) Encode() ([]byte, error) { return nil, unsupported("export") }
+func (k testPrivateKey) Encode(password []byte) ([]byte, error) {
+	return nil, unsupported("export")
+}
+func (k testPrivateKey) ExtractPublicKey() (PublicKey, error) {
+	return testPublicKey{k.testKey}, nil
+}
+
+var oidTestKey = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 54811, 99, 1}
+
+type testKeyAlgorithm struct{}
+
+func (a *testKeyAlgorithm) OID() asn1.ObjectIdentifier { return oidTestKey }
+func (a *testKeyAlgorithm) SupportsPublicKey(key PublicKey) bool {
+	_, ok := key.(testPublicKey)
+	return ok
+}
+func (a *testKeyAlgorithm) SupportsPrivateKey(key PrivateKey) bool {
+	_, ok := key.(testPrivateKey)
+	return ok
+}
+func (a *testKeyAlgorithm) DecodePublicKey(der []byte) (PublicKey, error) {
+	return nil, unsupported("import")
+}
+func (a *testKeyAlgorithm) DecodePrivateKey(der []byte) (PrivateKey, error) {
+	return nil, unsupported("import")
+}
+func (a *testKeyAlgorithm) EncryptKey(key PublicKey, symmetricKey []byte) (pkix.AlgorithmIdentifier, []byte, error) {
+	return pkix.AlgorithmIdentifier{Algorithm: oidTestKey}, xorKey(key.(testPublicKey).secret, symmetricKey), nil
+}
+func (a *testKeyAlgorithm) DecryptKey(key PrivateKey, algorithm pkix.AlgorithmIdentifier, encryptedKey []byte) ([]byte, error) {
+	return xorKey(key.(testPrivateKey).secret, encryptedKey), nil
+}
+func (a *testKeyAlgorithm) Sign(hash []byte, key PrivateKey) ([]byte, error) {
+	mac := hmac.New(sha256.New, key.(testPrivateKey).secret)
+	mac.Write(hash)
+	return mac.Sum(nil), nil
+}
+func (a *testKeyAlgorithm) Verify(hash []byte, key PublicKey, signature []byte) (bool, error) {
+	mac := hmac.New(sha256.New, key.(testPublicKey).secret)
+	mac.Write(hash)
+	if !hmac.Equal(mac.Sum(nil), signature) {
+		return false, CryptoError("signature validation failed")
+	}
+	return true, nil
+}
+
+func xorKey(secret, data []byte) []byte {
+	res := make([]byte, len(data))
+	for i := range data {
+		res[i] = data[i] ^ secret[i%len(secret)]
+	}
+	return res
+}
+
+func newTestKeypair() (testPublicKey, testPrivateKey) {
+	k := &testKey{id: make([]byte, 32), secret: make([]byte, 32)}
+	rand.Read(k.id)
+	rand.Read(k.secret)
+	return testPublicKey{k}, testPrivateKey{k}
+}
+
+func TestUnknownKeyType_ReturnsError(t *testing.T) {
+	testPub, testPriv := newTestKeypair()
+	pub, priv := unregisteredPublicKey{testPub}, unregisteredPrivateKey{testPriv}
+	crypto := &VirgilCrypto{Cipher: NewCipher}
+	data := []byte("test data")
+
+	assert.NotPanics(t, func() {
+		_, err := crypto.Encrypt(data, pub)
+		assert.Error(t, err)
+
+		_, err = crypto.Sign(data, priv)
+		assert.Error(t, err)
+
+		kp, err := crypto.GenerateKeypair()
+		assert.NoError(t, err)
+
+		_, err = crypto.SignThenEncrypt(data, priv, kp.PublicKey())
+		assert.Error(t, err)
+
+		prekey, err := SignPrekey(kp.PublicKey(), kp.PrivateKey())
+		assert.NoError(t, err)
+		_, err = X3DHInit(priv, kp.PrivateKey(), kp.PublicKey(), prekey, nil)
+		assert.Error(t, err)
+	})
+}
+
+func registerTestKeyAlgorithm(t *testing.T, algorithm KeyAlgorithm) {
+	assert.NoError(t, RegisterKeyAlgorithm(algorithm))
+	t.Cleanup(func() { unregisterKeyAlgorithm(algorithm) })
+}
+
+func TestRegisterKeyAlgorithm(t *testing.T) {
+	registerTestKeyAlgorithm(t, &testKeyAlgorithm{})
+
+	pub, priv := newTestKeypair()
+	crypto := &VirgilCrypto{Cipher: NewCipher}
+	data := []byte("test data")
+
+	kp, err := crypto.GenerateKeypair()
+	assert.NoError(t, err)
+
+	ciphertext, err := crypto.Encrypt(data, pub, kp.PublicKey())
+	assert.NoError(t, err)
+
+	plaintext, err := crypto.Decrypt(ciphertext, priv)
+	assert.NoError(t, err)
+	assert.Equal(t, data, plaintext)
+
+	plaintext, err = crypto.Decrypt(ciphertext, kp.PrivateKey())
+	assert.NoError(t, err)
+	assert.Equal(t, data, plaintext)
+
+	signature, err := crypto.Sign(data, priv)
+	assert.NoError(t, err)
+	ok, err := crypto.Verify(data, signature, pub)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+
+	ciphertext, err = crypto.SignThenEncrypt(data, priv, kp.PublicKey())
+	assert.NoError(t, err)
+	plaintext, err = crypto.DecryptThenVerify(ciphertext, kp.PrivateKey(), pub)
+	assert.NoError(t, err)
+	assert.Equal(t, data, plaintext)
+
+	//test algorithm does not implement DH
+	prekey, err := SignPrekey(kp.PublicKey(), kp.PrivateKey())
+	assert.NoError(t, err)
+	_, err = X3DHInit(priv, kp.PrivateKey(), kp.PublicKey(), prekey, nil)
+	assert.Error(t, err)
+}
+
+//greedyKeyAlgorithm claims every key, it must not take over the built in ones
+type greedyKeyAlgorithm struct{ testKeyAlgorithm }
+
+var oidGreedyKey = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 54811, 99, 2}
+
+func (a *greedyKeyAlgorithm) OID() asn1.ObjectIdentifier             { return oidGreedyKey }
+func (a *greedyKeyAlgorithm) SupportsPublicKey(key PublicKey) bool   { return true }
+func (a *greedyKeyAlgorithm) SupportsPrivateKey(key PrivateKey) bool { return true }
+
+type ed25519OIDAlgorithm struct{ testKeyAlgorithm }
+
+func (a *ed25519OIDAlgorithm) OID() asn1.ObjectIdentifier { return oidEd25519key }
+
+func TestRegisterKeyAlgorithm_BuiltInsCanNotBeReplaced(t *testing.T) {
+	assert.Error(t, RegisterKeyAlgorithm(&ed25519OIDAlgorithm{}))
+	assert.Error(t, RegisterKeyAlgorithm(nil))
+
+	registerTestKeyAlgorithm(t, &greedyKeyAlgorithm{})
+	assert.Error(t, RegisterKeyAlgorithm(&greedyKeyAlgorithm{}))
+
+	crypto := &VirgilCrypto{Cipher: NewCipher}
+	data := []byte("test data")
+	kp, err := crypto.GenerateKeypair()
+	assert.NoError(t, err)
+
+	ciphertext, err := crypto.SignThenEncrypt(data, kp.PrivateKey(), kp.PublicKey())
+	assert.NoError(t, err)
+	plaintext, err := crypto.DecryptThenVerify(ciphertext, kp.PrivateKey(), kp.PublicKey())
+	assert.NoError(t, err)
+	assert.Equal(t, data, plaintext)
+}
@@ -0,0 +1,268 @@
+package virgilcrypto
+
+import (
+	"crypto/subtle"
+	"encoding/asn1"
+	"fmt"
+)
+
+//The first signature of a message is kept under signatureKey and signerId, so readers which know only one signature still check it.
+//Every next one is kept under the same keys with the "-<index>" suffix, starting with 1
+
+//SignaturePolicy tells DecryptThenVerifyWithPolicy how many of the verifier keys must have signed the message.
+//The zero value requires all of them
+type SignaturePolicy struct {
+	required int
+}
+
+//AllOf requires a valid signature of every verifier key
+func AllOf() SignaturePolicy {
+	return SignaturePolicy{}
+}
+
+//AnyOf requires a valid signature of at least one verifier key
+func AnyOf() SignaturePolicy {
+	return SignaturePolicy{required: 1}
+}
+
+//AtLeast requires valid signatures of at least n different verifier keys, n less than 1 is treated as 1
+func AtLeast(n int) SignaturePolicy {
+	if n < 1 {
+		n = 1
+	}
+	return SignaturePolicy{required: n}
+}
+
+func (p SignaturePolicy) satisfied(verified, verifiers int) bool {
+	if p.required == 0 {
+		return verified == verifiers
+	}
+	return verified >= p.required
+}
+
+type messageSignature struct {
+	signerID  []byte
+	signature []byte
+}
+
+func signatureParamKeys(index int) (signature, signer string) {
+	if index == 0 {
+		return signatureKey, signerId
+	}
+	return fmt.Sprintf("%s-%d", signatureKey, index), fmt.Sprintf("%s-%d", signerId, index)
+}
+
+//makeSignatureParams signs data with every signer and returns custom params starting with the given index
+func makeSignatureParams(data []byte, signers []PrivateKey, index int) (map[string]interface{}, error) {
+	params := make(map[string]interface{})
+	for i, s := range signers {
+		if s == nil || s.Empty() {
+			return nil, CryptoError("no signer key provided")
+		}
+		for _, prev := range signers[:i] {
+			if subtle.ConstantTimeCompare(prev.ReceiverID(), s.ReceiverID()) == 1 {
+				return nil, CryptoError("duplicate signer")
+			}
+		}
+		signature, err := Signer.Sign(data, s)
+		if err != nil {
+			return nil, err
+		}
+		sigKey, idKey := signatureParamKeys(index + i)
+		params[sigKey] = signature
+		params[idKey] = s.ReceiverID()
+	}
+	return params, nil
+}
+
+//decodeSignatures returns all signatures of the message in the order they were added
+func decodeSignatures(customParams map[string]interface{}) ([]messageSignature, error) {
+	var res []messageSignature
+	for i := 0; ; i++ {
+		sigKey, idKey := signatureParamKeys(i)
+		value, ok := customParams[sigKey]
+		if !ok {
+			return res, nil
+		}
+		signature, ok := value.(*[]byte)
+		if !ok {
+			return nil, CryptoError("got signature but could not decode")
+		}
+		var signerID []byte
+		if value, ok := customParams[idKey]; ok {
+			tmp, ok := value.(*[]byte)
+			if !ok {
+				return nil, CryptoError("got signerId but could not decode")
+			}
+			signerID = *tmp
+		} else if i > 0 {
+			return nil, CryptoError("signer id is missing")
+		}
+		res = append(res, messageSignature{signerID: signerID, signature: *signature})
+	}
+}
+
+//verifySignatures returns the verifier keys which have a valid signature of data. Every key is returned once
+func verifySignatures(data []byte, signatures []messageSignature, verifierPublicKeys []PublicKey) []PublicKey {
+	var verified []PublicKey
+	for _, v := range verifierPublicKeys {
+		id := v.ReceiverID()
+		seen := false
+		for _, prev := range verified {
+			if subtle.ConstantTimeCompare(prev.ReceiverID(), id) == 1 {
+				seen = true
+				break
+			}
+		}
+		if seen {
+			continue
+		}
+		for _, s := range signatures {
+			//signatures without id come from old messages, any key is tried for them
+			if len(s.signerID) > 0 && subtle.ConstantTimeCompare(s.signerID, id) != 1 {
+				continue
+			}
+			if res, err := Verifier.Verify(data, v, s.signature); res && err == nil {
+				verified = append(verified, v)
+				break
+			}
+		}
+	}
+	return verified
+}
+
+//uniqueKeys returns the number of distinct keys
+func uniqueKeys(keys []PublicKey) int {
+	n := 0
+	for i, k := range keys {
+		dup := false
+		for _, prev := range keys[:i] {
+			if subtle.ConstantTimeCompare(prev.ReceiverID(), k.ReceiverID()) == 1 {
+				dup = true
+				break
+			}
+		}
+		if !dup {
+			n++
+		}
+	}
+	return n
+}
+
+//SignThenEncryptMultiple signs data with every signer key and encrypts it for the recipients.
+//Readers which support one signature only check the signature of the first signer
+func (c *defaultCipher) SignThenEncryptMultiple(data []byte, signerKeys ...PrivateKey) ([]byte, error) {
+	if len(c.recipients) == 0 {
+		return nil, CryptoError("No recipients specified")
+	}
+	if len(signerKeys) == 0 {
+		return nil, CryptoError("no signer key provided")
+	}
+
+	customParams, err := makeSignatureParams(data, signerKeys, 0)
+	if err != nil {
+		return nil, err
+	}
+	var models []*asn1.RawValue
+
+	content := orAESGCM(c.contentCipher)
+	ciphertext, symmetricKey, nonce, err := encryptData(content, data)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, r := range c.recipients {
+		model, err := r.encryptKey(symmetricKey)
+		if err != nil {
+			return nil, err
+		}
+		models = append(models, model)
+	}
+
+	envelope, err := composeCMSMessage(content, nonce, models, customParams)
+
+	if err != nil {
+		return nil, err
+	}
+	return append(envelope, ciphertext...), nil
+}
+
+//Countersign adds the signature of signerKey to the message produced by SignThenEncrypt, for example by a reviewer after the author.
+//Only a recipient can countersign as the signature covers the plaintext. Existing signatures are not checked
+func (c *defaultCipher) Countersign(data []byte, decryptionKey PrivateKey, signerKey PrivateKey) ([]byte, error) {
+	if decryptionKey == nil || decryptionKey.Empty() {
+		return nil, CryptoError("no keypair provided")
+	}
+
+	customParams, ciphertext, content, nonce, recipients, err := decodeCMSMessage(data)
+	if err != nil {
+		return nil, err
+	}
+	signatures, err := decodeSignatures(customParams)
+	if err != nil {
+		return nil, err
+	}
+	if len(signatures) == 0 {
+		return nil, CryptoError("message is not signed")
+	}
+	if signerKey != nil && !signerKey.Empty() {
+		for _, s := range signatures {
+			if subtle.ConstantTimeCompare(s.signerID, signerKey.ReceiverID()) == 1 {
+				return nil, CryptoError("message is already signed by this key")
+			}
+		}
+	}
+
+	symmetricKey, err := decryptSymmetricKey(recipients, decryptionKey)
+	if err != nil {
+		return nil, err
+	}
+	plaintext, err := decryptData(content, ciphertext, symmetricKey, nonce)
+	if err != nil {
+		return nil, err
+	}
+
+	params, err := makeSignatureParams(plaintext, []PrivateKey{signerKey}, len(signatures))
+	if err != nil {
+		return nil, err
+	}
+	return appendCMSCustomParams(data, params)
+}
+
+//DecryptThenVerifyWithPolicy decrypts the message and checks its signatures against the verifier keys.
+//It returns the verifier keys which have a valid signature, also when the policy is not satisfied
+func (c *defaultCipher) DecryptThenVerifyWithPolicy(data []byte, decryptionKey PrivateKey, policy SignaturePolicy, verifierPublicKeys ...PublicKey) ([]byte, []PublicKey, error) {
+
+	if decryptionKey == nil || decryptionKey.Empty() {
+		return nil, nil, CryptoError("no keypair provided")
+	}
+
+	if len(verifierPublicKeys) == 0 {
+		return nil, nil, CryptoError("no verifiers provided")
+	}
+
+	customParams, ciphertext, content, nonce, recipients, err := decodeCMSMessage(data)
+	if err != nil {
+		return nil, nil, err
+	}
+	signatures, err := decodeSignatures(customParams)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	key, err := decryptSymmetricKey(recipients, decryptionKey)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	data, err = decryptData(content, ciphertext, key, nonce)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	verified := verifySignatures(data, signatures, verifierPublicKeys)
+	if !policy.satisfied(len(verified), uniqueKeys(verifierPublicKeys)) {
+		return nil, verified, CryptoError(fmt.Sprintf("signature policy is not satisfied, %d of %d signers verified", len(verified), uniqueKeys(verifierPublicKeys)))
+	}
+	return data, verified, nil
+}
@@ -0,0 +1,102 @@
+package virgilcrypto
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSignThenEncryptMultiple(t *testing.T) {
+	crypto := DefaultCrypto
+	data := []byte("approved document")
+
+	recipient, err := crypto.GenerateKeypair()
+	assert.NoError(t, err)
+	author, err := crypto.GenerateKeypair()
+	assert.NoError(t, err)
+	reviewer, err := crypto.GenerateKeypair()
+	assert.NoError(t, err)
+	auditor, err := crypto.GenerateKeypair()
+	assert.NoError(t, err)
+
+	ciphertext, err := crypto.SignThenEncryptMultiple(data, []PrivateKey{author.PrivateKey(), reviewer.PrivateKey()}, recipient.PublicKey())
+	assert.NoError(t, err)
+
+	//the first signer is checked by single signature readers
+	plain, err := crypto.DecryptThenVerify(ciphertext, recipient.PrivateKey(), author.PublicKey())
+	assert.NoError(t, err)
+	assert.Equal(t, data, plain)
+	plain, err = crypto.DecryptThenVerify(ciphertext, recipient.PrivateKey(), reviewer.PublicKey())
+	assert.NoError(t, err)
+	assert.Equal(t, data, plain)
+	_, err = crypto.DecryptThenVerify(ciphertext, recipient.PrivateKey(), auditor.PublicKey())
+	assert.Error(t, err)
+
+	plain, verified, err := crypto.DecryptThenVerifyWithPolicy(ciphertext, recipient.PrivateKey(), AllOf(), author.PublicKey(), reviewer.PublicKey())
+	assert.NoError(t, err)
+	assert.Equal(t, data, plain)
+	assert.Equal(t, []PublicKey{author.PublicKey(), reviewer.PublicKey()}, verified)
+
+	plain, verified, err = crypto.DecryptThenVerifyWithPolicy(ciphertext, recipient.PrivateKey(), AllOf(), author.PublicKey(), auditor.PublicKey())
+	assert.Error(t, err)
+	assert.Nil(t, plain)
+	assert.Equal(t, []PublicKey{author.PublicKey()}, verified)
+
+	_, verified, err = crypto.DecryptThenVerifyWithPolicy(ciphertext, recipient.PrivateKey(), AnyOf(), auditor.PublicKey(), reviewer.PublicKey())
+	assert.NoError(t, err)
+	assert.Equal(t, []PublicKey{reviewer.PublicKey()}, verified)
+
+	_, _, err = crypto.DecryptThenVerifyWithPolicy(ciphertext, recipient.PrivateKey(), AtLeast(2), author.PublicKey(), reviewer.PublicKey(), auditor.PublicKey())
+	assert.NoError(t, err)
+	_, _, err = crypto.DecryptThenVerifyWithPolicy(ciphertext, recipient.PrivateKey(), AtLeast(3), author.PublicKey(), reviewer.PublicKey(), auditor.PublicKey())
+	assert.Error(t, err)
+
+	//the same key given twice counts once
+	_, verified, err = crypto.DecryptThenVerifyWithPolicy(ciphertext, recipient.PrivateKey(), AtLeast(2), author.PublicKey(), author.PublicKey())
+	assert.Error(t, err)
+	assert.Len(t, verified, 1)
+
+	_, err = crypto.SignThenEncryptMultiple(data, []PrivateKey{author.PrivateKey(), author.PrivateKey()}, recipient.PublicKey())
+	assert.Error(t, err)
+	_, err = crypto.SignThenEncryptMultiple(data, nil, recipient.PublicKey())
+	assert.Error(t, err)
+}
+
+func TestCountersign(t *testing.T) {
+	crypto := DefaultCrypto
+	data := []byte("approved document")
+
+	author, err := crypto.GenerateKeypair()
+	assert.NoError(t, err)
+	reviewer, err := crypto.GenerateKeypair()
+	assert.NoError(t, err)
+	outsider, err := crypto.GenerateKeypair()
+	assert.NoError(t, err)
+
+	ciphertext, err := crypto.SignThenEncrypt(data, author.PrivateKey(), author.PublicKey(), reviewer.PublicKey())
+	assert.NoError(t, err)
+
+	_, _, err = crypto.DecryptThenVerifyWithPolicy(ciphertext, author.PrivateKey(), AllOf(), author.PublicKey(), reviewer.PublicKey())
+	assert.Error(t, err)
+
+	countersigned, err := crypto.Countersign(ciphertext, reviewer.PrivateKey(), reviewer.PrivateKey())
+	assert.NoError(t, err)
+
+	plain, verified, err := crypto.DecryptThenVerifyWithPolicy(countersigned, author.PrivateKey(), AllOf(), author.PublicKey(), reviewer.PublicKey())
+	assert.NoError(t, err)
+	assert.Equal(t, data, plain)
+	assert.Len(t, verified, 2)
+
+	_, err = crypto.Countersign(countersigned, reviewer.PrivateKey(), reviewer.PrivateKey())
+	assert.Error(t, err)
+
+	//only recipients can countersign
+	_, err = crypto.Countersign(ciphertext, outsider.PrivateKey(), outsider.PrivateKey())
+	assert.Error(t, err)
+
+	//unsigned messages can't be countersigned
+	encrypted, err := crypto.Encrypt(data, reviewer.PublicKey())
+	assert.NoError(t, err)
+	_, err = crypto.Countersign(encrypted, reviewer.PrivateKey(), reviewer.PrivateKey())
+	assert.Error(t, err)
+}
@@ -0,0 +1,183 @@
+package virgilcrypto
+
+import (
+	"crypto/cipher"
+	"io"
+	"runtime"
+	"sync"
+)
+
+//parallelChunkCipher produces the same v2 framing as framedChunkCipher, but seals and opens chunks on a bounded pool of workers.
+//Chunks are read and written by a single goroutine each, so the output keeps the order of the input
+type parallelChunkCipher struct {
+	workers int
+	content ContentCipher
+}
+
+//NewParallelChunkCipher returns a chunk cipher which uses the given number of workers, runtime.NumCPU() if workers < 1.
+//Its output is byte to byte equal to the default one, so it can replace ChunkCipher:
+//
+//	virgilcrypto.ChunkCipher = virgilcrypto.NewParallelChunkCipher(0)
+func NewParallelChunkCipher(workers int) VirgilChunkCipher {
+	if workers < 1 {
+		workers = runtime.NumCPU()
+	}
+	return &parallelChunkCipher{workers: workers}
+}
+
+type chunkJob struct {
+	buf   []byte
+	n     int
+	nonce []byte
+	res   []byte
+	err   error
+	done  chan struct{}
+}
+
+func (c *parallelChunkCipher) WithContentCipher(content ContentCipher) VirgilChunkCipher {
+	return &parallelChunkCipher{workers: c.workers, content: content}
+}
+
+func (c *parallelChunkCipher) Encrypt(key, nonce, ad []byte, chunkSize int, in io.Reader, out io.Writer) error {
+	return c.process(key, nonce, ad, chunkSize, in, out, true)
+}
+
+func (c *parallelChunkCipher) Decrypt(key, nonce, ad []byte, chunkSize int, in io.Reader, out io.Writer) error {
+	return c.process(key, nonce, ad, chunkSize, in, out, false)
+}
+
+func (c *parallelChunkCipher) process(key, nonce, ad []byte, chunkSize int, in io.Reader, out io.Writer, seal bool) error {
+	if chunkSize < 1 {
+		return CryptoError("chunk size too small")
+	}
+
+	//every worker owns its AEAD and reuses it for all the chunks it processes
+	aeads := make([]cipher.AEAD, c.workers)
+	for i := range aeads {
+		aead, err := newChunkAEAD(orAESGCM(c.content), key, nonce)
+		if err != nil {
+			return err
+		}
+		aeads[i] = aead
+	}
+
+	readSize := chunkSize
+	if !seal {
+		readSize += gcmTagSize
+	}
+
+	//queue keeps jobs in the order they must be written and limits the number of chunks in flight.
+	//The reader holds up to two buffers and the writer one more, so the pool never runs dry
+	jobs := make(chan *chunkJob)
+	queue := make(chan *chunkJob, 2*c.workers)
+	free := make(chan []byte, cap(queue)+3)
+	for i := 0; i < cap(free); i++ {
+		free <- make([]byte, chunkSize+gcmTagSize)
+	}
+	stop := make(chan struct{})
+
+	var wg sync.WaitGroup
+	wg.Add(c.workers)
+	for _, aead := range aeads {
+		go func(aead cipher.AEAD) {
+			defer wg.Done()
+			for job := range jobs {
+				if seal {
+					job.res = aead.Seal(job.buf[:0], job.nonce, job.buf[:job.n], ad)
+				} else if job.res, job.err = aead.Open(job.buf[:0], job.nonce, job.buf[:job.n], ad); job.err != nil {
+					job.err = CryptoError("chunk authentication failed, the stream is corrupted or truncated")
+				}
+				close(job.done)
+			}
+		}(aead)
+	}
+
+	written := make(chan error, 1)
+	go func() {
+		var err error
+		for job := range queue {
+			<-job.done
+			if err == nil {
+				if err = job.err; err == nil {
+					err = writeChunk(out, job.res)
+				}
+				if err != nil {
+					close(stop)
+				}
+			}
+			free <- job.buf
+		}
+		written <- err
+	}()
+
+	err := c.read(nonce, readSize, in, seal, jobs, queue, free, stop)
+
+	close(jobs)
+	close(queue)
+	writeErr := <-written
+	wg.Wait()
+
+	if writeErr != nil {
+		return writeErr
+	}
+	return err
+}
+
+//read splits the input into chunks and hands them to the workers. It returns nil if the writer has failed, as the writer reports its own error
+func (c *parallelChunkCipher) read(nonce []byte, readSize int, in io.Reader, seal bool,
+	jobs, queue chan<- *chunkJob, free chan []byte, stop <-chan struct{}) error {
+
+	var buf []byte
+	select {
+	case buf = <-free:
+	case <-stop:
+		return nil
+	}
+	n, err := readChunk(in, buf[:readSize])
+	if err != nil {
+		return err
+	}
+	for counter := uint64(0); ; counter++ {
+		if !seal && n < gcmTagSize {
+			return CryptoError("stream is truncated")
+		}
+
+		//the chunk is the last one if the next read returns nothing
+		var next []byte
+		m := 0
+		if n == readSize {
+			select {
+			case next = <-free:
+			case <-stop:
+				return nil
+			}
+			if m, err = readChunk(in, next[:readSize]); err != nil {
+				return err
+			}
+		}
+		last := m == 0
+		if last && next != nil {
+			free <- next
+		}
+
+		job := &chunkJob{buf: buf, n: n, nonce: make([]byte, len(nonce)), done: make(chan struct{})}
+		framedChunkNonce(job.nonce, nonce, counter, last)
+
+		//a job is queued for writing only after a worker has it, so the writer never waits for a job nobody processes
+		select {
+		case jobs <- job:
+		case <-stop:
+			return nil
+		}
+		select {
+		case queue <- job:
+		case <-stop:
+			return nil
+		}
+
+		if last {
+			return nil
+		}
+		buf, n = next, m
+	}
+}
@@ -0,0 +1,242 @@
+package virgilcrypto
+
+/*
+Copyright (C) 2016-2017 Virgil Security Inc.
+
+Lead Maintainer: Virgil Security Inc. <support@virgilsecurity.com>
+
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions
+are met:
+
+  (1) Redistributions of source code must retain the above copyright
+  notice, this list of conditions and the following disclaimer.
+
+  (2) Redistributions in binary form must reproduce the above copyright
+  notice, this list of conditions and the following disclaimer in
+  the documentation and/or other materials provided with the
+  distribution.
+
+  (3) Neither the name of the copyright holder nor the names of its
+  contributors may be used to endorse or promote products derived
+  from this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE AUTHOR ''AS IS'' AND ANY EXPRESS OR
+IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY DIRECT,
+INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+(INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT,
+STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING
+IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+POSSIBILITY OF SUCH DAMAGE.
+*/
+import (
+	"crypto/rand"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"math/big"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/pbkdf2"
+	"golang.org/x/crypto/scrypt"
+)
+
+//VirgilPasswordKDF derives key encryption keys from passwords for password recipients and encrypted private keys.
+//All parameters needed to derive the key again are stored in the keyDerivationFunc of PBES2 AlgorithmIdentifier
+type VirgilPasswordKDF interface {
+	DeriveKey(password []byte, keyLen int) (key []byte, keyDerivationFunc pkix.AlgorithmIdentifier, err error)
+}
+
+//PasswordKDF is used for all new password recipients and encrypted private keys
+var PasswordKDF VirgilPasswordKDF
+
+const kdfSaltSize = 16
+
+//Limits protect decryption from the parameters which would take too much memory or time.
+//Single parameters are bounded along with the memory and the work they take together
+const (
+	maxArgon2Time   = 64
+	maxArgon2Memory = 2 * 1024 * 1024 //KiB
+	maxArgon2Work   = 1 << 23         //memory in KiB × passes, e.g. 2 GiB × 4 or 64 MiB × 64
+	maxScryptN      = 1 << 22
+	maxScryptRP     = 1 << 20
+	maxScryptMemory = 1 << 30 //bytes, scrypt takes 128·N·r
+	maxScryptWork   = 1 << 26 //N·r·p
+	minPbkdf2Rounds = 3072
+	maxPbkdf2Rounds = 8192
+	maxKdfKeyLength = 64
+)
+
+type argon2idParams struct {
+	Salt        []byte
+	Iterations  int
+	Memory      int
+	Parallelism int
+}
+
+//scryptParams as defined in RFC 7914
+type scryptParams struct {
+	Salt                     []byte
+	CostParameter            int
+	BlockSize                int
+	ParallelizationParameter int
+	KeyLength                int `asn1:"optional"`
+}
+
+type argon2idKDF struct {
+	time, memory uint32
+	threads      uint8
+}
+
+//NewArgon2idKDF returns Argon2id KDF. memory is in KiB
+func NewArgon2idKDF(time, memory uint32, threads uint8) (VirgilPasswordKDF, error) {
+	params := argon2idParams{Salt: make([]byte, kdfSaltSize), Iterations: int(time), Memory: int(memory), Parallelism: int(threads)}
+	if err := params.Validate(); err != nil {
+		return nil, err
+	}
+	return &argon2idKDF{time: time, memory: memory, threads: threads}, nil
+}
+
+func (k *argon2idKDF) DeriveKey(password []byte, keyLen int) ([]byte, pkix.AlgorithmIdentifier, error) {
+	params := argon2idParams{
+		Salt:        randomSalt(),
+		Iterations:  int(k.time),
+		Memory:      int(k.memory),
+		Parallelism: int(k.threads),
+	}
+	alg, err := makeKdfAlgorithm(oidArgon2id, params)
+	if err != nil {
+		return nil, alg, err
+	}
+	return params.deriveKey(password, keyLen), alg, nil
+}
+
+func (p *argon2idParams) deriveKey(password []byte, keyLen int) []byte {
+	return argon2.IDKey(password, p.Salt, uint32(p.Iterations), uint32(p.Memory), uint8(p.Parallelism), uint32(keyLen))
+}
+
+type scryptKDF struct {
+	n, r, p int
+}
+
+//NewScryptKDF returns scrypt KDF. n must be a power of two
+func NewScryptKDF(n, r, p int) (VirgilPasswordKDF, error) {
+	params := scryptParams{Salt: make([]byte, kdfSaltSize), CostParameter: n, BlockSize: r, ParallelizationParameter: p}
+	if err := params.Validate(); err != nil {
+		return nil, err
+	}
+	return &scryptKDF{n: n, r: r, p: p}, nil
+}
+
+func (k *scryptKDF) DeriveKey(password []byte, keyLen int) ([]byte, pkix.AlgorithmIdentifier, error) {
+	params := scryptParams{
+		Salt:                     randomSalt(),
+		CostParameter:            k.n,
+		BlockSize:                k.r,
+		ParallelizationParameter: k.p,
+		KeyLength:                keyLen,
+	}
+	alg, err := makeKdfAlgorithm(oidScrypt, params)
+	if err != nil {
+		return nil, alg, err
+	}
+	key, err := params.deriveKey(password, keyLen)
+	return key, alg, err
+}
+
+func (p *scryptParams) deriveKey(password []byte, keyLen int) ([]byte, error) {
+	key, err := scrypt.Key(password, p.Salt, p.CostParameter, p.BlockSize, p.ParallelizationParameter, keyLen)
+	if err != nil {
+		return nil, cryptoError(err, "")
+	}
+	return key, nil
+}
+
+//pbkdf2KDF is the legacy KDF with random iterations count, it is kept for compatibility
+type pbkdf2KDF struct{}
+
+func (k *pbkdf2KDF) DeriveKey(password []byte, keyLen int) ([]byte, pkix.AlgorithmIdentifier, error) {
+	randomIterationsPart, _ := rand.Int(rand.Reader, big.NewInt(maxPbkdf2Rounds-minPbkdf2Rounds+1))
+	params := pkdf2Params{
+		Salt:            randomSalt(),
+		IterationsCount: minPbkdf2Rounds + int(randomIterationsPart.Int64()),
+		Prf:             algorithmIdentifier{Algorithm: oidHmacWithSha384},
+	}
+	alg, err := makeKdfAlgorithm(oidPbkdf2, params)
+	if err != nil {
+		return nil, alg, err
+	}
+	return params.deriveKey(password, keyLen), alg, nil
+}
+
+func (p *pkdf2Params) deriveKey(password []byte, keyLen int) []byte {
+	return pbkdf2.Key(password, p.Salt, p.IterationsCount, keyLen, Hash.New)
+}
+
+func randomSalt() []byte {
+	salt := make([]byte, kdfSaltSize)
+	rand.Read(salt)
+	return salt
+}
+
+func makeKdfAlgorithm(oid asn1.ObjectIdentifier, params interface{}) (pkix.AlgorithmIdentifier, error) {
+	serializedParams, err := asn1.Marshal(params)
+	if err != nil {
+		return pkix.AlgorithmIdentifier{}, cryptoError(err, "")
+	}
+	return pkix.AlgorithmIdentifier{
+		Algorithm:  oid,
+		Parameters: asn1.RawValue{FullBytes: serializedParams},
+	}, nil
+}
+
+//deriveKeyWithAlgorithm derives the key again using parameters from keyDerivationFunc
+func deriveKeyWithAlgorithm(password []byte, keyDerivationFunc pkix.AlgorithmIdentifier, keyLen int) ([]byte, error) {
+	if keyLen > maxKdfKeyLength {
+		return nil, unsupported("key length")
+	}
+	var params validator
+	switch {
+	case keyDerivationFunc.Algorithm.Equal(oidPbkdf2):
+		params = &pkdf2Params{}
+	case keyDerivationFunc.Algorithm.Equal(oidScrypt):
+		params = &scryptParams{}
+	case keyDerivationFunc.Algorithm.Equal(oidArgon2id):
+		params = &argon2idParams{}
+	default:
+		return nil, unsupported("kdf algorithm")
+	}
+
+	rest, err := asn1.Unmarshal(keyDerivationFunc.Parameters.FullBytes, params)
+	if err != nil {
+		return nil, cryptoError(err, "")
+	}
+	if len(rest) != 0 {
+		return nil, unsupported("kdf parameters")
+	}
+	if err = params.Validate(); err != nil {
+		return nil, err
+	}
+
+	switch p := params.(type) {
+	case *pkdf2Params:
+		return p.deriveKey(password, keyLen), nil
+	case *scryptParams:
+		if p.KeyLength != 0 && p.KeyLength != keyLen {
+			return nil, unsupported("kdf key length")
+		}
+		return p.deriveKey(password, keyLen)
+	default:
+		return params.(*argon2idParams).deriveKey(password, keyLen), nil
+	}
+}
+
+func init() {
+	//RFC 9106 second recommended option
+	PasswordKDF = &argon2idKDF{time: 3, memory: 64 * 1024, threads: 4}
+}
@@ -0,0 +1,139 @@
+package virgilcrypto
+
+import (
+	"bytes"
+	"encoding/asn1"
+	"encoding/base64"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+//encrypted with PBKDF2-HMAC-SHA384 by the previous versions
+const (
+	legacyPassword           = "legacy password"
+	legacyEncryptedKey       = "MIGhMF0GCSqGSIb3DQEFDTBQMC8GCSqGSIb3DQEFDDAiBBD11mLepdvga+O1Bw47VEDTAgIeVzAKBggqhkiG9w0CCjAdBglghkgBZQMEASoEEO7A8t3m+sbkQ+dJuN53Z2oEQLnbrfQXQjKPaZTlfLiaXqRhLdVv6Ng65wyWZkhvqir+q9bBonTyVzy3kmBduClExbhmkB828ajvgcLP27arncE="
+	legacyPublicKey          = "MCowBQYDK2VwAyEAEIaEGoN1tn0oerTfzTV5Xf6XDAT2BEZBhn5hoRTgg5w="
+	legacyPasswordCiphertext = "MIHfAgEAMIHZBgkqhkiG9w0BBwOggcswgcgCAQIxgZqjgZcwgZQCAQAwXQYJKoZIhvcNAQUNMFAwLwYJKoZIhvcNAQUMMCIEEGrD43wyU9aF5lDBwt9Ku3ICAhbaMAoGCCqGSIb3DQIKMB0GCWCGSAFlAwQBKgQQZb/UzZYwokWHnAINquVCFAQw1MPWogeaqnwgzuXDbH2eftROCCACHHeYir1NUZXAvRzdhudAz5yIpzdqZ+ExqLhfMCYGCSqGSIb3DQEHATAZBglghkgBZQMEAS4EDPxqD1moh+4BBPqIE7WX0GKlGiEl6lXBvAAgeEZB1N69bc6MbRC5zA=="
+)
+
+func TestLegacyPBKDF2(t *testing.T) {
+	keyBytes, _ := base64.StdEncoding.DecodeString(legacyEncryptedKey)
+	pubBytes, _ := base64.StdEncoding.DecodeString(legacyPublicKey)
+
+	key, err := DecodePrivateKey(keyBytes, []byte(legacyPassword))
+	assert.NoError(t, err)
+
+	pub, err := DecodePublicKey(pubBytes)
+	assert.NoError(t, err)
+	assert.Equal(t, pub.ReceiverID(), key.ReceiverID())
+
+	_, err = DecodePrivateKey(keyBytes, []byte("wrong password"))
+	assert.Error(t, err)
+
+	ciphertext, _ := base64.StdEncoding.DecodeString(legacyPasswordCiphertext)
+	plaintext, err := NewCipher().DecryptWithPassword(ciphertext, []byte(legacyPassword))
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("legacy data"), plaintext)
+}
+
+func TestPasswordKDF(t *testing.T) {
+	defer func(kdf VirgilPasswordKDF) { PasswordKDF = kdf }(PasswordKDF)
+
+	argon, err := NewArgon2idKDF(1, 1024, 1)
+	assert.NoError(t, err)
+	scrypt, err := NewScryptKDF(1024, 8, 1)
+	assert.NoError(t, err)
+
+	keypair, err := NewKeypair()
+	assert.NoError(t, err)
+	data := []byte("test data")
+
+	for _, kdf := range []VirgilPasswordKDF{argon, scrypt, &pbkdf2KDF{}} {
+		PasswordKDF = kdf
+
+		encoded, err := keypair.PrivateKey().Encode([]byte("password"))
+		assert.NoError(t, err)
+
+		key, err := DecodePrivateKey(encoded, []byte("password"))
+		assert.NoError(t, err)
+		assert.Equal(t, keypair.PrivateKey().ReceiverID(), key.ReceiverID())
+
+		_, err = DecodePrivateKey(encoded, []byte("wrong password"))
+		assert.Error(t, err)
+
+		cipher := NewCipher()
+		cipher.AddPasswordRecipient([]byte("password"))
+		ciphertext, err := cipher.Encrypt(data)
+		assert.NoError(t, err)
+
+		plaintext, err := NewCipher().DecryptWithPassword(ciphertext, []byte("password"))
+		assert.NoError(t, err)
+		assert.True(t, bytes.Equal(data, plaintext))
+	}
+}
+
+func TestPasswordKDF_Limits(t *testing.T) {
+	_, err := NewArgon2idKDF(1, maxArgon2Memory+1, 1)
+	assert.Error(t, err)
+	_, err = NewArgon2idKDF(0, 1024, 1)
+	assert.Error(t, err)
+	_, err = NewScryptKDF(1000, 8, 1)
+	assert.Error(t, err)
+	_, err = NewScryptKDF(maxScryptN*2, 8, 1)
+	assert.Error(t, err)
+
+	//parameters which came with the data are checked before deriving the key
+	alg, err := makeKdfAlgorithm(oidArgon2id, argon2idParams{Salt: randomSalt(), Iterations: 1, Memory: maxArgon2Memory * 2, Parallelism: 1})
+	assert.NoError(t, err)
+	_, err = deriveKeyWithAlgorithm([]byte("password"), alg, 32)
+	assert.Error(t, err)
+
+	//each parameter is within its limit, but together they take too much memory or time
+	for _, hostile := range []struct {
+		oid    asn1.ObjectIdentifier
+		params interface{}
+	}{
+		{oidScrypt, scryptParams{Salt: randomSalt(), CostParameter: maxScryptN, BlockSize: 1024, ParallelizationParameter: 1}},
+		{oidScrypt, scryptParams{Salt: randomSalt(), CostParameter: 1 << 16, BlockSize: 8, ParallelizationParameter: 1 << 16}},
+		{oidArgon2id, argon2idParams{Salt: randomSalt(), Iterations: maxArgon2Time, Memory: maxArgon2Memory, Parallelism: 1}},
+	} {
+		alg, err := makeKdfAlgorithm(hostile.oid, hostile.params)
+		assert.NoError(t, err)
+		_, err = deriveKeyWithAlgorithm([]byte("password"), alg, 32)
+		assert.Error(t, err)
+	}
+	_, err = NewScryptKDF(maxScryptN, 8, 1)
+	assert.Error(t, err)
+	_, err = NewArgon2idKDF(maxArgon2Time, maxArgon2Memory, 1)
+	assert.Error(t, err)
+
+	alg.Algorithm = asn1.ObjectIdentifier{1, 2, 3}
+	_, err = deriveKeyWithAlgorithm([]byte("password"), alg, 32)
+	assert.Error(t, err)
+}
+
+func TestPasswordKeyWrap(t *testing.T) {
+	keypair, err := NewKeypair()
+	assert.NoError(t, err)
+
+	encoded, err := keypair.PrivateKey().Encode([]byte("password"))
+	assert.NoError(t, err)
+
+	envelope := &envelopeKey{}
+	_, err = asn1.Unmarshal(encoded, envelope)
+	assert.NoError(t, err)
+	scheme, _, err := decodeKeyEncryptionAlgorithm(&envelope.Algorithm)
+	assert.NoError(t, err)
+	assert.True(t, scheme.Algorithm.Equal(oidAesGCM))
+
+	_, err = DecodePrivateKey(encoded, []byte("wrong password"))
+	assert.IsType(t, &WrongPasswordError{}, err)
+
+	//any modification of the wrapped key is detected
+	envelope.CipherText[len(envelope.CipherText)-1] ^= 1
+	tampered, err := asn1.Marshal(*envelope)
+	assert.NoError(t, err)
+	_, err = DecodePrivateKey(tampered, []byte("password"))
+	assert.IsType(t, &WrongPasswordError{}, err)
+}
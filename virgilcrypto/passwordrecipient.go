@@ -39,57 +39,74 @@ import (
 	"crypto/aes"
 	"crypto/cipher"
 	"crypto/rand"
+	"crypto/x509/pkix"
 	"encoding/asn1"
-	"math/big"
-
-	"golang.org/x/crypto/pbkdf2"
 )
 
 type passwordRecipient struct {
-	Password            []byte
-	kdfIv               []byte
-	iterations          int
-	encryptedKey, keyIv []byte
+	Password          []byte
+	keyDerivationFunc pkix.AlgorithmIdentifier
+	encryptionScheme  algorithmIdentifier
+	encryptedKey      []byte
 }
 
 func (p *passwordRecipient) encryptKey(symmetricKey []byte) (*asn1.RawValue, error) {
-	kdfIv, iterations, keyIv, encryptedKey := encryptKeyWithPassword(symmetricKey, []byte(p.Password))
-	return makePasswordRecipient(kdfIv, iterations, encryptedKey, keyIv)
-}
-func (p *passwordRecipient) decryptKey(id []byte, password []byte) ([]byte, error) {
-	if len(id) > 0 {
-		return nil, CryptoError("Wrong recepient")
+	keyDerivationFunc, encryptionScheme, encryptedKey, err := encryptKeyWithPassword(symmetricKey, []byte(p.Password))
+	if err != nil {
+		return nil, err
 	}
-	return decryptKeyWithPassword(p.encryptedKey, p.keyIv, p.kdfIv, p.iterations, password)
+	return makePasswordRecipient(keyDerivationFunc, encryptionScheme, encryptedKey)
+}
+func (p *passwordRecipient) decryptKey(password []byte) ([]byte, error) {
+	return decryptKeyWithPassword(p.encryptedKey, p.encryptionScheme, p.keyDerivationFunc, password)
 }
-func encryptKeyWithPassword(randomKey, password []byte) (kdfIv []byte, iterations int, keyIv, encryptedKey []byte) {
-
-	kdfIv = make([]byte, 16)
-	keyIv = make([]byte, 16)
 
-	rand.Read(kdfIv)
-	rand.Read(keyIv)
+//encryptKeyWithPassword wraps the key with AES-256-GCM so that a wrong password or modified data are always detected
+func encryptKeyWithPassword(randomKey, password []byte) (keyDerivationFunc pkix.AlgorithmIdentifier, encryptionScheme algorithmIdentifier, encryptedKey []byte, err error) {
 
-	randomIterationsPart, _ := rand.Int(rand.Reader, big.NewInt(5121))
-	iterations = 3072 + int(randomIterationsPart.Int64())
+	nonce := make([]byte, 12)
+	rand.Read(nonce)
 
 	//generate key for random key encryption based on password
-	keyEncryptionKey := pbkdf2.Key(password, kdfIv, iterations, 32, Hash.New)
+	keyEncryptionKey, keyDerivationFunc, err := PasswordKDF.DeriveKey(password, 32)
+	if err != nil {
+		return
+	}
 
 	ciph, _ := aes.NewCipher(keyEncryptionKey)
-	aesCBC := cipher.NewCBCEncrypter(ciph, keyIv)
-	paddedKey, _ := pkcs7Pad(randomKey, aesCBC.BlockSize())
-	encryptedKey = make([]byte, len(paddedKey))
-	aesCBC.CryptBlocks(encryptedKey, paddedKey)
+	aesGCM, _ := cipher.NewGCM(ciph)
+	encryptedKey = aesGCM.Seal(nil, nonce, randomKey, nil)
 
+	encryptionScheme = algorithmIdentifier{
+		Algorithm:  oidAesGCM,
+		Parameters: nonce,
+	}
 	return
 }
-func decryptKeyWithPassword(encryptedKey, keyIv, kdfIv []byte, iterations int, password []byte) ([]byte, error) {
 
-	keyEncryptionKey := pbkdf2.Key(password, kdfIv, iterations, 32, Hash.New)
+//decryptKeyWithPassword supports AES-256-GCM and legacy AES-256-CBC key wrapping
+func decryptKeyWithPassword(encryptedKey []byte, encryptionScheme algorithmIdentifier, keyDerivationFunc pkix.AlgorithmIdentifier, password []byte) ([]byte, error) {
+
+	keyEncryptionKey, err := deriveKeyWithAlgorithm(password, keyDerivationFunc, 32)
+	if err != nil {
+		return nil, err
+	}
 
 	ciph, _ := aes.NewCipher(keyEncryptionKey)
-	aesCBC := cipher.NewCBCDecrypter(ciph, keyIv)
+
+	if encryptionScheme.Algorithm.Equal(oidAesGCM) {
+		aesGCM, _ := cipher.NewGCM(ciph)
+		key, err := aesGCM.Open(nil, encryptionScheme.Parameters, encryptedKey, nil)
+		if err != nil {
+			return nil, &WrongPasswordError{"could not decrypt key with password"}
+		}
+		return key, nil
+	}
+
+	if len(encryptedKey) == 0 || len(encryptedKey)%aes.BlockSize != 0 {
+		return nil, unsupported("encrypted key size")
+	}
+	aesCBC := cipher.NewCBCDecrypter(ciph, encryptionScheme.Parameters)
 	paddedKey := make([]byte, len(encryptedKey))
 	aesCBC.CryptBlocks(paddedKey, encryptedKey)
 
@@ -1,9 +1,12 @@
 package virgilcrypto
 
 import (
+	"bytes"
 	"crypto/aes"
 	"crypto/cipher"
 	"crypto/rand"
+	"encoding/asn1"
+	"encoding/json"
 
 	"github.com/minio/sha256-simd"
 	"golang.org/x/crypto/hkdf"
@@ -15,14 +18,41 @@ type (
 	}
 
 	PFS interface {
-		StartInitiatorSession(ICb, LTCb, OTCb PublicKey, ICa, EKa PrivateKey, aliceCardId, bobCardId string) (sess *PFSSession, err error)
+		StartInitiatorSession(ICb PublicKey, LTCb, OTCb *PrekeyCard, ICa, EKa PrivateKey, aliceCardId, bobCardId string) (sess *PFSSession, err error)
 		StartResponderSession(ICa, EKa PublicKey, ICb, LTCb, OTCb PrivateKey, aliceCardId, bobCardId string) (sess *PFSSession, err error)
 	}
 )
 
 var virgil = []byte("Virgil")
 
-func (c *VirgilCrypto) StartInitiatorSession(ICb, LTCb, OTCb PublicKey, ICa, EKa PrivateKey, aliceCardId, bobCardId string) (sess *PFSSession, err error) {
+const (
+	pfsSessionVersion = 1
+	//PFSSessionKeySize is the size of the key which protects sessions at rest
+	PFSSessionKeySize = 32
+)
+
+type (
+	pfsSessionASN1 struct {
+		Version           int
+		SK, AD, SessionID []byte
+	}
+
+	pfsSessionJSON struct {
+		Version   int    `json:"version"`
+		SK        []byte `json:"sk"`
+		AD        []byte `json:"ad"`
+		SessionID []byte `json:"session_id"`
+	}
+
+	encryptedPFSSession struct {
+		Version    int
+		SessionID  []byte
+		Nonce      []byte
+		Ciphertext []byte
+	}
+)
+
+func (c *VirgilCrypto) StartInitiatorSession(ICb PublicKey, LTCb, OTCb *PrekeyCard, ICa, EKa PrivateKey, aliceCardId, bobCardId string) (sess *PFSSession, err error) {
 
 	sk, err := X3DHInit(ICa, EKa, ICb, LTCb, OTCb)
 	if err != nil {
@@ -105,3 +135,147 @@ func (s *PFSSession) Decrypt(salt, ciphertext []byte) ([]byte, error) {
 	aesGCM, _ := cipher.NewGCM(ciph)
 	return aesGCM.Open(nil, keyAndNonce[32:], ciphertext, s.AD)
 }
+
+func (s *PFSSession) MarshalBinary() ([]byte, error) {
+	sess := pfsSessionASN1{
+		Version:   pfsSessionVersion,
+		SK:        s.SK,
+		AD:        s.AD,
+		SessionID: s.SessionID,
+	}
+	if err := sess.Validate(); err != nil {
+		return nil, err
+	}
+	res, err := asn1.Marshal(sess)
+	if err != nil {
+		return nil, cryptoError(err, "")
+	}
+	return res, nil
+}
+
+func (s *PFSSession) UnmarshalBinary(data []byte) error {
+	sess := &pfsSessionASN1{}
+	rest, err := asn1.Unmarshal(data, sess)
+	if err != nil {
+		return cryptoError(err, "")
+	}
+	if len(rest) != 0 {
+		return CryptoError("Some data is left after session parsing")
+	}
+	if err = sess.Validate(); err != nil {
+		return err
+	}
+	s.SK, s.AD, s.SessionID = sess.SK, sess.AD, sess.SessionID
+	return nil
+}
+
+func (s *PFSSession) MarshalJSON() ([]byte, error) {
+	return json.Marshal(pfsSessionJSON{
+		Version:   pfsSessionVersion,
+		SK:        s.SK,
+		AD:        s.AD,
+		SessionID: s.SessionID,
+	})
+}
+
+func (s *PFSSession) UnmarshalJSON(data []byte) error {
+	sess := &pfsSessionJSON{}
+	if err := json.Unmarshal(data, sess); err != nil {
+		return cryptoError(err, "")
+	}
+	if err := (&pfsSessionASN1{sess.Version, sess.SK, sess.AD, sess.SessionID}).Validate(); err != nil {
+		return err
+	}
+	s.SK, s.AD, s.SessionID = sess.SK, sess.AD, sess.SessionID
+	return nil
+}
+
+//EncryptPFSSession serializes the session and encrypts it with AES-256-GCM so it can be stored at rest.
+//SessionID stays in clear and is authenticated along with the ciphertext
+func EncryptPFSSession(s *PFSSession, key []byte) ([]byte, error) {
+	data, err := s.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	return EncryptSessionState(s.SessionID, data, key)
+}
+
+func DecryptPFSSession(data, key []byte) (*PFSSession, error) {
+	sessionID, plaintext, err := DecryptSessionState(data, key)
+	if err != nil {
+		return nil, err
+	}
+
+	sess := &PFSSession{}
+	if err = sess.UnmarshalBinary(plaintext); err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(sess.SessionID, sessionID) {
+		return nil, CryptoError("session id mismatch")
+	}
+	return sess, nil
+}
+
+//EncryptSessionState encrypts opaque state of the session, such as RatchetSession.Marshal output, the same way as EncryptPFSSession
+func EncryptSessionState(sessionID, state, key []byte) ([]byte, error) {
+	if len(sessionID) == 0 {
+		return nil, CryptoError("session id is empty")
+	}
+	aesGCM, err := sessionCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, aesGCM.NonceSize())
+	if _, err = rand.Read(nonce); err != nil {
+		return nil, cryptoError(err, "")
+	}
+
+	res, err := asn1.Marshal(encryptedPFSSession{
+		Version:    pfsSessionVersion,
+		SessionID:  sessionID,
+		Nonce:      nonce,
+		Ciphertext: aesGCM.Seal(nil, nonce, state, sessionID),
+	})
+	if err != nil {
+		return nil, cryptoError(err, "")
+	}
+	return res, nil
+}
+
+func DecryptSessionState(data, key []byte) (sessionID, state []byte, err error) {
+	aesGCM, err := sessionCipher(key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	enc := &encryptedPFSSession{}
+	rest, err := asn1.Unmarshal(data, enc)
+	if err != nil {
+		return nil, nil, cryptoError(err, "")
+	}
+	if len(rest) != 0 {
+		return nil, nil, CryptoError("Some data is left after session parsing")
+	}
+	if enc.Version != pfsSessionVersion {
+		return nil, nil, unsupported("session version")
+	}
+	if len(enc.Nonce) != aesGCM.NonceSize() {
+		return nil, nil, unsupported("nonce size")
+	}
+
+	state, err = aesGCM.Open(nil, enc.Nonce, enc.Ciphertext, enc.SessionID)
+	if err != nil {
+		return nil, nil, CryptoError("could not decrypt session")
+	}
+	return enc.SessionID, state, nil
+}
+
+func sessionCipher(key []byte) (cipher.AEAD, error) {
+	if len(key) != PFSSessionKeySize {
+		return nil, CryptoError("session key must be 32 bytes long")
+	}
+	ciph, _ := aes.NewCipher(key)
+	aesGCM, _ := cipher.NewGCM(ciph)
+	return aesGCM, nil
+}
@@ -2,6 +2,7 @@ package virgilcrypto
 
 import (
 	"encoding/hex"
+	"encoding/json"
 	"testing"
 
 	"crypto/rand"
@@ -41,7 +42,13 @@ func TestPFS(t *testing.T) {
 	aliceCardID := hex.EncodeToString(ICa.PublicKey().ReceiverID())
 	bobCardID := hex.EncodeToString(ICb.PublicKey().ReceiverID())
 
-	sessA, err := pfs.StartInitiatorSession(ICb.PublicKey(), LTCb.PublicKey(), OTCb.PublicKey(), ICa.PrivateKey(), EKa.PrivateKey(), aliceCardID, bobCardID)
+	signedLTCb, err := SignPrekey(LTCb.PublicKey(), ICb.PrivateKey())
+	assert.NoError(t, err)
+
+	signedOTCb, err := SignPrekey(OTCb.PublicKey(), ICb.PrivateKey())
+	assert.NoError(t, err)
+
+	sessA, err := pfs.StartInitiatorSession(ICb.PublicKey(), signedLTCb, signedOTCb, ICa.PrivateKey(), EKa.PrivateKey(), aliceCardID, bobCardID)
 	assert.NoError(t, err)
 
 	sessB, err := pfs.StartResponderSession(ICa.PublicKey(), EKa.PublicKey(), ICb.PrivateKey(), LTCb.PrivateKey(), OTCb.PrivateKey(), aliceCardID, bobCardID)
@@ -88,3 +95,42 @@ func TestPFS(t *testing.T) {
 	res, _ := json.Marshal(vec)
 	fmt.Printf("%s\n", res)*/
 }
+
+func TestPFSSession_Marshal(t *testing.T) {
+	sess := &PFSSession{SK: make([]byte, 32), AD: make([]byte, 32), SessionID: make([]byte, 32)}
+	rand.Read(sess.SK)
+	rand.Read(sess.AD)
+	rand.Read(sess.SessionID)
+
+	data, err := sess.MarshalBinary()
+	assert.NoError(t, err)
+	restored := &PFSSession{}
+	assert.NoError(t, restored.UnmarshalBinary(data))
+	assert.Equal(t, sess, restored)
+
+	data, err = json.Marshal(sess)
+	assert.NoError(t, err)
+	restored = &PFSSession{}
+	assert.NoError(t, json.Unmarshal(data, restored))
+	assert.Equal(t, sess, restored)
+
+	assert.Error(t, json.Unmarshal([]byte(`{"version":2,"sk":"AQ==","ad":"AQ==","session_id":"AQ=="}`), restored))
+	_, err = (&PFSSession{}).MarshalBinary()
+	assert.Error(t, err)
+
+	key := make([]byte, PFSSessionKeySize)
+	rand.Read(key)
+
+	data, err = EncryptPFSSession(sess, key)
+	assert.NoError(t, err)
+	restored, err = DecryptPFSSession(data, key)
+	assert.NoError(t, err)
+	assert.Equal(t, sess, restored)
+
+	_, err = EncryptPFSSession(sess, key[:16])
+	assert.Error(t, err)
+
+	data[len(data)-1] ^= 1
+	_, err = DecryptPFSSession(data, key)
+	assert.Error(t, err)
+}
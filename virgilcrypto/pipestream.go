@@ -0,0 +1,99 @@
+package virgilcrypto
+
+import (
+	"io"
+	"sync"
+)
+
+//encryptingWriter feeds the data written to it into EncryptStream running in the background
+type encryptingWriter struct {
+	pw     *io.PipeWriter
+	err    error
+	done   chan error
+	closed bool
+}
+
+//NewEncryptingWriter returns a writer which encrypts everything written to it for the recipients and writes the result to out.
+//The output is the same as of EncryptStream. Close must be called to write the last chunk, it does not close out.
+//Errors, including invalid recipients, are returned by Write and Close
+func NewEncryptingWriter(out io.Writer, recipients ...PublicKey) io.WriteCloser {
+	if len(recipients) == 0 {
+		return &encryptingWriter{err: CryptoError("No recipients specified")}
+	}
+
+	cipher := NewCipher()
+	for _, r := range recipients {
+		if err := cipher.AddKeyRecipient(r); err != nil {
+			return &encryptingWriter{err: err}
+		}
+	}
+
+	pr, pw := io.Pipe()
+	w := &encryptingWriter{pw: pw, done: make(chan error, 1)}
+	go func() {
+		err := cipher.EncryptStream(pr, out)
+		//unblocks Write if encryption has stopped early
+		pr.CloseWithError(err)
+		w.done <- err
+	}()
+	return w
+}
+
+func (w *encryptingWriter) Write(p []byte) (int, error) {
+	if w.pw == nil {
+		return 0, w.err
+	}
+	return w.pw.Write(p)
+}
+
+func (w *encryptingWriter) Close() error {
+	if w.pw == nil || w.closed {
+		return w.err
+	}
+	w.closed = true
+	w.pw.Close()
+	w.err = <-w.done
+	return w.err
+}
+
+//decryptingReader returns the data DecryptStream running in the background writes
+type decryptingReader struct {
+	in    io.Reader
+	key   PrivateKey
+	pr    *io.PipeReader
+	start sync.Once
+}
+
+//NewDecryptingReader returns a reader of the plaintext of the stream encrypted by EncryptStream or NewEncryptingWriter.
+//Only authenticated chunks are returned, a corrupted or truncated stream ends with an error instead of io.EOF.
+//Decryption starts with the first Read, Close stops it if the stream is not read to the end
+func NewDecryptingReader(in io.Reader, key PrivateKey) io.ReadCloser {
+	return &decryptingReader{in: in, key: key}
+}
+
+func (r *decryptingReader) init() {
+	r.start.Do(func() {
+		pr, pw := io.Pipe()
+		r.pr = pr
+		go func() {
+			pw.CloseWithError(NewCipher().DecryptStream(r.in, pw, r.key))
+		}()
+	})
+}
+
+func (r *decryptingReader) Read(p []byte) (int, error) {
+	r.init()
+	if r.pr == nil {
+		return 0, io.ErrClosedPipe
+	}
+	return r.pr.Read(p)
+}
+
+//Close before the first Read doesn't start decryption at all
+func (r *decryptingReader) Close() error {
+	r.start.Do(func() {})
+	if r.pr == nil {
+		return nil
+	}
+	return r.pr.Close()
+}
@@ -26,6 +26,13 @@ func DecodePrivateKey(keyBytes, password []byte) (key PrivateKey, err error) {
 		return nil, err
 	}
 
+	switch keyType {
+	case SEC1_PRIVATE_KEY:
+		return decodeSEC1PrivateKey(unwrappedKey)
+	case RSA_PRIVATE_KEY:
+		return decodePKCS1PrivateKey(unwrappedKey)
+	}
+
 	if keyType != "" && keyType != EC_PRIVATE_KEY && keyType != ENCRYPTED_PRIVATE_KEY {
 		return nil, unsupported("key type")
 	}
@@ -98,9 +105,18 @@ func encodePrivateKeyEncrypted(privateKey *ed25519PrivateKey, password []byte, e
 		return nil, err
 	}
 
-	kdfIv, iterations, keyIv, encryptedKey := encryptKeyWithPassword(serializedKey, password)
+	return encryptPrivateKey(serializedKey, password, encodeToPem)
+}
+
+//encryptPrivateKey wraps a serialized PKCS#8 key of any type into the password protected envelope
+func encryptPrivateKey(serializedKey, password []byte, encodeToPem bool) ([]byte, error) {
 
-	alg, err := encodeKeyEncryptionAlgorithm(kdfIv, iterations, keyIv)
+	keyDerivationFunc, encryptionScheme, encryptedKey, err := encryptKeyWithPassword(serializedKey, password)
+	if err != nil {
+		return nil, err
+	}
+
+	alg, err := encodeKeyEncryptionAlgorithm(keyDerivationFunc, encryptionScheme)
 	if err != nil {
 		return nil, err
 	}
@@ -125,7 +141,26 @@ func encodePrivateKeyEncrypted(privateKey *ed25519PrivateKey, password []byte, e
 		return pem.EncodeToMemory(block), nil
 	}
 }
-func loadPlainPrivateKey(keyBytes []byte) (*ed25519PrivateKey, error) {
+func loadPlainPrivateKey(keyBytes []byte) (PrivateKey, error) {
+
+	key := &privateKeyAsn{}
+	_, err := asn1.Unmarshal(keyBytes, key)
+	if err != nil {
+		//might be a PKCS#1 RSA key without PEM armor
+		if rsaKey, rsaErr := decodePKCS1PrivateKey(keyBytes); rsaErr == nil {
+			return rsaKey, nil
+		}
+		return nil, cryptoError(err, "invalid data")
+	}
+
+	algorithm, err := keyAlgorithmByOid(key.OID.Algorithm)
+	if err != nil {
+		return nil, err
+	}
+	return algorithm.DecodePrivateKey(keyBytes)
+}
+
+func loadEd25519PrivateKey(keyBytes []byte) (*ed25519PrivateKey, error) {
 
 	key := &privateKeyAsn{}
 	_, err := asn1.Unmarshal(keyBytes, key)
@@ -160,19 +195,19 @@ func loadPlainPrivateKey(keyBytes []byte) (*ed25519PrivateKey, error) {
 	return edpriv, nil
 }
 
-func loadEncryptedPrivateKey(keyBytes, password []byte) (*ed25519PrivateKey, error) {
+func loadEncryptedPrivateKey(keyBytes, password []byte) (PrivateKey, error) {
 	parsedEncryptedKey := &envelopeKey{}
 	_, err := asn1.Unmarshal(keyBytes, parsedEncryptedKey)
 	if err != nil {
 		return nil, cryptoError(err, "could not parse encrypted key")
 	}
 
-	keyIv, kdfIv, iterations, err := decodeKeyEncryptionAlgorithm(&parsedEncryptedKey.Algorithm)
+	encryptionScheme, keyDerivationFunc, err := decodeKeyEncryptionAlgorithm(&parsedEncryptedKey.Algorithm)
 	if err != nil {
 		return nil, err
 	}
 
-	decryptedKey, err := decryptKeyWithPassword(parsedEncryptedKey.CipherText, keyIv, kdfIv, iterations, password)
+	decryptedKey, err := decryptKeyWithPassword(parsedEncryptedKey.CipherText, encryptionScheme, keyDerivationFunc, password)
 	if err != nil {
 		return nil, err
 	}
@@ -24,15 +24,38 @@ func DecodePublicKey(keyBytes []byte) (PublicKey, error) {
 		return nil, err
 	}
 
+	if keyType == RSA_PUBLIC_KEY {
+		return decodePKCS1PublicKey(unwrappedKey)
+	}
+
 	if keyType != "" && keyType != PUBLIC_KEY {
 		return nil, unsupported("key type")
 	}
 
 	publicKey := &publicKey{}
 	_, err = asn1.Unmarshal(unwrappedKey, publicKey)
+	if err != nil {
+		//might be a PKCS#1 RSA key without PEM armor
+		if rsaKey, rsaErr := decodePKCS1PublicKey(unwrappedKey); rsaErr == nil {
+			return rsaKey, nil
+		}
+		return nil, CryptoError("invalid data")
+	}
+
+	algorithm, err := keyAlgorithmByOid(publicKey.Algorithm.Algorithm)
+	if err != nil {
+		return nil, err
+	}
+	return algorithm.DecodePublicKey(unwrappedKey)
+}
+
+func decodeEd25519PublicKey(keyBytes []byte) (*ed25519PublicKey, error) {
+	publicKey := &publicKey{}
+	_, err := asn1.Unmarshal(keyBytes, publicKey)
 	if err != nil {
 		return nil, CryptoError("invalid data")
 	}
+
 	err = publicKey.Validate()
 	if err != nil {
 		return nil, err
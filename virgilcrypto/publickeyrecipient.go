@@ -37,29 +37,49 @@ POSSIBILITY OF SUCH DAMAGE.
 */
 import (
 	"bytes"
+	"crypto/x509/pkix"
 	"encoding/asn1"
 )
 
+//publicKeyRecipient encrypts symmetric key using the KeyAlgorithm of the recipient's key
 type publicKeyRecipient struct {
 	ID           []byte
-	PublicKey    []byte
-	tag          []byte
+	PublicKey    PublicKey
+	algorithm    pkix.AlgorithmIdentifier
 	encryptedKey []byte
-	iv           []byte
+}
+
+func newPublicKeyRecipient(key PublicKey) (*publicKeyRecipient, error) {
+	if _, err := keyAlgorithmForPublicKey(key); err != nil {
+		return nil, err
+	}
+	return &publicKeyRecipient{
+		ID:        key.ReceiverID(),
+		PublicKey: key,
+	}, nil
 }
 
 func (kr *publicKeyRecipient) encryptKey(symmetricKey []byte) (*asn1.RawValue, error) {
-	encryptedSymmetricKey, tag, ephPub, iv, err := encryptSymmetricKeyWithECIES(kr.PublicKey, symmetricKey)
+	keyAlgorithm, err := keyAlgorithmForPublicKey(kr.PublicKey)
+	if err != nil {
+		return nil, err
+	}
 
+	algorithm, encryptedKey, err := keyAlgorithm.EncryptKey(kr.PublicKey, symmetricKey)
 	if err != nil {
 		return nil, err
 	}
 
-	return makePublicKeyRecipient(kr.ID, ephPub, tag, encryptedSymmetricKey, iv)
+	return makePublicKeyRecipient(kr.ID, algorithm, encryptedKey)
 }
-func (p *publicKeyRecipient) decryptKey(id []byte, privateKey []byte) ([]byte, error) {
-	if len(id) == 0 || !bytes.Equal(id, p.ID) {
+func (p *publicKeyRecipient) decryptKey(privateKey PrivateKey) ([]byte, error) {
+	if len(privateKey.ReceiverID()) == 0 || !bytes.Equal(privateKey.ReceiverID(), p.ID) {
 		return nil, CryptoError("Wrong recepient")
 	}
-	return decryptSymmetricKeyWithECIES(p.encryptedKey, p.tag, p.PublicKey, p.iv, privateKey)
+
+	keyAlgorithm, err := keyAlgorithmForPrivateKey(privateKey)
+	if err != nil {
+		return nil, err
+	}
+	return keyAlgorithm.DecryptKey(privateKey, p.algorithm, p.encryptedKey)
 }
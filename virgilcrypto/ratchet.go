@@ -0,0 +1,470 @@
+package virgilcrypto
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"encoding/asn1"
+
+	"github.com/agl/ed25519"
+	"github.com/agl/ed25519/extra25519"
+	"github.com/minio/sha256-simd"
+	"golang.org/x/crypto/curve25519"
+	"golang.org/x/crypto/hkdf"
+)
+
+//Double Ratchet (https://signal.org/docs/specifications/doubleratchet/) initialized with the X3DH shared secret.
+//Ratchet keys are X25519, messages are encrypted with AES-256-GCM.
+//Responder's first ratchet key is its signed prekey converted to X25519, so the initiator can send right after X3DH.
+//Only the root key is derived from SK, the first DH ratchet step needs the private signed prekey
+
+const (
+	//RatchetMaxSkip limits the number of message keys skipped in a single chain
+	RatchetMaxSkip = 1000
+	//maxSkippedKeys limits the number of stored skipped message keys, the oldest are removed first
+	maxSkippedKeys = 2 * RatchetMaxSkip
+	ratchetKeySize = 32
+)
+
+var (
+	ratchetInitInfo    = []byte("VirgilRatchetInit")
+	ratchetRootInfo    = []byte("VirgilRatchetRoot")
+	ratchetMessageInfo = []byte("VirgilRatchetMessage")
+)
+
+type (
+	RatchetSession struct {
+		ad, sessionID           []byte
+		rootKey                 []byte
+		dhPrivate, dhPublic     []byte
+		remotePublic            []byte
+		sendChain, receiveChain []byte
+		sendCounter             int
+		receiveCounter          int
+		previousCounter         int
+		skipped                 []skippedMessageKey
+	}
+
+	//RatchetMessage header is authenticated along with the ciphertext
+	RatchetMessage struct {
+		PublicKey       []byte
+		PreviousCounter int
+		Counter         int
+		Ciphertext      []byte
+	}
+
+	ratchetHeader struct {
+		PublicKey       []byte
+		PreviousCounter int
+		Counter         int
+	}
+
+	skippedMessageKey struct {
+		PublicKey  []byte
+		Counter    int
+		MessageKey []byte
+	}
+
+	ratchetState struct {
+		Version         int
+		AD              []byte
+		SessionID       []byte
+		RootKey         []byte
+		DHPrivate       []byte
+		RemotePublic    []byte
+		SendChain       []byte
+		ReceiveChain    []byte
+		SendCounter     int
+		ReceiveCounter  int
+		PreviousCounter int
+		Skipped         []skippedMessageKey
+	}
+)
+
+// NewRatchetInitiatorSession starts Double Ratchet for the side which called StartInitiatorSession.
+// LTCb is the signed prekey of the responder the session was started with
+func NewRatchetInitiatorSession(session *PFSSession, LTCb PublicKey) (*RatchetSession, error) {
+	rootKey, err := ratchetInit(session)
+	if err != nil {
+		return nil, err
+	}
+	responderPublic, err := prekeyRatchetPublic(LTCb)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &RatchetSession{
+		ad:           session.AD,
+		sessionID:    session.SessionID,
+		rootKey:      rootKey,
+		remotePublic: responderPublic,
+	}
+	if err = s.newRatchetKey(); err != nil {
+		return nil, err
+	}
+	if s.rootKey, s.sendChain, err = s.kdfRoot(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// NewRatchetResponderSession starts Double Ratchet for the side which called StartResponderSession.
+// LTCb is the private signed prekey the session was started with.
+// Responder can send messages only after it has received the first one
+func NewRatchetResponderSession(session *PFSSession, LTCb PrivateKey) (*RatchetSession, error) {
+	rootKey, err := ratchetInit(session)
+	if err != nil {
+		return nil, err
+	}
+	private, err := prekeyRatchetPrivate(LTCb)
+	if err != nil {
+		return nil, err
+	}
+	public, err := curve25519.X25519(private, curve25519.Basepoint)
+	if err != nil {
+		return nil, cryptoError(err, "")
+	}
+
+	return &RatchetSession{
+		ad:        session.AD,
+		sessionID: session.SessionID,
+		rootKey:   rootKey,
+		dhPrivate: private,
+		dhPublic:  public,
+	}, nil
+}
+
+func ratchetInit(session *PFSSession) (rootKey []byte, err error) {
+	if session == nil || len(session.SK) == 0 {
+		return nil, CryptoError("session is empty")
+	}
+	rootKey = make([]byte, ratchetKeySize)
+	kdf := hkdf.New(sha256.New, session.SK, nil, ratchetInitInfo)
+	if _, err = kdf.Read(rootKey); err != nil {
+		return nil, cryptoError(err, "")
+	}
+	return rootKey, nil
+}
+
+//prekeyRatchetPublic converts the ed25519 signed prekey to X25519
+func prekeyRatchetPublic(key PublicKey) ([]byte, error) {
+	pub, ok := key.(*ed25519PublicKey)
+	if !ok || pub.Empty() {
+		return nil, unsupported("signed prekey type")
+	}
+	edPub := new([ed25519.PublicKeySize]byte)
+	curvePub := new([Curve25519PublicKeySize]byte)
+	copy(edPub[:], pub.contents())
+	if !extra25519.PublicKeyToCurve25519(curvePub, edPub) {
+		return nil, CryptoError("signed prekey is invalid")
+	}
+	return curvePub[:], nil
+}
+
+//prekeyRatchetPrivate converts the ed25519 private signed prekey to X25519
+func prekeyRatchetPrivate(key PrivateKey) ([]byte, error) {
+	priv, ok := key.(*ed25519PrivateKey)
+	if !ok || priv.Empty() {
+		return nil, unsupported("signed prekey type")
+	}
+	edPriv := new([ed25519.PrivateKeySize]byte)
+	curvePriv := new([Curve25519PrivateKeySize]byte)
+	copy(edPriv[:], priv.contents())
+	extra25519.PrivateKeyToCurve25519(curvePriv, edPriv)
+	return curvePriv[:], nil
+}
+
+func (s *RatchetSession) SessionID() []byte {
+	return s.sessionID
+}
+
+func (s *RatchetSession) Encrypt(plaintext []byte) (*RatchetMessage, error) {
+	if len(s.sendChain) == 0 {
+		return nil, CryptoError("responder can not send before it receives a message")
+	}
+
+	var messageKey []byte
+	messageKey, s.sendChain = kdfChain(s.sendChain)
+
+	msg := &RatchetMessage{
+		PublicKey:       s.dhPublic,
+		PreviousCounter: s.previousCounter,
+		Counter:         s.sendCounter,
+	}
+	s.sendCounter++
+
+	ad, err := s.messageAD(msg)
+	if err != nil {
+		return nil, err
+	}
+	msg.Ciphertext, err = ratchetSeal(messageKey, plaintext, ad)
+	if err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+// Decrypt changes the session state only if the message was decrypted successfully
+func (s *RatchetSession) Decrypt(msg *RatchetMessage) ([]byte, error) {
+	if err := msg.Validate(); err != nil {
+		return nil, err
+	}
+
+	state := s.clone()
+	plaintext, err := state.decrypt(msg)
+	if err != nil {
+		return nil, err
+	}
+	*s = *state
+	return plaintext, nil
+}
+
+func (s *RatchetSession) decrypt(msg *RatchetMessage) ([]byte, error) {
+	ad, err := s.messageAD(msg)
+	if err != nil {
+		return nil, err
+	}
+
+	if messageKey, ok := s.takeSkipped(msg.PublicKey, msg.Counter); ok {
+		return ratchetOpen(messageKey, msg.Ciphertext, ad)
+	}
+
+	if !bytes.Equal(msg.PublicKey, s.remotePublic) {
+		if err = s.skip(msg.PreviousCounter); err != nil {
+			return nil, err
+		}
+		if err = s.dhRatchet(msg.PublicKey); err != nil {
+			return nil, err
+		}
+	}
+
+	if err = s.skip(msg.Counter); err != nil {
+		return nil, err
+	}
+
+	var messageKey []byte
+	messageKey, s.receiveChain = kdfChain(s.receiveChain)
+	s.receiveCounter++
+	return ratchetOpen(messageKey, msg.Ciphertext, ad)
+}
+
+func (s *RatchetSession) dhRatchet(remotePublic []byte) error {
+	s.previousCounter = s.sendCounter
+	s.sendCounter = 0
+	s.receiveCounter = 0
+	s.remotePublic = remotePublic
+
+	var err error
+	if s.rootKey, s.receiveChain, err = s.kdfRoot(); err != nil {
+		return err
+	}
+	if err = s.newRatchetKey(); err != nil {
+		return err
+	}
+	s.rootKey, s.sendChain, err = s.kdfRoot()
+	return err
+}
+
+// skip stores message keys of the current receiving chain up to the counter
+func (s *RatchetSession) skip(until int) error {
+	if len(s.receiveChain) == 0 {
+		return nil
+	}
+	if until-s.receiveCounter > RatchetMaxSkip {
+		return CryptoError("too many skipped messages")
+	}
+	for ; s.receiveCounter < until; s.receiveCounter++ {
+		var messageKey []byte
+		messageKey, s.receiveChain = kdfChain(s.receiveChain)
+		s.skipped = append(s.skipped, skippedMessageKey{
+			PublicKey:  s.remotePublic,
+			Counter:    s.receiveCounter,
+			MessageKey: messageKey,
+		})
+	}
+	if extra := len(s.skipped) - maxSkippedKeys; extra > 0 {
+		s.skipped = s.skipped[extra:]
+	}
+	return nil
+}
+
+func (s *RatchetSession) takeSkipped(publicKey []byte, counter int) ([]byte, bool) {
+	for i, k := range s.skipped {
+		if k.Counter == counter && bytes.Equal(k.PublicKey, publicKey) {
+			s.skipped = append(s.skipped[:i:i], s.skipped[i+1:]...)
+			return k.MessageKey, true
+		}
+	}
+	return nil, false
+}
+
+func (s *RatchetSession) newRatchetKey() error {
+	private := make([]byte, ratchetKeySize)
+	if _, err := rand.Read(private); err != nil {
+		return cryptoError(err, "")
+	}
+	public, err := curve25519.X25519(private, curve25519.Basepoint)
+	if err != nil {
+		return cryptoError(err, "")
+	}
+	s.dhPrivate, s.dhPublic = private, public
+	return nil
+}
+
+// kdfRoot mixes DH output of the current ratchet keys into the root key and returns the new root and chain keys
+func (s *RatchetSession) kdfRoot() (rootKey, chainKey []byte, err error) {
+	dh, err := curve25519.X25519(s.dhPrivate, s.remotePublic)
+	if err != nil {
+		return nil, nil, cryptoError(err, "")
+	}
+	keys := make([]byte, 2*ratchetKeySize)
+	kdf := hkdf.New(sha256.New, dh, s.rootKey, ratchetRootInfo)
+	if _, err = kdf.Read(keys); err != nil {
+		return nil, nil, cryptoError(err, "")
+	}
+	return keys[:ratchetKeySize], keys[ratchetKeySize:], nil
+}
+
+func kdfChain(chainKey []byte) (messageKey, nextChainKey []byte) {
+	mac := hmac.New(sha256.New, chainKey)
+	mac.Write([]byte{1})
+	messageKey = mac.Sum(nil)
+
+	mac.Reset()
+	mac.Write([]byte{2})
+	nextChainKey = mac.Sum(nil)
+	return
+}
+
+func (s *RatchetSession) messageAD(msg *RatchetMessage) ([]byte, error) {
+	header, err := asn1.Marshal(ratchetHeader{
+		PublicKey:       msg.PublicKey,
+		PreviousCounter: msg.PreviousCounter,
+		Counter:         msg.Counter,
+	})
+	if err != nil {
+		return nil, cryptoError(err, "")
+	}
+	ad := make([]byte, 0, len(s.ad)+len(header))
+	ad = append(ad, s.ad...)
+	return append(ad, header...), nil
+}
+
+func ratchetSeal(messageKey, plaintext, ad []byte) ([]byte, error) {
+	aesGCM, nonce, err := ratchetCipher(messageKey)
+	if err != nil {
+		return nil, err
+	}
+	return aesGCM.Seal(nil, nonce, plaintext, ad), nil
+}
+
+func ratchetOpen(messageKey, ciphertext, ad []byte) ([]byte, error) {
+	aesGCM, nonce, err := ratchetCipher(messageKey)
+	if err != nil {
+		return nil, err
+	}
+	plaintext, err := aesGCM.Open(nil, nonce, ciphertext, ad)
+	if err != nil {
+		return nil, cryptoError(err, "")
+	}
+	return plaintext, nil
+}
+
+func ratchetCipher(messageKey []byte) (cipher.AEAD, []byte, error) {
+	keyAndNonce := make([]byte, 44)
+	kdf := hkdf.New(sha256.New, messageKey, nil, ratchetMessageInfo)
+	if _, err := kdf.Read(keyAndNonce); err != nil {
+		return nil, nil, cryptoError(err, "")
+	}
+	ciph, _ := aes.NewCipher(keyAndNonce[:32])
+	aesGCM, _ := cipher.NewGCM(ciph)
+	return aesGCM, keyAndNonce[32:], nil
+}
+
+func (s *RatchetSession) clone() *RatchetSession {
+	c := *s
+	c.skipped = append([]skippedMessageKey(nil), s.skipped...)
+	return &c
+}
+
+// Marshal serializes the session state. The result contains secret keys and must be stored securely
+func (s *RatchetSession) Marshal() ([]byte, error) {
+	state := ratchetState{
+		Version:         1,
+		AD:              s.ad,
+		SessionID:       s.sessionID,
+		RootKey:         s.rootKey,
+		DHPrivate:       s.dhPrivate,
+		RemotePublic:    s.remotePublic,
+		SendChain:       s.sendChain,
+		ReceiveChain:    s.receiveChain,
+		SendCounter:     s.sendCounter,
+		ReceiveCounter:  s.receiveCounter,
+		PreviousCounter: s.previousCounter,
+		Skipped:         s.skipped,
+	}
+	res, err := asn1.Marshal(state)
+	if err != nil {
+		return nil, cryptoError(err, "")
+	}
+	return res, nil
+}
+
+func UnmarshalRatchetSession(data []byte) (*RatchetSession, error) {
+	state := &ratchetState{}
+	rest, err := asn1.Unmarshal(data, state)
+	if err != nil {
+		return nil, cryptoError(err, "")
+	}
+	if len(rest) != 0 {
+		return nil, CryptoError("Some data is left after session parsing")
+	}
+	if err = state.Validate(); err != nil {
+		return nil, err
+	}
+
+	dhPublic, err := curve25519.X25519(state.DHPrivate, curve25519.Basepoint)
+	if err != nil {
+		return nil, cryptoError(err, "")
+	}
+
+	return &RatchetSession{
+		ad:              state.AD,
+		sessionID:       state.SessionID,
+		rootKey:         state.RootKey,
+		dhPrivate:       state.DHPrivate,
+		dhPublic:        dhPublic,
+		remotePublic:    state.RemotePublic,
+		sendChain:       state.SendChain,
+		receiveChain:    state.ReceiveChain,
+		sendCounter:     state.SendCounter,
+		receiveCounter:  state.ReceiveCounter,
+		previousCounter: state.PreviousCounter,
+		skipped:         state.Skipped,
+	}, nil
+}
+
+func (m *RatchetMessage) Marshal() ([]byte, error) {
+	res, err := asn1.Marshal(*m)
+	if err != nil {
+		return nil, cryptoError(err, "")
+	}
+	return res, nil
+}
+
+func UnmarshalRatchetMessage(data []byte) (*RatchetMessage, error) {
+	msg := &RatchetMessage{}
+	rest, err := asn1.Unmarshal(data, msg)
+	if err != nil {
+		return nil, cryptoError(err, "")
+	}
+	if len(rest) != 0 {
+		return nil, CryptoError("Some data is left after message parsing")
+	}
+	if err = msg.Validate(); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
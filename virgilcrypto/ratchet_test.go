@@ -0,0 +1,190 @@
+package virgilcrypto
+
+import (
+	"encoding/hex"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newRatchetSessions(t *testing.T) (alice, bob *RatchetSession) {
+	c := DefaultCrypto
+
+	ICa, err := c.GenerateKeypair()
+	assert.NoError(t, err)
+	EKa, err := c.GenerateKeypair()
+	assert.NoError(t, err)
+	ICb, err := c.GenerateKeypair()
+	assert.NoError(t, err)
+	LTCb, err := c.GenerateKeypair()
+	assert.NoError(t, err)
+
+	pfs := c.(PFS)
+	aliceCardID := hex.EncodeToString(ICa.PublicKey().ReceiverID())
+	bobCardID := hex.EncodeToString(ICb.PublicKey().ReceiverID())
+
+	signedLTCb, err := SignPrekey(LTCb.PublicKey(), ICb.PrivateKey())
+	assert.NoError(t, err)
+
+	sessA, err := pfs.StartInitiatorSession(ICb.PublicKey(), signedLTCb, nil, ICa.PrivateKey(), EKa.PrivateKey(), aliceCardID, bobCardID)
+	assert.NoError(t, err)
+	sessB, err := pfs.StartResponderSession(ICa.PublicKey(), EKa.PublicKey(), ICb.PrivateKey(), LTCb.PrivateKey(), nil, aliceCardID, bobCardID)
+	assert.NoError(t, err)
+
+	alice, err = NewRatchetInitiatorSession(sessA, LTCb.PublicKey())
+	assert.NoError(t, err)
+	bob, err = NewRatchetResponderSession(sessB, LTCb.PrivateKey())
+	assert.NoError(t, err)
+	return
+}
+
+func ratchetSend(t *testing.T, s *RatchetSession, text string) *RatchetMessage {
+	msg, err := s.Encrypt([]byte(text))
+	assert.NoError(t, err)
+	return msg
+}
+
+func ratchetReceive(t *testing.T, s *RatchetSession, msg *RatchetMessage, text string) {
+	plaintext, err := s.Decrypt(msg)
+	assert.NoError(t, err)
+	assert.Equal(t, text, string(plaintext))
+}
+
+func TestRatchet(t *testing.T) {
+	alice, bob := newRatchetSessions(t)
+	assert.Equal(t, alice.SessionID(), bob.SessionID())
+
+	//responder has no sending chain yet
+	_, err := bob.Encrypt([]byte("hi"))
+	assert.Error(t, err)
+
+	for i := 0; i < 3; i++ {
+		a := ratchetSend(t, alice, fmt.Sprint("alice ", i))
+		ratchetReceive(t, bob, a, fmt.Sprint("alice ", i))
+
+		b1 := ratchetSend(t, bob, fmt.Sprint("bob ", i))
+		b2 := ratchetSend(t, bob, fmt.Sprint("bob ", i+1))
+		assert.Equal(t, b1.PublicKey, b2.PublicKey)
+		assert.NotEqual(t, a.PublicKey, b1.PublicKey)
+
+		ratchetReceive(t, alice, b1, fmt.Sprint("bob ", i))
+		ratchetReceive(t, alice, b2, fmt.Sprint("bob ", i+1))
+	}
+
+	//same plaintext gives different ciphertexts
+	m1 := ratchetSend(t, alice, "same")
+	m2 := ratchetSend(t, alice, "same")
+	assert.NotEqual(t, m1.Ciphertext, m2.Ciphertext)
+}
+
+func TestRatchet_ResponderKeyIsSignedPrekey(t *testing.T) {
+	c := DefaultCrypto
+	LTCb, err := c.GenerateKeypair()
+	assert.NoError(t, err)
+	other, err := c.GenerateKeypair()
+	assert.NoError(t, err)
+	session := &PFSSession{SK: make([]byte, 32), AD: []byte("ad"), SessionID: []byte("id")}
+
+	alice, err := NewRatchetInitiatorSession(session, LTCb.PublicKey())
+	assert.NoError(t, err)
+	bob, err := NewRatchetResponderSession(session, LTCb.PrivateKey())
+	assert.NoError(t, err)
+	assert.Equal(t, alice.remotePublic, bob.dhPublic)
+
+	//knowing SK without the private signed prekey is not enough to read the first message
+	eve, err := NewRatchetResponderSession(session, other.PrivateKey())
+	assert.NoError(t, err)
+	msg := ratchetSend(t, alice, "hello")
+	_, err = eve.Decrypt(msg)
+	assert.Error(t, err)
+	ratchetReceive(t, bob, msg, "hello")
+}
+
+func TestRatchet_OutOfOrder(t *testing.T) {
+	alice, bob := newRatchetSessions(t)
+
+	a0 := ratchetSend(t, alice, "a0")
+	a1 := ratchetSend(t, alice, "a1")
+	a2 := ratchetSend(t, alice, "a2")
+
+	ratchetReceive(t, bob, a2, "a2")
+
+	b0 := ratchetSend(t, bob, "b0")
+	ratchetReceive(t, alice, b0, "b0")
+	a3 := ratchetSend(t, alice, "a3")
+
+	//new ratchet step first, then messages from the previous chain
+	ratchetReceive(t, bob, a3, "a3")
+	ratchetReceive(t, bob, a0, "a0")
+	ratchetReceive(t, bob, a1, "a1")
+
+	//skipped keys are deleted after use
+	_, err := bob.Decrypt(a1)
+	assert.Error(t, err)
+	_, err = bob.Decrypt(a3)
+	assert.Error(t, err)
+}
+
+func TestRatchet_FailedDecryptKeepsState(t *testing.T) {
+	alice, bob := newRatchetSessions(t)
+
+	a0 := ratchetSend(t, alice, "a0")
+	a1 := ratchetSend(t, alice, "a1")
+
+	tampered := *a1
+	tampered.Ciphertext = append([]byte(nil), a1.Ciphertext...)
+	tampered.Ciphertext[0] ^= 1
+	_, err := bob.Decrypt(&tampered)
+	assert.Error(t, err)
+
+	tampered = *a1
+	tampered.Counter = 0
+	_, err = bob.Decrypt(&tampered)
+	assert.Error(t, err)
+
+	tampered = *a1
+	tampered.Counter = RatchetMaxSkip + 1
+	_, err = bob.Decrypt(&tampered)
+	assert.Error(t, err)
+
+	_, err = bob.Decrypt(&RatchetMessage{PublicKey: []byte{1}})
+	assert.Error(t, err)
+
+	ratchetReceive(t, bob, a0, "a0")
+	ratchetReceive(t, bob, a1, "a1")
+}
+
+func TestRatchet_Marshal(t *testing.T) {
+	alice, bob := newRatchetSessions(t)
+
+	a0 := ratchetSend(t, alice, "a0")
+	a1 := ratchetSend(t, alice, "a1")
+	ratchetReceive(t, bob, a1, "a1")
+
+	data, err := bob.Marshal()
+	assert.NoError(t, err)
+	bob, err = UnmarshalRatchetSession(data)
+	assert.NoError(t, err)
+
+	data, err = alice.Marshal()
+	assert.NoError(t, err)
+	alice, err = UnmarshalRatchetSession(data)
+	assert.NoError(t, err)
+
+	//skipped message key survives serialization
+	ratchetReceive(t, bob, a0, "a0")
+
+	msgData, err := ratchetSend(t, bob, "b0").Marshal()
+	assert.NoError(t, err)
+	b0, err := UnmarshalRatchetMessage(msgData)
+	assert.NoError(t, err)
+	ratchetReceive(t, alice, b0, "b0")
+
+	ratchetReceive(t, bob, ratchetSend(t, alice, "a2"), "a2")
+
+	_, err = UnmarshalRatchetSession(append(data, 0))
+	assert.Error(t, err)
+	_, err = UnmarshalRatchetMessage(data)
+	assert.Error(t, err)
+}
@@ -0,0 +1,387 @@
+package virgilcrypto
+
+/*
+Copyright (C) 2016-2017 Virgil Security Inc.
+
+Lead Maintainer: Virgil Security Inc. <support@virgilsecurity.com>
+
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions
+are met:
+
+  (1) Redistributions of source code must retain the above copyright
+  notice, this list of conditions and the following disclaimer.
+
+  (2) Redistributions in binary form must reproduce the above copyright
+  notice, this list of conditions and the following disclaimer in
+  the documentation and/or other materials provided with the
+  distribution.
+
+  (3) Neither the name of the copyright holder nor the names of its
+  contributors may be used to endorse or promote products derived
+  from this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE AUTHOR ''AS IS'' AND ANY EXPRESS OR
+IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY DIRECT,
+INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+(INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT,
+STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING
+IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+POSSIBILITY OF SUCH DAMAGE.
+*/
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+)
+
+//RSA keys (2048 - 8192 bits)
+
+const (
+	minRSAKeySize = 2048
+	maxRSAKeySize = 8192
+)
+
+type rsaPublicKey struct {
+	receiverID []byte
+	key        *rsa.PublicKey
+}
+
+type rsaPrivateKey struct {
+	receiverID []byte
+	key        *rsa.PrivateKey
+}
+
+func generateRSAKeypair(bits int) (Keypair, error) {
+	key, err := rsa.GenerateKey(rand.Reader, bits)
+	if err != nil {
+		return nil, cryptoError(err, "")
+	}
+
+	priv, err := newRSAPrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	pub := &rsaPublicKey{key: &key.PublicKey}
+	pub.receiverID = make([]byte, len(priv.receiverID))
+	copy(pub.receiverID, priv.receiverID)
+
+	return &keypair{publicKey: pub, privateKey: priv}, nil
+}
+
+func newRSAPublicKey(key *rsa.PublicKey) (*rsaPublicKey, error) {
+	if size := key.N.BitLen(); size < minRSAKeySize || size > maxRSAKeySize {
+		return nil, unsupported("RSA key size")
+	}
+	pub := &rsaPublicKey{key: key}
+	snapshot, err := pub.Encode()
+	if err != nil {
+		return nil, err
+	}
+	pub.receiverID = DefaultCrypto.CalculateFingerprint(snapshot)
+	return pub, nil
+}
+
+func newRSAPrivateKey(key *rsa.PrivateKey) (*rsaPrivateKey, error) {
+	pub, err := newRSAPublicKey(&key.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+	key.Precompute()
+	return &rsaPrivateKey{key: key, receiverID: pub.receiverID}, nil
+}
+
+func decodeRSAPublicKey(der []byte) (*rsaPublicKey, error) {
+	key, err := x509.ParsePKIXPublicKey(der)
+	if err != nil {
+		return nil, cryptoError(err, "invalid data")
+	}
+	rsaKey, ok := key.(*rsa.PublicKey)
+	if !ok {
+		return nil, unsupported("public key type")
+	}
+	return newRSAPublicKey(rsaKey)
+}
+
+//decodePKCS1PublicKey loads keys in "RSA PUBLIC KEY" format
+func decodePKCS1PublicKey(der []byte) (*rsaPublicKey, error) {
+	key, err := x509.ParsePKCS1PublicKey(der)
+	if err != nil {
+		return nil, cryptoError(err, "invalid data")
+	}
+	return newRSAPublicKey(key)
+}
+
+func decodeRSAPrivateKey(der []byte) (*rsaPrivateKey, error) {
+	key, err := x509.ParsePKCS8PrivateKey(der)
+	if err != nil {
+		return nil, cryptoError(err, "invalid data")
+	}
+	rsaKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, unsupported("key type")
+	}
+	return newRSAPrivateKey(rsaKey)
+}
+
+//decodePKCS1PrivateKey loads keys in "RSA PRIVATE KEY" format
+func decodePKCS1PrivateKey(der []byte) (*rsaPrivateKey, error) {
+	key, err := x509.ParsePKCS1PrivateKey(der)
+	if err != nil {
+		return nil, cryptoError(err, "invalid data")
+	}
+	return newRSAPrivateKey(key)
+}
+
+func (k *rsaPublicKey) ReceiverID() []byte {
+	return k.receiverID
+}
+
+func (k *rsaPublicKey) Encode() ([]byte, error) {
+	if k.Empty() {
+		return nil, CryptoError("public key is empty")
+	}
+	rawKey, err := x509.MarshalPKIXPublicKey(k.key)
+	if err != nil {
+		return nil, cryptoError(err, "")
+	}
+	return rawKey, nil
+}
+
+func (k *rsaPublicKey) Empty() bool {
+	return k == nil || k.key == nil
+}
+
+func (k *rsaPrivateKey) ReceiverID() []byte {
+	return k.receiverID
+}
+
+func (k *rsaPrivateKey) Encode(password []byte) ([]byte, error) {
+	if k.Empty() {
+		return nil, CryptoError("private key is empty")
+	}
+	serializedKey, err := x509.MarshalPKCS8PrivateKey(k.key)
+	if err != nil {
+		return nil, cryptoError(err, "")
+	}
+
+	if len(password) == 0 {
+		return serializedKey, nil
+	}
+	return encryptPrivateKey(serializedKey, password, false)
+}
+
+func (k *rsaPrivateKey) Empty() bool {
+	return k == nil || k.key == nil
+}
+
+func (k *rsaPrivateKey) ExtractPublicKey() (PublicKey, error) {
+	if k.Empty() {
+		return nil, CryptoError("private key is empty")
+	}
+	pub := &rsaPublicKey{key: &k.key.PublicKey}
+	pub.receiverID = make([]byte, len(k.receiverID))
+	copy(pub.receiverID, k.receiverID)
+	return pub, nil
+}
+
+//EncodePKCS1PublicKey returns RSA public key in "RSA PUBLIC KEY" (PKCS#1) format
+func EncodePKCS1PublicKey(key PublicKey) ([]byte, error) {
+	k, ok := key.(*rsaPublicKey)
+	if !ok || k.Empty() {
+		return nil, unsupported("public key type")
+	}
+	return x509.MarshalPKCS1PublicKey(k.key), nil
+}
+
+//EncodePKCS1PrivateKey returns unencrypted RSA private key in "RSA PRIVATE KEY" (PKCS#1) format
+func EncodePKCS1PrivateKey(key PrivateKey) ([]byte, error) {
+	k, ok := key.(*rsaPrivateKey)
+	if !ok || k.Empty() {
+		return nil, unsupported("key type")
+	}
+	return x509.MarshalPKCS1PrivateKey(k.key), nil
+}
+
+type rsaAlgorithm struct{}
+
+func (a *rsaAlgorithm) OID() asn1.ObjectIdentifier {
+	return oidRsaEncryption
+}
+
+func (a *rsaAlgorithm) SupportsPublicKey(key PublicKey) bool {
+	_, ok := key.(*rsaPublicKey)
+	return ok
+}
+
+func (a *rsaAlgorithm) SupportsPrivateKey(key PrivateKey) bool {
+	_, ok := key.(*rsaPrivateKey)
+	return ok
+}
+
+func (a *rsaAlgorithm) DecodePublicKey(der []byte) (PublicKey, error) {
+	return decodeRSAPublicKey(der)
+}
+
+func (a *rsaAlgorithm) DecodePrivateKey(der []byte) (PrivateKey, error) {
+	return decodeRSAPrivateKey(der)
+}
+
+//EncryptKey encrypts the symmetric key with RSA-OAEP (SHA-384, MGF1 with SHA-384)
+func (a *rsaAlgorithm) EncryptKey(key PublicKey, symmetricKey []byte) (pkix.AlgorithmIdentifier, []byte, error) {
+	algorithm, err := makeRSAOAEPAlgorithm()
+	if err != nil {
+		return algorithm, nil, err
+	}
+
+	encryptedKey, err := rsa.EncryptOAEP(crypto.SHA384.New(), rand.Reader, key.(*rsaPublicKey).key, symmetricKey, nil)
+	if err != nil {
+		return algorithm, nil, cryptoError(err, "")
+	}
+	return algorithm, encryptedKey, nil
+}
+
+func (a *rsaAlgorithm) DecryptKey(key PrivateKey, algorithm pkix.AlgorithmIdentifier, encryptedKey []byte) ([]byte, error) {
+	hash, err := decodeRSAOAEPAlgorithm(algorithm)
+	if err != nil {
+		return nil, err
+	}
+
+	k := key.(*rsaPrivateKey)
+	if len(encryptedKey) != k.key.Size() {
+		return nil, unsupported("encrypted key data length")
+	}
+
+	symmetricKey, err := rsa.DecryptOAEP(hash.New(), rand.Reader, k.key, encryptedKey, nil)
+	if err != nil {
+		return nil, cryptoError(err, "")
+	}
+	return symmetricKey, nil
+}
+
+func (a *rsaAlgorithm) Sign(hash []byte, key PrivateKey) ([]byte, error) {
+	return signRSAPSS(hash, key.(*rsaPrivateKey))
+}
+
+func (a *rsaAlgorithm) Verify(hash []byte, key PublicKey, signature []byte) (bool, error) {
+	return verifyRSAPSS(hash, key.(*rsaPublicKey), signature)
+}
+
+func makeRSAOAEPAlgorithm() (pkix.AlgorithmIdentifier, error) {
+	hashAlgo := pkix.AlgorithmIdentifier{
+		Algorithm:  oidSha384,
+		Parameters: asn1Null,
+	}
+	serializedHashAlgo, err := asn1.Marshal(hashAlgo)
+	if err != nil {
+		return pkix.AlgorithmIdentifier{}, cryptoError(err, "")
+	}
+
+	params := rsaesOAEPParams{
+		HashAlgorithm: hashAlgo,
+		MaskGenAlgorithm: pkix.AlgorithmIdentifier{
+			Algorithm:  oidMgf1,
+			Parameters: asn1.RawValue{FullBytes: serializedHashAlgo},
+		},
+	}
+	serializedParams, err := asn1.Marshal(params)
+	if err != nil {
+		return pkix.AlgorithmIdentifier{}, cryptoError(err, "")
+	}
+
+	return pkix.AlgorithmIdentifier{
+		Algorithm:  oidRsaesOAEP,
+		Parameters: asn1.RawValue{FullBytes: serializedParams},
+	}, nil
+}
+
+//makeRSAPSSAlgorithm describes signatures made by signRSAPSS: SHA-384, MGF1 with SHA-384 and 48 byte salt
+func makeRSAPSSAlgorithm() (pkix.AlgorithmIdentifier, error) {
+	hashAlgo := pkix.AlgorithmIdentifier{
+		Algorithm:  oidSha384,
+		Parameters: asn1Null,
+	}
+	serializedHashAlgo, err := asn1.Marshal(hashAlgo)
+	if err != nil {
+		return pkix.AlgorithmIdentifier{}, cryptoError(err, "")
+	}
+
+	params := rsassaPSSParams{
+		HashAlgorithm: hashAlgo,
+		MaskGenAlgorithm: pkix.AlgorithmIdentifier{
+			Algorithm:  oidMgf1,
+			Parameters: asn1.RawValue{FullBytes: serializedHashAlgo},
+		},
+		SaltLength:   crypto.SHA384.Size(),
+		TrailerField: 1,
+	}
+	serializedParams, err := asn1.Marshal(params)
+	if err != nil {
+		return pkix.AlgorithmIdentifier{}, cryptoError(err, "")
+	}
+
+	return pkix.AlgorithmIdentifier{
+		Algorithm:  oidRsassaPSS,
+		Parameters: asn1.RawValue{FullBytes: serializedParams},
+	}, nil
+}
+
+//checkRSAPSSAlgorithm accepts RSASSA-PSS with SHA-384, the only hash verifyRSAPSS supports. Salt length is detected on verification
+func checkRSAPSSAlgorithm(algorithm pkix.AlgorithmIdentifier) error {
+	if !algorithm.Algorithm.Equal(oidRsassaPSS) {
+		return unsupported("signature algorithm")
+	}
+	params := &rsassaPSSParams{}
+	if _, err := asn1.Unmarshal(algorithm.Parameters.FullBytes, params); err != nil {
+		return cryptoError(err, "")
+	}
+	if !params.HashAlgorithm.Algorithm.Equal(oidSha384) {
+		return unsupported("RSASSA-PSS hash algorithm")
+	}
+	return nil
+}
+
+//decodeRSAOAEPAlgorithm returns the hash function used by RSAES-OAEP key encryption algorithm
+func decodeRSAOAEPAlgorithm(algorithm pkix.AlgorithmIdentifier) (crypto.Hash, error) {
+	if !algorithm.Algorithm.Equal(oidRsaesOAEP) {
+		return 0, unsupported("key encryption algorithm")
+	}
+
+	params := &rsaesOAEPParams{}
+	if len(algorithm.Parameters.FullBytes) > 0 {
+		_, err := asn1.Unmarshal(algorithm.Parameters.FullBytes, params)
+		if err != nil {
+			return 0, cryptoError(err, "")
+		}
+	}
+	if err := params.Validate(); err != nil {
+		return 0, err
+	}
+
+	return hashByOid(params.HashAlgorithm.Algorithm)
+}
+
+//hashByOid maps OAEP hash identifiers, absent one means SHA-1 as per RFC 4055
+func hashByOid(oid asn1.ObjectIdentifier) (crypto.Hash, error) {
+	switch {
+	case len(oid) == 0, oid.Equal(oidSha1):
+		return crypto.SHA1, nil
+	case oid.Equal(oidSha256):
+		return crypto.SHA256, nil
+	case oid.Equal(oidSha384):
+		return crypto.SHA384, nil
+	case oid.Equal(oidSha512):
+		return crypto.SHA512, nil
+	}
+	return 0, unsupported("hash algorithm")
+}
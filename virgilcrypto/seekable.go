@@ -0,0 +1,190 @@
+package virgilcrypto
+
+import (
+	"crypto/cipher"
+	"io"
+	"sync"
+)
+
+//SeekableReader decrypts chunked streams with random access. Only the chunks touched by a read are read and decrypted,
+//the last decrypted chunk is cached for sequential reads. Unlike DecryptStream, a truncated stream is detected
+//only when its last chunk is read
+type SeekableReader struct {
+	ciphertext io.ReaderAt
+	aead       cipher.AEAD
+	nonce      []byte
+	framing    int
+
+	dataOffset    int64
+	chunkSize     int64
+	chunks        int64
+	lastChunkSize int64
+	size          int64
+
+	offset int64
+
+	lock        sync.Mutex
+	cachedIndex int64
+	cached      []byte
+}
+
+//OpenSeekable parses the header of the stream encrypted by EncryptStream and returns a reader of the decrypted data.
+//size is the length of the whole ciphertext including the header
+func (c *defaultCipher) OpenSeekable(ciphertext io.ReaderAt, size int64, key PrivateKey) (*SeekableReader, error) {
+	if key == nil || key.Empty() {
+		return nil, CryptoError("no keypair provided")
+	}
+
+	section := io.NewSectionReader(ciphertext, 0, size)
+	h, err := openStream(section, func(recipients []recipient) ([]byte, error) {
+		return decryptSymmetricKey(recipients, key)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if h.chunkSize <= 0 {
+		return nil, unsupported("random access to not chunked streams")
+	}
+	if _, ok := h.customParams[signatureTrailerKey]; ok {
+		return nil, unsupported("random access to signed streams")
+	}
+	framing, err := streamChunkFraming(h.customParams)
+	if err != nil {
+		return nil, err
+	}
+	if framing != chunkFramingVersion && !isAESGCM(h.content) {
+		return nil, unsupported("content cipher of the legacy stream")
+	}
+	aead, err := newChunkAEAD(h.content, h.symmetricKey, h.nonce)
+	if err != nil {
+		return nil, err
+	}
+
+	dataOffset, _ := section.Seek(0, io.SeekCurrent)
+	r := &SeekableReader{
+		ciphertext:  ciphertext,
+		aead:        aead,
+		nonce:       h.nonce,
+		framing:     framing,
+		dataOffset:  dataOffset,
+		chunkSize:   int64(h.chunkSize),
+		cachedIndex: -1,
+	}
+
+	dataSize := size - dataOffset
+	encryptedChunkSize := r.chunkSize + gcmTagSize
+	r.chunks = (dataSize + encryptedChunkSize - 1) / encryptedChunkSize
+	if r.chunks == 0 {
+		if framing == chunkFramingVersion {
+			return nil, CryptoError("stream is truncated")
+		}
+		return r, nil
+	}
+
+	r.lastChunkSize = dataSize - (r.chunks-1)*encryptedChunkSize
+	if r.lastChunkSize < gcmTagSize {
+		return nil, CryptoError("stream is truncated")
+	}
+	r.size = dataSize - r.chunks*gcmTagSize
+
+	//reads never touch an empty last chunk, so it is authenticated right away
+	if r.lastChunkSize == gcmTagSize {
+		if _, err = r.chunk(r.chunks - 1); err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+//Size returns the length of the decrypted data
+func (r *SeekableReader) Size() int64 {
+	return r.size
+}
+
+func (r *SeekableReader) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, CryptoError("negative offset")
+	}
+
+	n := 0
+	for n < len(p) && off < r.size {
+		index := off / r.chunkSize
+		chunk, err := r.chunk(index)
+		if err != nil {
+			return n, err
+		}
+		copied := copy(p[n:], chunk[off-index*r.chunkSize:])
+		n += copied
+		off += int64(copied)
+	}
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+func (r *SeekableReader) Read(p []byte) (int, error) {
+	if r.offset >= r.size {
+		return 0, io.EOF
+	}
+	n, err := r.ReadAt(p, r.offset)
+	r.offset += int64(n)
+	if err == io.EOF {
+		err = nil
+	}
+	return n, err
+}
+
+func (r *SeekableReader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += r.offset
+	case io.SeekEnd:
+		offset += r.size
+	default:
+		return 0, CryptoError("invalid whence")
+	}
+	if offset < 0 {
+		return 0, CryptoError("negative position")
+	}
+	r.offset = offset
+	return offset, nil
+}
+
+//chunk returns decrypted chunk by its index
+func (r *SeekableReader) chunk(index int64) ([]byte, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if index == r.cachedIndex {
+		return r.cached, nil
+	}
+
+	encryptedChunkSize := r.chunkSize + gcmTagSize
+	last := index == r.chunks-1
+	size := encryptedChunkSize
+	if last {
+		size = r.lastChunkSize
+	}
+
+	buf := make([]byte, size)
+	if _, err := r.ciphertext.ReadAt(buf, r.dataOffset+index*encryptedChunkSize); err != nil && err != io.EOF {
+		return nil, cryptoError(err, "Could not read from stream")
+	}
+
+	chunkNonce := make([]byte, len(r.nonce))
+	if r.framing == chunkFramingVersion {
+		framedChunkNonce(chunkNonce, r.nonce, uint64(index), last)
+	} else {
+		legacyChunkNonce(chunkNonce, r.nonce, uint64(index))
+	}
+
+	plaintext, err := r.aead.Open(buf[:0], chunkNonce, buf, nil)
+	if err != nil {
+		return nil, CryptoError("chunk authentication failed, the stream is corrupted or truncated")
+	}
+	r.cachedIndex, r.cached = index, plaintext
+	return plaintext, nil
+}
@@ -36,6 +36,10 @@ IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
 POSSIBILITY OF SUCH DAMAGE.
 */
 import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/rsa"
 	"io"
 	"strconv"
 
@@ -56,25 +60,25 @@ type VirgilVerifier interface {
 var Signer VirgilSigner
 var Verifier VirgilVerifier
 
-type ed25519Signer struct{}
-type ed25519Verifier struct{}
+type virgilSigner struct{}
+type virgilVerifier struct{}
 
-func (s *ed25519Signer) Sign(data []byte, signer PrivateKey) ([]byte, error) {
+func (s *virgilSigner) Sign(data []byte, signer PrivateKey) ([]byte, error) {
 	if signer == nil || signer.Empty() {
 		return nil, errors.New("key is nil")
 	}
 	hash := Hash.Sum(data)
-	return signInternal(hash[:], signer.(*ed25519PrivateKey))
+	return signHash(hash[:], signer)
 
 }
-func (s *ed25519Verifier) Verify(data []byte, key PublicKey, signature []byte) (bool, error) {
+func (s *virgilVerifier) Verify(data []byte, key PublicKey, signature []byte) (bool, error) {
 	if key == nil || key.Empty() {
 		return false, errors.New("key is nil")
 	}
 	hash := Hash.Sum(data)
-	return verifyInternal(hash[:], key.(*ed25519PublicKey), signature)
+	return verifyHash(hash[:], key, signature)
 }
-func (s *ed25519Signer) SignStream(data io.Reader, signer PrivateKey) ([]byte, error) {
+func (s *virgilSigner) SignStream(data io.Reader, signer PrivateKey) ([]byte, error) {
 	if signer == nil || signer.Empty() {
 		return nil, errors.New("key is nil")
 	}
@@ -82,9 +86,9 @@ func (s *ed25519Signer) SignStream(data io.Reader, signer PrivateKey) ([]byte, e
 	if err != nil {
 		return nil, err
 	}
-	return signInternal(h, signer.(*ed25519PrivateKey))
+	return signHash(h, signer)
 }
-func (s *ed25519Verifier) VerifyStream(data io.Reader, key PublicKey, signature []byte) (bool, error) {
+func (s *virgilVerifier) VerifyStream(data io.Reader, key PublicKey, signature []byte) (bool, error) {
 	if key == nil || key.Empty() {
 		return false, errors.New("key is nil")
 	}
@@ -92,7 +96,31 @@ func (s *ed25519Verifier) VerifyStream(data io.Reader, key PublicKey, signature
 	if err != nil {
 		return false, err
 	}
-	return verifyInternal(h, key.(*ed25519PublicKey), signature)
+	return verifyHash(h, key, signature)
+}
+
+func signHash(hash []byte, signer PrivateKey) ([]byte, error) {
+	algorithm, err := keyAlgorithmForPrivateKey(signer)
+	if err != nil {
+		return nil, err
+	}
+	sign, err := algorithm.Sign(hash, signer)
+	if err != nil {
+		return nil, err
+	}
+	return makeSignature(sign)
+}
+
+func verifyHash(hash []byte, key PublicKey, signature []byte) (bool, error) {
+	algorithm, err := keyAlgorithmForPublicKey(key)
+	if err != nil {
+		return false, err
+	}
+	sign, err := decodeSignature(signature)
+	if err != nil {
+		return false, err
+	}
+	return algorithm.Verify(hash, key, sign)
 }
 
 func signInternal(hash []byte, key *ed25519PrivateKey) ([]byte, error) {
@@ -103,16 +131,9 @@ func signInternal(hash []byte, key *ed25519PrivateKey) ([]byte, error) {
 	copy(private[:], key.contents())
 
 	sign := ed25519.Sign(private, hash[:])
-
-	sBytes, err := makeSignature(sign[:])
-
-	if err != nil {
-		return nil, err
-	}
-
-	return sBytes, nil
+	return sign[:], nil
 }
-func verifyInternal(hash []byte, key *ed25519PublicKey, signature []byte) (bool, error) {
+func verifyInternal(hash []byte, key *ed25519PublicKey, sign []byte) (bool, error) {
 	if key == nil || key.Empty() {
 		return false, CryptoError("public key for verification is not provided")
 	}
@@ -120,12 +141,6 @@ func verifyInternal(hash []byte, key *ed25519PublicKey, signature []byte) (bool,
 		return false, CryptoError("Invalid key size for signature")
 	}
 
-	sign, err := decodeSignature(signature)
-
-	if err != nil {
-		return false, err
-	}
-
 	if len(sign) != ed25519.SignatureSize {
 		return false, CryptoError("Invalid signature size " + strconv.Itoa(len(sign)))
 	}
@@ -142,6 +157,54 @@ func verifyInternal(hash []byte, key *ed25519PublicKey, signature []byte) (bool,
 	return true, nil
 }
 
+func signECDSA(hash []byte, key *ecPrivateKey) ([]byte, error) {
+	if key.Empty() {
+		return nil, CryptoError("No private key for signing")
+	}
+
+	sign, err := ecdsa.SignASN1(rand.Reader, key.key, hash)
+	if err != nil {
+		return nil, cryptoError(err, "")
+	}
+	return sign, nil
+}
+
+func verifyECDSA(hash []byte, key *ecPublicKey, sign []byte) (bool, error) {
+	if key.Empty() {
+		return false, CryptoError("public key for verification is not provided")
+	}
+
+	if !ecdsa.VerifyASN1(key.key, hash, sign) {
+		return false, CryptoError("signature validation failed")
+	}
+	return true, nil
+}
+
+//signRSAPSS uses RSASSA-PSS with SHA-384 and salt length equal to the hash size
+func signRSAPSS(hash []byte, key *rsaPrivateKey) ([]byte, error) {
+	if key.Empty() {
+		return nil, CryptoError("No private key for signing")
+	}
+
+	sign, err := rsa.SignPSS(rand.Reader, key.key, crypto.SHA384, hash, &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash})
+	if err != nil {
+		return nil, cryptoError(err, "")
+	}
+	return sign, nil
+}
+
+func verifyRSAPSS(hash []byte, key *rsaPublicKey, sign []byte) (bool, error) {
+	if key.Empty() {
+		return false, CryptoError("public key for verification is not provided")
+	}
+
+	err := rsa.VerifyPSS(key.key, crypto.SHA384, hash, sign, &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthAuto})
+	if err != nil {
+		return false, CryptoError("signature validation failed")
+	}
+	return true, nil
+}
+
 func hashStream(data io.Reader) ([]byte, error) {
 	hash := Hash.New()
 	buf := make([]byte, 1024*1024)
@@ -161,6 +224,6 @@ func hashStream(data io.Reader) ([]byte, error) {
 }
 
 func init() {
-	Signer = &ed25519Signer{}
-	Verifier = &ed25519Verifier{}
+	Signer = &virgilSigner{}
+	Verifier = &virgilVerifier{}
 }
@@ -0,0 +1,388 @@
+package virgilcrypto
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/subtle"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"sort"
+	"time"
+)
+
+//SignedDataOptions control NewSignedData
+type SignedDataOptions struct {
+	//Detached leaves the content out, it must then be passed to VerifyDetachedSignedData separately
+	Detached bool
+	//SigningTime is the current time if zero
+	SigningTime time.Time
+	//Certificates are DER encoded X.509 certificates embedded into SignedData, for example the chain of the signer
+	Certificates [][]byte
+}
+
+//SignedDataInfo describes verified SignedData
+type SignedDataInfo struct {
+	Content []byte
+	//SignerID is the ReceiverID of the key which verified the signature
+	SignerID     []byte
+	SigningTime  time.Time
+	Certificates [][]byte
+}
+
+//cmsSignatureScheme maps a key type to RFC 5652 digest and signature algorithms.
+//Ed25519 follows RFC 8419 and signs the encoded signed attributes, other keys sign their hash
+type cmsSignatureScheme struct {
+	digest             crypto.Hash
+	digestAlgorithm    pkix.AlgorithmIdentifier
+	signatureAlgorithm pkix.AlgorithmIdentifier
+	pure               bool
+}
+
+func cmsSignatureSchemeFor(key PublicKey) (*cmsSignatureScheme, error) {
+	switch key.(type) {
+	case *ed25519PublicKey:
+		return &cmsSignatureScheme{
+			digest:             crypto.SHA512,
+			digestAlgorithm:    pkix.AlgorithmIdentifier{Algorithm: oidSha512},
+			signatureAlgorithm: pkix.AlgorithmIdentifier{Algorithm: oidEd25519key},
+			pure:               true,
+		}, nil
+	case *ecPublicKey:
+		return &cmsSignatureScheme{
+			digest:             crypto.SHA384,
+			digestAlgorithm:    pkix.AlgorithmIdentifier{Algorithm: oidSha384},
+			signatureAlgorithm: pkix.AlgorithmIdentifier{Algorithm: oidEcdsaWithSha384},
+		}, nil
+	case *rsaPublicKey:
+		algorithm, err := makeRSAPSSAlgorithm()
+		if err != nil {
+			return nil, err
+		}
+		return &cmsSignatureScheme{
+			digest:             crypto.SHA384,
+			digestAlgorithm:    pkix.AlgorithmIdentifier{Algorithm: oidSha384},
+			signatureAlgorithm: algorithm,
+		}, nil
+	}
+	return nil, unsupported("key type for SignedData")
+}
+
+func (s *cmsSignatureScheme) toBeSigned(encodedAttrs []byte) []byte {
+	if s.pure {
+		return encodedAttrs
+	}
+	h := s.digest.New()
+	h.Write(encodedAttrs)
+	return h.Sum(nil)
+}
+
+//NewSignedData returns DER encoded RFC 5652 ContentInfo with SignedData. The signer is identified by subjectKeyIdentifier
+//equal to its ReceiverID. Content type, message digest and signing time are signed attributes
+func NewSignedData(content []byte, signer PrivateKey, opts *SignedDataOptions) ([]byte, error) {
+	if signer == nil || signer.Empty() {
+		return nil, CryptoError("no signer key provided")
+	}
+	if opts == nil {
+		opts = &SignedDataOptions{}
+	}
+
+	publicKey, err := signer.ExtractPublicKey()
+	if err != nil {
+		return nil, err
+	}
+	scheme, err := cmsSignatureSchemeFor(publicKey)
+	if err != nil {
+		return nil, err
+	}
+	algorithm, err := keyAlgorithmForPrivateKey(signer)
+	if err != nil {
+		return nil, err
+	}
+
+	signingTime := opts.SigningTime
+	if signingTime.IsZero() {
+		signingTime = time.Now()
+	}
+	h := scheme.digest.New()
+	h.Write(content)
+	attrs, err := makeSignedAttributes(oidData, h.Sum(nil), signingTime.UTC().Truncate(time.Second))
+	if err != nil {
+		return nil, err
+	}
+	encodedAttrs, err := asn1.Marshal(asn1.RawValue{Tag: asn1.TagSet, IsCompound: true, Bytes: attrs})
+	if err != nil {
+		return nil, cryptoError(err, "")
+	}
+	signature, err := algorithm.Sign(scheme.toBeSigned(encodedAttrs), signer)
+	if err != nil {
+		return nil, err
+	}
+
+	sd := signedData{
+		Version:          3,
+		DigestAlgorithms: []pkix.AlgorithmIdentifier{scheme.digestAlgorithm},
+		EncapContentInfo: encapsulatedContentInfo{EContentType: oidData},
+		SignerInfos: []signerInfo{{
+			Version:            3,
+			SID:                asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, Bytes: signer.ReceiverID()},
+			DigestAlgorithm:    scheme.digestAlgorithm,
+			SignedAttrs:        asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: attrs},
+			SignatureAlgorithm: scheme.signatureAlgorithm,
+			Signature:          signature,
+		}},
+	}
+	if !opts.Detached {
+		sd.EncapContentInfo.EContent = append([]byte{}, content...)
+	}
+	if len(opts.Certificates) > 0 {
+		for _, cert := range opts.Certificates {
+			if _, err = x509.ParseCertificate(cert); err != nil {
+				return nil, cryptoError(err, "invalid certificate")
+			}
+		}
+		sd.Certificates = asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: derSetOf(opts.Certificates)}
+	}
+
+	sdBytes, err := asn1.Marshal(sd)
+	if err != nil {
+		return nil, cryptoError(err, "")
+	}
+	res, err := asn1.Marshal(contentInfo{
+		ContentType: oidSignedData,
+		Content:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: sdBytes},
+	})
+	if err != nil {
+		return nil, cryptoError(err, "")
+	}
+	return res, nil
+}
+
+//VerifySignedData checks the signature of any signer which matches one of the verifier keys.
+//detachedContent must be nil unless the signature is detached, detached signatures of empty content
+//are checked with VerifyDetachedSignedData. Embedded certificates are returned but not validated
+func VerifySignedData(data, detachedContent []byte, verifierPublicKeys ...PublicKey) (*SignedDataInfo, error) {
+	return verifySignedData(data, detachedContent, detachedContent != nil, verifierPublicKeys)
+}
+
+//VerifyDetachedSignedData checks the detached signature of content, nil content is the same as empty one
+func VerifyDetachedSignedData(data, content []byte, verifierPublicKeys ...PublicKey) (*SignedDataInfo, error) {
+	if content == nil {
+		content = []byte{}
+	}
+	return verifySignedData(data, content, true, verifierPublicKeys)
+}
+
+func verifySignedData(data, detachedContent []byte, detached bool, verifierPublicKeys []PublicKey) (*SignedDataInfo, error) {
+	if len(verifierPublicKeys) == 0 {
+		return nil, CryptoError("no verifiers provided")
+	}
+
+	sd, err := decodeSignedData(data)
+	if err != nil {
+		return nil, err
+	}
+
+	content := sd.EncapContentInfo.EContent
+	switch {
+	case content == nil && !detached:
+		return nil, CryptoError("signature is detached, content must be provided with VerifyDetachedSignedData")
+	case content != nil && detached:
+		return nil, CryptoError("signed data already has the content")
+	case content == nil:
+		content = detachedContent
+	}
+
+	for i := range sd.SignerInfos {
+		si := &sd.SignerInfos[i]
+
+		var signerID []byte
+		if si.SID.Class == asn1.ClassContextSpecific && si.SID.Tag == 0 && !si.SID.IsCompound {
+			signerID = si.SID.Bytes
+		}
+
+		var signingTime time.Time
+		var verifiedBy PublicKey
+		err = verifySignature(signerID, verifierPublicKeys, func(key PublicKey) (bool, error) {
+			t, err := verifySignerInfo(si, key, sd.EncapContentInfo.EContentType, content)
+			if err != nil {
+				return false, err
+			}
+			signingTime, verifiedBy = t, key
+			return true, nil
+		})
+		if err != nil {
+			continue
+		}
+
+		certificates, err := splitDERSet(sd.Certificates.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		return &SignedDataInfo{
+			Content:      content,
+			SignerID:     verifiedBy.ReceiverID(),
+			SigningTime:  signingTime,
+			Certificates: certificates,
+		}, nil
+	}
+	return nil, CryptoError("Could not verify signature with provided public keys")
+}
+
+func decodeSignedData(data []byte) (*signedData, error) {
+	ci := &contentInfo{}
+	rest, err := asn1.Unmarshal(data, ci)
+	if err != nil {
+		return nil, cryptoError(err, "")
+	}
+	if len(rest) != 0 {
+		return nil, CryptoError("Some data is left after signed data parsing")
+	}
+	if err = ci.Validate(); err != nil {
+		return nil, err
+	}
+
+	sd := &signedData{}
+	if rest, err = asn1.Unmarshal(ci.Content.Bytes, sd); err != nil {
+		return nil, cryptoError(err, "")
+	}
+	if len(rest) != 0 {
+		return nil, CryptoError("Some data is left after signed data parsing")
+	}
+	if err = sd.Validate(); err != nil {
+		return nil, err
+	}
+	return sd, nil
+}
+
+//verifySignerInfo checks signed attributes against the content and the signature against the key, returning the signing time
+func verifySignerInfo(si *signerInfo, key PublicKey, contentType asn1.ObjectIdentifier, content []byte) (time.Time, error) {
+	scheme, err := cmsSignatureSchemeFor(key)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if _, isRSA := key.(*rsaPublicKey); isRSA {
+		err = checkRSAPSSAlgorithm(si.SignatureAlgorithm)
+	} else if !si.SignatureAlgorithm.Algorithm.Equal(scheme.signatureAlgorithm.Algorithm) {
+		err = unsupported("signature algorithm")
+	}
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	digest, err := hashByOid(si.DigestAlgorithm.Algorithm)
+	if err != nil || digest == crypto.SHA1 {
+		return time.Time{}, unsupported("digest algorithm")
+	}
+
+	attrContentType, messageDigest, signingTime, err := parseSignedAttributes(si.SignedAttrs.Bytes)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if !attrContentType.Equal(contentType) {
+		return time.Time{}, CryptoError("content type attribute does not match the content")
+	}
+	h := digest.New()
+	h.Write(content)
+	if subtle.ConstantTimeCompare(h.Sum(nil), messageDigest) != 1 {
+		return time.Time{}, CryptoError("message digest does not match the content")
+	}
+
+	//the signature covers signed attributes encoded as SET OF, not as the implicitly tagged field
+	encodedAttrs, err := asn1.Marshal(asn1.RawValue{Tag: asn1.TagSet, IsCompound: true, Bytes: si.SignedAttrs.Bytes})
+	if err != nil {
+		return time.Time{}, cryptoError(err, "")
+	}
+	algorithm, err := keyAlgorithmForPublicKey(key)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if ok, err := algorithm.Verify(scheme.toBeSigned(encodedAttrs), key, si.Signature); !ok || err != nil {
+		return time.Time{}, CryptoError("signature validation failed")
+	}
+	return signingTime, nil
+}
+
+//makeSignedAttributes returns DER encoded attributes without the SET header
+func makeSignedAttributes(contentType asn1.ObjectIdentifier, digest []byte, signingTime time.Time) ([]byte, error) {
+	values := []struct {
+		oid   asn1.ObjectIdentifier
+		value interface{}
+	}{
+		{oidAttrContentType, contentType},
+		{oidAttrMessageDigest, digest},
+		{oidAttrSigningTime, signingTime},
+	}
+
+	attrs := make([][]byte, 0, len(values))
+	for _, v := range values {
+		value, err := asn1.Marshal(v.value)
+		if err != nil {
+			return nil, cryptoError(err, "")
+		}
+		attr, err := asn1.Marshal(attribute{
+			Type:   v.oid,
+			Values: asn1.RawValue{Tag: asn1.TagSet, IsCompound: true, Bytes: value},
+		})
+		if err != nil {
+			return nil, cryptoError(err, "")
+		}
+		attrs = append(attrs, attr)
+	}
+	return derSetOf(attrs), nil
+}
+
+func parseSignedAttributes(data []byte) (contentType asn1.ObjectIdentifier, messageDigest []byte, signingTime time.Time, err error) {
+	seen := make(map[string]bool)
+	for rest := data; len(rest) > 0; {
+		attr := attribute{}
+		if rest, err = asn1.Unmarshal(rest, &attr); err != nil {
+			return nil, nil, time.Time{}, cryptoError(err, "")
+		}
+		if seen[attr.Type.String()] {
+			return nil, nil, time.Time{}, CryptoError("duplicate signed attribute")
+		}
+		seen[attr.Type.String()] = true
+
+		var value interface{}
+		switch {
+		case attr.Type.Equal(oidAttrContentType):
+			value = &contentType
+		case attr.Type.Equal(oidAttrMessageDigest):
+			value = &messageDigest
+		case attr.Type.Equal(oidAttrSigningTime):
+			value = &signingTime
+		default:
+			continue
+		}
+		//these attributes must have exactly one value
+		if tail, err := asn1.Unmarshal(attr.Values.Bytes, value); err != nil || len(tail) != 0 {
+			return nil, nil, time.Time{}, CryptoError("invalid signed attribute " + attr.Type.String())
+		}
+	}
+	if contentType == nil || messageDigest == nil {
+		return nil, nil, time.Time{}, CryptoError("content type and message digest attributes are required")
+	}
+	return contentType, messageDigest, signingTime, nil
+}
+
+//derSetOf concatenates encoded elements in DER SET OF order
+func derSetOf(elements [][]byte) []byte {
+	sorted := make([][]byte, len(elements))
+	copy(sorted, elements)
+	sort.Slice(sorted, func(i, j int) bool { return bytes.Compare(sorted[i], sorted[j]) < 0 })
+	return bytes.Join(sorted, nil)
+}
+
+func splitDERSet(data []byte) ([][]byte, error) {
+	var res [][]byte
+	for rest := data; len(rest) > 0; {
+		var element asn1.RawValue
+		var err error
+		if rest, err = asn1.Unmarshal(rest, &element); err != nil {
+			return nil, cryptoError(err, "")
+		}
+		res = append(res, element.FullBytes)
+	}
+	return res, nil
+}
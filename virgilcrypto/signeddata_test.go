@@ -0,0 +1,144 @@
+package virgilcrypto
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSignedData(t *testing.T) {
+	data := []byte("document to sign")
+
+	edKeypair, err := NewKeypair()
+	assert.NoError(t, err)
+	ecKeypair, err := generateECKeypair(elliptic.P384())
+	assert.NoError(t, err)
+	rsaKeypair, err := generateRSAKeypair(2048)
+	assert.NoError(t, err)
+	stdKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	signerKey, err := NewSignerPrivateKey(stdKey, nil)
+	assert.NoError(t, err)
+	signerPublicKey, err := signerKey.ExtractPublicKey()
+	assert.NoError(t, err)
+
+	signers := []struct {
+		private PrivateKey
+		public  PublicKey
+	}{
+		{edKeypair.PrivateKey(), edKeypair.PublicKey()},
+		{ecKeypair.PrivateKey(), ecKeypair.PublicKey()},
+		{rsaKeypair.PrivateKey(), rsaKeypair.PublicKey()},
+		{signerKey, signerPublicKey},
+	}
+
+	signingTime := time.Date(2020, 5, 1, 10, 0, 0, 0, time.UTC)
+	for _, s := range signers {
+		//attached
+		signed, err := NewSignedData(data, s.private, &SignedDataOptions{SigningTime: signingTime})
+		assert.NoError(t, err)
+
+		info, err := VerifySignedData(signed, nil, edKeypair.PublicKey(), s.public)
+		assert.NoError(t, err)
+		assert.Equal(t, data, info.Content)
+		assert.Equal(t, s.public.ReceiverID(), info.SignerID)
+		assert.True(t, signingTime.Equal(info.SigningTime))
+
+		_, err = VerifySignedData(signed, data, s.public)
+		assert.Error(t, err)
+
+		//detached
+		signed, err = NewSignedData(data, s.private, &SignedDataOptions{Detached: true})
+		assert.NoError(t, err)
+
+		info, err = VerifySignedData(signed, data, s.public)
+		assert.NoError(t, err)
+		assert.Equal(t, data, info.Content)
+		info, err = VerifyDetachedSignedData(signed, data, s.public)
+		assert.NoError(t, err)
+		assert.Equal(t, data, info.Content)
+
+		_, err = VerifySignedData(signed, nil, s.public)
+		assert.Error(t, err)
+		_, err = VerifyDetachedSignedData(signed, nil, s.public)
+		assert.Error(t, err)
+		_, err = VerifySignedData(signed, []byte("other document"), s.public)
+		assert.Error(t, err)
+
+		//signature is checked only with the key of the signer
+		other, err := NewKeypair()
+		assert.NoError(t, err)
+		_, err = VerifySignedData(signed, data, other.PublicKey())
+		assert.Error(t, err)
+	}
+
+	//empty content is not the same as detached one
+	signed, err := NewSignedData(nil, edKeypair.PrivateKey(), nil)
+	assert.NoError(t, err)
+	info, err := VerifySignedData(signed, nil, edKeypair.PublicKey())
+	assert.NoError(t, err)
+	assert.Empty(t, info.Content)
+	_, err = VerifyDetachedSignedData(signed, nil, edKeypair.PublicKey())
+	assert.Error(t, err)
+
+	//detached signature of empty content
+	signed, err = NewSignedData(nil, edKeypair.PrivateKey(), &SignedDataOptions{Detached: true})
+	assert.NoError(t, err)
+	for _, content := range [][]byte{nil, {}} {
+		info, err = VerifyDetachedSignedData(signed, content, edKeypair.PublicKey())
+		assert.NoError(t, err)
+		assert.Empty(t, info.Content)
+	}
+	_, err = VerifySignedData(signed, nil, edKeypair.PublicKey())
+	assert.Error(t, err)
+
+	//tampered signed data
+	signed, err = NewSignedData(data, edKeypair.PrivateKey(), nil)
+	assert.NoError(t, err)
+	for i := len(signed) - 10; i < len(signed); i++ {
+		tampered := append([]byte{}, signed...)
+		tampered[i] ^= 1
+		_, err = VerifySignedData(tampered, nil, edKeypair.PublicKey())
+		assert.Error(t, err)
+	}
+
+	_, err = NewSignedData(data, nil, nil)
+	assert.Error(t, err)
+	_, err = VerifySignedData(signed, nil)
+	assert.Error(t, err)
+}
+
+func TestSignedData_Certificates(t *testing.T) {
+	stdKey, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	assert.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "signer"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	cert, err := x509.CreateCertificate(rand.Reader, template, template, stdKey.Public(), stdKey)
+	assert.NoError(t, err)
+
+	key, err := NewSignerPrivateKey(stdKey, nil)
+	assert.NoError(t, err)
+	pub, err := key.ExtractPublicKey()
+	assert.NoError(t, err)
+
+	signed, err := NewSignedData([]byte("data"), key, &SignedDataOptions{Certificates: [][]byte{cert}})
+	assert.NoError(t, err)
+
+	info, err := VerifySignedData(signed, nil, pub)
+	assert.NoError(t, err)
+	assert.Equal(t, [][]byte{cert}, info.Certificates)
+
+	_, err = NewSignedData([]byte("data"), key, &SignedDataOptions{Certificates: [][]byte{[]byte("not a certificate")}})
+	assert.Error(t, err)
+}
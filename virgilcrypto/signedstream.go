@@ -0,0 +1,151 @@
+package virgilcrypto
+
+/*
+Copyright (C) 2016-2017 Virgil Security Inc.
+
+Lead Maintainer: Virgil Security Inc. <support@virgilsecurity.com>
+
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions
+are met:
+
+  (1) Redistributions of source code must retain the above copyright
+  notice, this list of conditions and the following disclaimer.
+
+  (2) Redistributions in binary form must reproduce the above copyright
+  notice, this list of conditions and the following disclaimer in
+  the documentation and/or other materials provided with the
+  distribution.
+
+  (3) Neither the name of the copyright holder nor the names of its
+  contributors may be used to endorse or promote products derived
+  from this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE AUTHOR ''AS IS'' AND ANY EXPRESS OR
+IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY DIRECT,
+INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+(INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT,
+STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING
+IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+POSSIBILITY OF SUCH DAMAGE.
+*/
+import (
+	"encoding/binary"
+	"hash"
+	"io"
+)
+
+//Signed streams keep the signature in a trailer appended to the plaintext before encryption:
+//data || signature || uint16 big endian signature length
+//The header advertises the trailer with signatureTrailerKey custom param
+const (
+	signatureTrailerKey     = "VIRGIL-DATA-SIGNATURE-TRAILER"
+	signatureTrailerVersion = 1
+	maxSignatureSize        = 4096
+	signatureLengthSize     = 2
+)
+
+//signingReader hashes everything which is read through it and appends the signature trailer at the end
+type signingReader struct {
+	in      io.Reader
+	hash    hash.Hash
+	signer  PrivateKey
+	trailer []byte
+	done    bool
+}
+
+func newSigningReader(in io.Reader, signer PrivateKey) *signingReader {
+	return &signingReader{in: in, hash: Hash.New(), signer: signer}
+}
+
+func (s *signingReader) Read(p []byte) (int, error) {
+	if !s.done {
+		n, err := s.in.Read(p)
+		s.hash.Write(p[:n])
+		if err == io.EOF {
+			s.done = true
+			if s.trailer, err = makeSignatureTrailer(s.hash.Sum(nil), s.signer); err != nil {
+				return n, err
+			}
+			if n > 0 {
+				return n, nil
+			}
+		} else {
+			return n, err
+		}
+	}
+
+	if len(s.trailer) == 0 {
+		return 0, io.EOF
+	}
+	n := copy(p, s.trailer)
+	s.trailer = s.trailer[n:]
+	return n, nil
+}
+
+func makeSignatureTrailer(hash []byte, signer PrivateKey) ([]byte, error) {
+	signature, err := signHash(hash, signer)
+	if err != nil {
+		return nil, err
+	}
+	if len(signature) > maxSignatureSize {
+		return nil, unsupported("signature size")
+	}
+	trailer := make([]byte, len(signature)+signatureLengthSize)
+	copy(trailer, signature)
+	binary.BigEndian.PutUint16(trailer[len(signature):], uint16(len(signature)))
+	return trailer, nil
+}
+
+//verifyingWriter passes decrypted data to the output holding back the bytes which may belong to the trailer
+type verifyingWriter struct {
+	out  io.Writer
+	hash hash.Hash
+	tail []byte
+}
+
+func newVerifyingWriter(out io.Writer) *verifyingWriter {
+	return &verifyingWriter{out: out, hash: Hash.New()}
+}
+
+func (v *verifyingWriter) Write(p []byte) (int, error) {
+	v.tail = append(v.tail, p...)
+	if flush := len(v.tail) - maxSignatureSize - signatureLengthSize; flush > 0 {
+		if err := v.flush(v.tail[:flush]); err != nil {
+			return 0, err
+		}
+		v.tail = append(v.tail[:0], v.tail[flush:]...)
+	}
+	return len(p), nil
+}
+
+func (v *verifyingWriter) flush(data []byte) error {
+	v.hash.Write(data)
+	written, err := v.out.Write(data)
+	if err != nil || written < len(data) {
+		return cryptoError(err, "could not write to the output stream")
+	}
+	return nil
+}
+
+//finish writes the rest of the data and returns the signature and the hash of the data
+func (v *verifyingWriter) finish() (signature, hash []byte, err error) {
+	if len(v.tail) < signatureLengthSize {
+		return nil, nil, CryptoError("signature trailer is missing")
+	}
+	signatureLength := int(binary.BigEndian.Uint16(v.tail[len(v.tail)-signatureLengthSize:]))
+	dataLength := len(v.tail) - signatureLengthSize - signatureLength
+	if dataLength < 0 {
+		return nil, nil, CryptoError("signature trailer is corrupted")
+	}
+	if err = v.flush(v.tail[:dataLength]); err != nil {
+		return nil, nil, err
+	}
+	return v.tail[dataLength : len(v.tail)-signatureLengthSize], v.hash.Sum(nil), nil
+}
@@ -0,0 +1,200 @@
+package virgilcrypto
+
+/*
+Copyright (C) 2016-2017 Virgil Security Inc.
+
+Lead Maintainer: Virgil Security Inc. <support@virgilsecurity.com>
+
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions
+are met:
+
+  (1) Redistributions of source code must retain the above copyright
+  notice, this list of conditions and the following disclaimer.
+
+  (2) Redistributions in binary form must reproduce the above copyright
+  notice, this list of conditions and the following disclaimer in
+  the documentation and/or other materials provided with the
+  distribution.
+
+  (3) Neither the name of the copyright holder nor the names of its
+  contributors may be used to endorse or promote products derived
+  from this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE AUTHOR ''AS IS'' AND ANY EXPRESS OR
+IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY DIRECT,
+INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+(INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT,
+STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING
+IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+POSSIBILITY OF SUCH DAMAGE.
+*/
+import (
+	"crypto"
+	"crypto/ecdsa"
+	stded25519 "crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+)
+
+//KeyDecrypter decrypts the symmetric key taken from the KeyTransRecipientInfo addressed to an opaque private key.
+//algorithm and encryptedKey are the same values the built in KeyAlgorithm would receive in DecryptKey
+type KeyDecrypter func(algorithm pkix.AlgorithmIdentifier, encryptedKey []byte) ([]byte, error)
+
+//signerPrivateKey is a private key which never leaves the device (PKCS#11 token, KMS, etc).
+//Signing goes through crypto.Signer, decryption through the KeyDecrypter callback
+type signerPrivateKey struct {
+	receiverID []byte
+	signer     crypto.Signer
+	decrypter  KeyDecrypter
+	publicKey  PublicKey
+}
+
+//NewSignerPrivateKey wraps crypto.Signer into a PrivateKey which can be used everywhere the library expects one.
+//Signer's public key must be ed25519, ECDSA (P-256, P-384, P-521) or RSA.
+//decrypter may be nil, then RSA keys are decrypted with signer's crypto.Decrypter implementation if it has one
+//and other keys can only be used for signing
+func NewSignerPrivateKey(signer crypto.Signer, decrypter KeyDecrypter) (PrivateKey, error) {
+	if signer == nil {
+		return nil, CryptoError("signer is nil")
+	}
+
+	pub, err := publicKeyFromCrypto(signer.Public())
+	if err != nil {
+		return nil, err
+	}
+
+	receiverID := make([]byte, len(pub.ReceiverID()))
+	copy(receiverID, pub.ReceiverID())
+
+	return &signerPrivateKey{
+		receiverID: receiverID,
+		signer:     signer,
+		decrypter:  decrypter,
+		publicKey:  pub,
+	}, nil
+}
+
+func publicKeyFromCrypto(key crypto.PublicKey) (PublicKey, error) {
+	switch k := key.(type) {
+	case stded25519.PublicKey:
+		edPublicKey := &ed25519PublicKey{key: []byte(k)}
+		snapshot, err := edPublicKey.Encode()
+		if err != nil {
+			return nil, err
+		}
+		edPublicKey.receiverID = DefaultCrypto.CalculateFingerprint(snapshot)
+		return edPublicKey, nil
+	case *ecdsa.PublicKey:
+		return newECPublicKey(k)
+	case *rsa.PublicKey:
+		return newRSAPublicKey(k)
+	}
+	return nil, unsupported("signer public key type")
+}
+
+func (k *signerPrivateKey) ReceiverID() []byte {
+	return k.receiverID
+}
+
+func (k *signerPrivateKey) Encode(password []byte) ([]byte, error) {
+	return nil, unsupported("export of the opaque private key")
+}
+
+func (k *signerPrivateKey) Empty() bool {
+	return k == nil || k.signer == nil
+}
+
+func (k *signerPrivateKey) ExtractPublicKey() (PublicKey, error) {
+	if k.Empty() {
+		return nil, CryptoError("private key is empty")
+	}
+	return k.publicKey, nil
+}
+
+//signerAlgorithm only works with opaque keys, it has no OID because such keys can not be decoded
+type signerAlgorithm struct{}
+
+func (a *signerAlgorithm) OID() asn1.ObjectIdentifier {
+	return nil
+}
+
+func (a *signerAlgorithm) SupportsPublicKey(key PublicKey) bool {
+	return false
+}
+
+func (a *signerAlgorithm) SupportsPrivateKey(key PrivateKey) bool {
+	_, ok := key.(*signerPrivateKey)
+	return ok
+}
+
+func (a *signerAlgorithm) DecodePublicKey(der []byte) (PublicKey, error) {
+	return nil, unsupported("key type")
+}
+
+func (a *signerAlgorithm) DecodePrivateKey(der []byte) (PrivateKey, error) {
+	return nil, unsupported("key type")
+}
+
+func (a *signerAlgorithm) EncryptKey(key PublicKey, symmetricKey []byte) (pkix.AlgorithmIdentifier, []byte, error) {
+	return pkix.AlgorithmIdentifier{}, nil, unsupported("public key type")
+}
+
+func (a *signerAlgorithm) DecryptKey(key PrivateKey, algorithm pkix.AlgorithmIdentifier, encryptedKey []byte) ([]byte, error) {
+	k := key.(*signerPrivateKey)
+	if k.decrypter != nil {
+		return k.decrypter(algorithm, encryptedKey)
+	}
+
+	decrypter, ok := k.signer.(crypto.Decrypter)
+	if _, isRSA := k.publicKey.(*rsaPublicKey); !ok || !isRSA {
+		return nil, unsupported("decryption with this key")
+	}
+
+	hash, err := decodeRSAOAEPAlgorithm(algorithm)
+	if err != nil {
+		return nil, err
+	}
+
+	symmetricKey, err := decrypter.Decrypt(rand.Reader, encryptedKey, &rsa.OAEPOptions{Hash: hash})
+	if err != nil {
+		return nil, cryptoError(err, "")
+	}
+	return symmetricKey, nil
+}
+
+//Sign produces the same raw signatures as the built in algorithms for the corresponding key type
+func (a *signerAlgorithm) Sign(hash []byte, key PrivateKey) ([]byte, error) {
+	k := key.(*signerPrivateKey)
+
+	var opts crypto.SignerOpts
+	switch k.publicKey.(type) {
+	case *ed25519PublicKey:
+		//ed25519 signs the hash itself as a message
+		opts = crypto.Hash(0)
+	case *ecPublicKey:
+		opts = crypto.SHA384
+	case *rsaPublicKey:
+		opts = &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash, Hash: crypto.SHA384}
+	default:
+		return nil, unsupported("signer public key type")
+	}
+
+	sign, err := k.signer.Sign(rand.Reader, hash, opts)
+	if err != nil {
+		return nil, cryptoError(err, "")
+	}
+	return sign, nil
+}
+
+func (a *signerAlgorithm) Verify(hash []byte, key PublicKey, signature []byte) (bool, error) {
+	return false, unsupported("public key type")
+}
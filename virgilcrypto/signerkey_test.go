@@ -0,0 +1,84 @@
+package virgilcrypto
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509/pkix"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSignerPrivateKey(t *testing.T) {
+	vcrypto := &VirgilCrypto{Cipher: NewCipher}
+	data := []byte("test data")
+
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	assert.NoError(t, err)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	assert.NoError(t, err)
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+
+	for _, signer := range []crypto.Signer{edKey, ecKey, rsaKey} {
+		key, err := NewSignerPrivateKey(signer, nil)
+		assert.NoError(t, err)
+
+		pub, err := vcrypto.ExtractPublicKey(key)
+		assert.NoError(t, err)
+		assert.Equal(t, key.ReceiverID(), pub.ReceiverID())
+
+		//public key is a regular one, it can be exported and imported back
+		exported, err := vcrypto.ExportPublicKey(pub)
+		assert.NoError(t, err)
+		pub, err = vcrypto.ImportPublicKey(exported)
+		assert.NoError(t, err)
+
+		signature, err := vcrypto.Sign(data, key)
+		assert.NoError(t, err)
+
+		ok, err := vcrypto.Verify(data, signature, pub)
+		assert.NoError(t, err)
+		assert.True(t, ok)
+
+		_, err = vcrypto.ExportPrivateKey(key, "")
+		assert.Error(t, err)
+	}
+
+	//*rsa.PrivateKey is a crypto.Decrypter as well
+	key, err := NewSignerPrivateKey(rsaKey, nil)
+	assert.NoError(t, err)
+	pub, err := vcrypto.ExtractPublicKey(key)
+	assert.NoError(t, err)
+
+	ciphertext, err := vcrypto.SignThenEncrypt(data, key, pub)
+	assert.NoError(t, err)
+	plaintext, err := vcrypto.DecryptThenVerify(ciphertext, key, pub)
+	assert.NoError(t, err)
+	assert.Equal(t, data, plaintext)
+
+	//EC keys need decrypter callback, here it delegates to the regular key
+	regularKey, err := newECPrivateKey(ecKey)
+	assert.NoError(t, err)
+	key, err = NewSignerPrivateKey(ecKey, func(algorithm pkix.AlgorithmIdentifier, encryptedKey []byte) ([]byte, error) {
+		return (&ecAlgorithm{}).DecryptKey(regularKey, algorithm, encryptedKey)
+	})
+	assert.NoError(t, err)
+	pub, err = vcrypto.ExtractPublicKey(key)
+	assert.NoError(t, err)
+
+	ciphertext, err = vcrypto.Encrypt(data, pub)
+	assert.NoError(t, err)
+	plaintext, err = vcrypto.Decrypt(ciphertext, key)
+	assert.NoError(t, err)
+	assert.Equal(t, data, plaintext)
+
+	key, err = NewSignerPrivateKey(ecKey, nil)
+	assert.NoError(t, err)
+	_, err = vcrypto.Decrypt(ciphertext, key)
+	assert.Error(t, err)
+}
@@ -65,5 +65,5 @@ func (c *aesGCMStreamCipher) Decrypt(key, nonce, ad []byte, in io.Reader, out io
 
 func init() {
 	StreamCipher = &aesGCMStreamCipher{}
-	ChunkCipher = &aesGCMChunkStreamCipher{}
+	ChunkCipher = &framedChunkCipher{}
 }
@@ -3,7 +3,10 @@ package virgilcrypto
 import (
 	"bytes"
 	"crypto/rand"
+	"encoding/asn1"
+	"io/ioutil"
 	"testing"
+	"testing/iotest"
 
 	"gopkg.in/virgil.v4/virgilcrypto/gcm"
 )
@@ -73,3 +76,239 @@ func TestChunk(t *testing.T) {
 		plain = append(plain, ad...)
 	}
 }
+
+func encryptChunks(t *testing.T, sc VirgilChunkCipher, key, nonce, plain []byte, chunkSize int) []byte {
+	out := &bytes.Buffer{}
+	if err := sc.Encrypt(key, nonce, nil, chunkSize, bytes.NewReader(plain), out); err != nil {
+		t.Fatalf("%+v", err)
+	}
+	return out.Bytes()
+}
+
+func TestChunk_Framing(t *testing.T) {
+	symmetricKey := make([]byte, 32)
+	nonce := make([]byte, 12)
+	rand.Reader.Read(symmetricKey)
+	rand.Reader.Read(nonce)
+
+	const chunkSize = 64
+	const size = chunkSize + gcmTagSize
+	sc := ChunkCipher
+
+	for _, l := range []int{0, 1, chunkSize - 1, chunkSize, chunkSize * 3, chunkSize*3 + 7} {
+		plain := make([]byte, l)
+		rand.Reader.Read(plain)
+		ciphertext := encryptChunks(t, sc, symmetricKey, nonce, plain, chunkSize)
+
+		//short reads
+		plainOut := &bytes.Buffer{}
+		err := sc.Decrypt(symmetricKey, nonce, nil, chunkSize, iotest.OneByteReader(bytes.NewReader(ciphertext)), plainOut)
+		if err != nil {
+			t.Fatalf("%d, %+v", l, err)
+		}
+		if !bytes.Equal(plain, plainOut.Bytes()) {
+			t.Fatalf("%d: plaintext and decrypted text do not match", l)
+		}
+
+		//truncation at every chunk boundary and inside the last chunk
+		for cut := 0; cut < len(ciphertext); cut += size {
+			if err = sc.Decrypt(symmetricKey, nonce, nil, chunkSize, bytes.NewReader(ciphertext[:cut]), &bytes.Buffer{}); err == nil {
+				t.Fatalf("%d: stream truncated to %d bytes was decrypted", l, cut)
+			}
+		}
+		if err = sc.Decrypt(symmetricKey, nonce, nil, chunkSize, bytes.NewReader(ciphertext[:len(ciphertext)-1]), &bytes.Buffer{}); err == nil {
+			t.Fatalf("%d: stream without last byte was decrypted", l)
+		}
+	}
+
+	//reordered chunks
+	plain := make([]byte, chunkSize*3)
+	ciphertext := encryptChunks(t, sc, symmetricKey, nonce, plain, chunkSize)
+	reordered := append(append(append([]byte{}, ciphertext[size:2*size]...), ciphertext[:size]...), ciphertext[2*size:]...)
+	if err := sc.Decrypt(symmetricKey, nonce, nil, chunkSize, bytes.NewReader(reordered), &bytes.Buffer{}); err == nil {
+		t.Fatal("reordered stream was decrypted")
+	}
+}
+
+func TestChunk_LegacyStream(t *testing.T) {
+	kp, err := NewKeypair()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := NewCipher().(*defaultCipher)
+	if err = c.AddKeyRecipient(kp.PublicKey()); err != nil {
+		t.Fatal(err)
+	}
+
+	//v1 stream has no chunk framing param
+	symmetricKey := make([]byte, 32)
+	nonce := make([]byte, 12)
+	rand.Reader.Read(symmetricKey)
+	rand.Reader.Read(nonce)
+	model, err := c.recipients[0].encryptKey(symmetricKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	header, err := composeCMSMessage(AESGCM, nonce, []*asn1.RawValue{model}, map[string]interface{}{"chunkSize": 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	plain := make([]byte, 1234)
+	rand.Reader.Read(plain)
+	stream := append(header, encryptChunks(t, &aesGCMChunkStreamCipher{}, symmetricKey, nonce, plain, 100)...)
+
+	plainOut := &bytes.Buffer{}
+	if err = c.DecryptStream(iotest.HalfReader(bytes.NewReader(stream)), plainOut, kp.PrivateKey()); err != nil {
+		t.Fatalf("%+v", err)
+	}
+	if !bytes.Equal(plain, plainOut.Bytes()) {
+		t.Fatal("plaintext and decrypted text do not match")
+	}
+}
+
+func TestChunk_FramingParamStripped_Fails(t *testing.T) {
+	kp, err := NewKeypair()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := NewCipher().(*defaultCipher)
+	if err = c.AddKeyRecipient(kp.PublicKey()); err != nil {
+		t.Fatal(err)
+	}
+
+	symmetricKey := make([]byte, 32)
+	nonce := make([]byte, 12)
+	rand.Reader.Read(symmetricKey)
+	rand.Reader.Read(nonce)
+	model, err := c.recipients[0].encryptKey(symmetricKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	//v2 chunks behind a header without the chunk framing param are decrypted as a legacy stream
+	header, err := composeCMSMessage(AESGCM, nonce, []*asn1.RawValue{model}, map[string]interface{}{"chunkSize": 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	plain := make([]byte, 200)
+	rand.Reader.Read(plain)
+	chunks := encryptChunks(t, ChunkCipher, symmetricKey, nonce, plain, 100)
+
+	for _, cut := range []int{100 + gcmTagSize, len(chunks)} {
+		stream := append(append([]byte{}, header...), chunks[:cut]...)
+		if err = c.DecryptStream(bytes.NewReader(stream), &bytes.Buffer{}, kp.PrivateKey()); err == nil {
+			t.Fatalf("stream of %d bytes without the chunk framing param was decrypted", cut)
+		}
+	}
+}
+
+type failingWriter struct{ left int }
+
+func (w *failingWriter) Write(p []byte) (int, error) {
+	if w.left < len(p) {
+		return 0, CryptoError("write failed")
+	}
+	w.left -= len(p)
+	return len(p), nil
+}
+
+func TestParallelChunkCipher(t *testing.T) {
+	symmetricKey := make([]byte, 32)
+	nonce := make([]byte, 12)
+	rand.Reader.Read(symmetricKey)
+	rand.Reader.Read(nonce)
+
+	const chunkSize = 64
+	const size = chunkSize + gcmTagSize
+	sequential := &framedChunkCipher{}
+
+	for _, workers := range []int{1, 3, 0} {
+		pc := NewParallelChunkCipher(workers)
+		for _, l := range []int{0, 1, chunkSize, chunkSize*50 + 7} {
+			plain := make([]byte, l)
+			rand.Reader.Read(plain)
+
+			//both ciphers produce the same stream
+			ciphertext := encryptChunks(t, pc, symmetricKey, nonce, plain, chunkSize)
+			if !bytes.Equal(ciphertext, encryptChunks(t, sequential, symmetricKey, nonce, plain, chunkSize)) {
+				t.Fatalf("%d, %d: parallel and sequential ciphertexts do not match", workers, l)
+			}
+
+			plainOut := &bytes.Buffer{}
+			err := pc.Decrypt(symmetricKey, nonce, nil, chunkSize, iotest.OneByteReader(bytes.NewReader(ciphertext)), plainOut)
+			if err != nil {
+				t.Fatalf("%d, %d, %+v", workers, l, err)
+			}
+			if !bytes.Equal(plain, plainOut.Bytes()) {
+				t.Fatalf("%d, %d: plaintext and decrypted text do not match", workers, l)
+			}
+
+			if err = pc.Decrypt(symmetricKey, nonce, nil, chunkSize, bytes.NewReader(ciphertext[:len(ciphertext)-1]), &bytes.Buffer{}); err == nil {
+				t.Fatalf("%d, %d: truncated stream was decrypted", workers, l)
+			}
+		}
+	}
+
+	pc := NewParallelChunkCipher(4)
+	plain := make([]byte, chunkSize*100)
+	ciphertext := encryptChunks(t, pc, symmetricKey, nonce, plain, chunkSize)
+
+	corrupted := append([]byte{}, ciphertext...)
+	corrupted[size*10] ^= 1
+	if err := pc.Decrypt(symmetricKey, nonce, nil, chunkSize, bytes.NewReader(corrupted), &bytes.Buffer{}); err == nil {
+		t.Fatal("corrupted stream was decrypted")
+	}
+
+	if err := pc.Encrypt(symmetricKey, nonce, nil, chunkSize, bytes.NewReader(plain), &failingWriter{left: size * 10}); err == nil {
+		t.Fatal("write error was not returned")
+	}
+	if err := pc.Encrypt(symmetricKey, nonce, nil, chunkSize, iotest.TimeoutReader(bytes.NewReader(plain)), &bytes.Buffer{}); err == nil {
+		t.Fatal("read error was not returned")
+	}
+}
+
+func benchmarkChunkCipher(b *testing.B, sc VirgilChunkCipher, decrypt bool) {
+	symmetricKey := make([]byte, 32)
+	nonce := make([]byte, 12)
+	rand.Reader.Read(symmetricKey)
+	rand.Reader.Read(nonce)
+
+	plain := make([]byte, 32*1024*1024)
+	ciphertext := &bytes.Buffer{}
+	if err := sc.Encrypt(symmetricKey, nonce, nil, DefaultChunkSize, bytes.NewReader(plain), ciphertext); err != nil {
+		b.Fatal(err)
+	}
+
+	b.SetBytes(int64(len(plain)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		var err error
+		if decrypt {
+			err = sc.Decrypt(symmetricKey, nonce, nil, DefaultChunkSize, bytes.NewReader(ciphertext.Bytes()), ioutil.Discard)
+		} else {
+			err = sc.Encrypt(symmetricKey, nonce, nil, DefaultChunkSize, bytes.NewReader(plain), ioutil.Discard)
+		}
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkChunkCipher_Encrypt(b *testing.B) {
+	benchmarkChunkCipher(b, &framedChunkCipher{}, false)
+}
+
+func BenchmarkChunkCipher_Decrypt(b *testing.B) {
+	benchmarkChunkCipher(b, &framedChunkCipher{}, true)
+}
+
+func BenchmarkParallelChunkCipher_Encrypt(b *testing.B) {
+	benchmarkChunkCipher(b, NewParallelChunkCipher(0), false)
+}
+
+func BenchmarkParallelChunkCipher_Decrypt(b *testing.B) {
+	benchmarkChunkCipher(b, NewParallelChunkCipher(0), true)
+}
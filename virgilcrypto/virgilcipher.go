@@ -36,8 +36,6 @@ IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
 POSSIBILITY OF SUCH DAMAGE.
 */
 import (
-	"crypto/aes"
-	"crypto/cipher"
 	"crypto/rand"
 	"crypto/subtle"
 	"encoding/asn1"
@@ -45,21 +43,33 @@ import (
 )
 
 type Cipher interface {
-	AddKeyRecipient(key *ed25519PublicKey) error
+	AddKeyRecipient(key PublicKey) error
 	AddPasswordRecipient(password []byte)
+	//SetContentCipher selects the algorithm which encrypts the data, AES-GCM is used by default.
+	//Decryption detects the algorithm from the envelope
+	SetContentCipher(content ContentCipher)
 	Encrypt(data []byte) ([]byte, error)
 	DecryptWithPassword(data []byte, password []byte) ([]byte, error)
-	DecryptWithPrivateKey(data []byte, key *ed25519PrivateKey) ([]byte, error)
+	DecryptWithPrivateKey(data []byte, key PrivateKey) ([]byte, error)
 	EncryptStream(in io.Reader, out io.Writer) error
-	DecryptStream(in io.Reader, out io.Writer, key *ed25519PrivateKey) error
-	SignThenEncrypt(data []byte, signerKey *ed25519PrivateKey) ([]byte, error)
-	DecryptThenVerify(data []byte, decryptionKey *ed25519PrivateKey, verifierPublicKeys ...*ed25519PublicKey) ([]byte, error)
+	DecryptStream(in io.Reader, out io.Writer, key PrivateKey) error
+	DecryptStreamWithPassword(in io.Reader, out io.Writer, password []byte) error
+	OpenSeekable(ciphertext io.ReaderAt, size int64, key PrivateKey) (*SeekableReader, error)
+	SignThenEncrypt(data []byte, signerKey PrivateKey) ([]byte, error)
+	SignThenEncryptMultiple(data []byte, signerKeys ...PrivateKey) ([]byte, error)
+	Countersign(data []byte, decryptionKey PrivateKey, signerKey PrivateKey) ([]byte, error)
+	DecryptThenVerify(data []byte, decryptionKey PrivateKey, verifierPublicKeys ...PublicKey) ([]byte, error)
+	DecryptThenVerifyWithPolicy(data []byte, decryptionKey PrivateKey, policy SignaturePolicy, verifierPublicKeys ...PublicKey) ([]byte, []PublicKey, error)
+	SignThenEncryptStream(in io.Reader, out io.Writer, signerKey PrivateKey) error
+	DecryptThenVerifyStream(in io.Reader, out io.Writer, decryptionKey PrivateKey, verifierPublicKeys ...PublicKey) error
 }
 
 type defaultCipher struct {
-	recipients   []recipient
-	streamCipher VirgilStreamCipher
-	chunkCipher  VirgilChunkCipher
+	recipients        []recipient
+	contentCipher     ContentCipher
+	streamCipher      VirgilStreamCipher
+	chunkCipher       VirgilChunkCipher
+	legacyChunkCipher VirgilChunkCipher
 }
 
 var newCipherFunc func() Cipher
@@ -73,21 +83,46 @@ func NewCipher() Cipher {
 	return newCipherFunc()
 }
 
-//recipient is a type that's responsible for encrypting\decrypting a random symmetric key
+//recipient is a type that's responsible for encrypting a random symmetric key.
+//Decryption is done by publicKeyRecipient with a PrivateKey or by passwordRecipient with a password
 type recipient interface {
 	encryptKey(symmetricKey []byte) (*asn1.RawValue, error)
-	decryptKey(id []byte, key []byte) ([]byte, error)
 }
 
-func (c *defaultCipher) AddKeyRecipient(key *ed25519PublicKey) error {
+//decryptSymmetricKey finds the recipient which matches private key and decrypts the symmetric key
+func decryptSymmetricKey(recipients []recipient, key PrivateKey) ([]byte, error) {
+	for _, r := range recipients {
+		if kr, ok := r.(*publicKeyRecipient); ok {
+			symmetricKey, err := kr.decryptKey(key)
+			if err == nil {
+				return symmetricKey, nil
+			}
+		}
+	}
+	return nil, CryptoError("Could not decrypt the symmetric key. Wrong private key?")
+}
+
+func decryptSymmetricKeyWithPassword(recipients []recipient, password []byte) ([]byte, error) {
+	for _, r := range recipients {
+		if pr, ok := r.(*passwordRecipient); ok {
+			symmetricKey, err := pr.decryptKey(password)
+			if err == nil {
+				return symmetricKey, nil
+			}
+		}
+	}
+	return nil, CryptoError("Could not decrypt the symmetric key. Wrong password?")
+}
+
+func (c *defaultCipher) AddKeyRecipient(key PublicKey) error {
 
 	if key == nil || key.Empty() {
 		return CryptoError("no public key provided")
 	}
 
-	recipient := &publicKeyRecipient{
-		ID:        key.ReceiverID(),
-		PublicKey: key.contents(),
+	recipient, err := newPublicKeyRecipient(key)
+	if err != nil {
+		return err
 	}
 
 	c.recipients = append(c.recipients, recipient)
@@ -99,6 +134,10 @@ func (c *defaultCipher) AddPasswordRecipient(password []byte) {
 
 	c.recipients = append(c.recipients, recipient)
 }
+func (c *defaultCipher) SetContentCipher(content ContentCipher) {
+	c.contentCipher = content
+}
+
 func (c *defaultCipher) Encrypt(data []byte) ([]byte, error) {
 	if len(c.recipients) == 0 {
 		return nil, CryptoError("No recipients specified")
@@ -106,42 +145,12 @@ func (c *defaultCipher) Encrypt(data []byte) ([]byte, error) {
 
 	var models []*asn1.RawValue
 
-	ciphertext, symmetricKey, nonce := encryptData(data)
-
-	for _, r := range c.recipients {
-		model, err := r.encryptKey(symmetricKey)
-		if err != nil {
-			return nil, err
-		}
-		models = append(models, model)
-	}
-
-	envelope, err := composeCMSMessage(nonce, models, nil)
-
-	if err != nil {
-		return nil, err
-	}
-	return append(envelope, ciphertext...), nil
-}
-
-func (c *defaultCipher) SignThenEncrypt(data []byte, signer *ed25519PrivateKey) ([]byte, error) {
-	if len(c.recipients) == 0 {
-		return nil, CryptoError("No recipients specified")
-	}
-
-	signature, err := Signer.Sign(data, signer)
+	content := orAESGCM(c.contentCipher)
+	ciphertext, symmetricKey, nonce, err := encryptData(content, data)
 	if err != nil {
 		return nil, err
 	}
 
-	customParams := map[string]interface{}{
-		signatureKey: signature,
-		signerId:     signer.receiverID,
-	}
-	var models []*asn1.RawValue
-
-	ciphertext, symmetricKey, nonce := encryptData(data)
-
 	for _, r := range c.recipients {
 		model, err := r.encryptKey(symmetricKey)
 		if err != nil {
@@ -150,7 +159,7 @@ func (c *defaultCipher) SignThenEncrypt(data []byte, signer *ed25519PrivateKey)
 		models = append(models, model)
 	}
 
-	envelope, err := composeCMSMessage(nonce, models, customParams)
+	envelope, err := composeCMSMessage(content, nonce, models, nil)
 
 	if err != nil {
 		return nil, err
@@ -158,119 +167,101 @@ func (c *defaultCipher) SignThenEncrypt(data []byte, signer *ed25519PrivateKey)
 	return append(envelope, ciphertext...), nil
 }
 
+func (c *defaultCipher) SignThenEncrypt(data []byte, signer PrivateKey) ([]byte, error) {
+	return c.SignThenEncryptMultiple(data, signer)
+}
+
 func (c *defaultCipher) DecryptWithPassword(data []byte, password []byte) ([]byte, error) {
-	_, ciphertext, nonce, recipients, err := decodeCMSMessage(data)
+	_, ciphertext, content, nonce, recipients, err := decodeCMSMessage(data)
 	if err != nil {
 		return nil, err
 	}
-	for _, r := range recipients {
-		key, err := r.decryptKey(nil, password)
-		if err == nil {
-			return decryptData(ciphertext, key, nonce)
-		}
-	}
-	return nil, CryptoError("Could not decrypt the symmetric key. Wrong password?")
-}
-func (c *defaultCipher) DecryptWithPrivateKey(data []byte, key *ed25519PrivateKey) ([]byte, error) {
-
-	if key == nil || len(key.contents()) == 0 {
-		return nil, CryptoError("no keypair provided")
-	}
-
-	_, ciphertext, nonce, recipients, err := decodeCMSMessage(data)
+	key, err := decryptSymmetricKeyWithPassword(recipients, password)
 	if err != nil {
 		return nil, err
 	}
-	for _, r := range recipients {
-		key, err := r.decryptKey(key.ReceiverID(), key.contents())
-		if err == nil {
-			return decryptData(ciphertext, key, nonce)
-		}
-
-	}
-	return nil, CryptoError("Could not decrypt the symmetric key. Wrong private key?")
+	return decryptData(content, ciphertext, key, nonce)
 }
+func (c *defaultCipher) DecryptWithPrivateKey(data []byte, key PrivateKey) ([]byte, error) {
 
-func (c *defaultCipher) DecryptThenVerify(data []byte, decryptionKey *ed25519PrivateKey, verifierPublicKeys ...*ed25519PublicKey) ([]byte, error) {
-
-	if decryptionKey == nil || decryptionKey.Empty() {
+	if key == nil || key.Empty() {
 		return nil, CryptoError("no keypair provided")
 	}
 
-	if len(verifierPublicKeys) == 0 {
-		return nil, CryptoError("no verifiers provided")
+	_, ciphertext, content, nonce, recipients, err := decodeCMSMessage(data)
+	if err != nil {
+		return nil, err
 	}
-
-	customParams, ciphertext, nonce, recipients, err := decodeCMSMessage(data)
+	symmetricKey, err := decryptSymmetricKey(recipients, key)
 	if err != nil {
 		return nil, err
 	}
+	return decryptData(content, ciphertext, symmetricKey, nonce)
+}
 
-	var signature, signerIdValue []byte
-	if len(customParams) > 0 {
+//DecryptThenVerify succeeds if the message has a valid signature of any of the verifier keys
+func (c *defaultCipher) DecryptThenVerify(data []byte, decryptionKey PrivateKey, verifierPublicKeys ...PublicKey) ([]byte, error) {
+	data, _, err := c.DecryptThenVerifyWithPolicy(data, decryptionKey, AnyOf(), verifierPublicKeys...)
+	return data, err
+}
 
-		if signatureValue, ok := customParams[signatureKey]; ok {
-			if tmp, ok := signatureValue.(*[]byte); ok {
-				signature = *tmp
-			} else {
-				return nil, CryptoError("got signature but could not decode")
+//verifySignature checks the signature with the key which matches signer id or tries all keys if there's no id
+func verifySignature(signerIdValue []byte, verifierPublicKeys []PublicKey, verify func(key PublicKey) (bool, error)) error {
+	for _, v := range verifierPublicKeys {
+		if len(signerIdValue) > 0 {
+			//found match
+			if subtle.ConstantTimeCompare(signerIdValue, v.ReceiverID()) == 1 {
+				res, err := verify(v)
+				if !res {
+					return CryptoError("signature validation failed")
+				}
+				if err != nil {
+					return err
+				}
+				return nil
 			}
-		}
-
-		if signerId, ok := customParams[signerId]; ok {
-			if tmp, ok := signerId.(*[]byte); ok {
-				signerIdValue = *tmp
-			} else {
-				return nil, CryptoError("got signerId but could not decode")
+		} else {
+			res, err := verify(v)
+			if res && err == nil {
+				return nil
 			}
 		}
 	}
-	for _, r := range recipients {
-		key, err := r.decryptKey(decryptionKey.ReceiverID(), decryptionKey.contents())
-		if err == nil {
-			data, err := decryptData(ciphertext, key, nonce)
-			if err != nil {
-				return nil, err
-			}
 
-			for _, v := range verifierPublicKeys {
-				if len(signerIdValue) > 0 {
-					//found match
-					if subtle.ConstantTimeCompare(signerIdValue, v.receiverID) == 1 {
-						res, err := Verifier.Verify(data, v, signature)
-						if !res {
-							return nil, CryptoError("signature validation failed")
-						}
-						if err != nil {
-							return nil, err
-						}
-						return data, nil
-					}
-				} else {
-					res, err := Verifier.Verify(data, v, signature)
-					if res && err == nil {
-						return data, nil
-					}
-				}
-			}
+	return CryptoError("Could not verify signature with provided public keys")
+}
 
-			return nil, CryptoError("Could not verify signature with provided public keys")
+func (c *defaultCipher) EncryptStream(in io.Reader, out io.Writer) error {
+	return c.encryptStream(in, out, nil)
+}
 
-		}
+func (c *defaultCipher) SignThenEncryptStream(in io.Reader, out io.Writer, signer PrivateKey) error {
+	if signer == nil || signer.Empty() {
+		return CryptoError("no signer key provided")
+	}
 
+	customParams := map[string]interface{}{
+		signatureTrailerKey: signatureTrailerVersion,
+		signerId:            signer.ReceiverID(),
 	}
-	return nil, CryptoError("Could not decrypt the symmetric key. Wrong private key?")
+	return c.encryptStream(newSigningReader(in, signer), out, customParams)
 }
 
-func (c *defaultCipher) EncryptStream(in io.Reader, out io.Writer) error {
+func (c *defaultCipher) encryptStream(in io.Reader, out io.Writer, customParams map[string]interface{}) error {
 	if len(c.recipients) == 0 {
 		return CryptoError("No recipients specified")
 	}
 
+	content := orAESGCM(c.contentCipher)
+	chunkCipher, err := c.chunkCipherFor(content)
+	if err != nil {
+		return err
+	}
+
 	var models []*asn1.RawValue
 
-	symmetricKey := make([]byte, 32) //256 bit AES key
-	nonce := make([]byte, 12)        //96 bit AES GCM nonce
+	symmetricKey := make([]byte, 32) //256 bit key
+	nonce := make([]byte, 12)        //96 bit nonce
 
 	rand.Reader.Read(symmetricKey)
 	rand.Reader.Read(nonce)
@@ -283,7 +274,15 @@ func (c *defaultCipher) EncryptStream(in io.Reader, out io.Writer) error {
 		models = append(models, model)
 	}
 
-	envelope, err := composeCMSMessage(nonce, models, map[string]interface{}{"chunkSize": DefaultChunkSize})
+	params := map[string]interface{}{
+		"chunkSize":     DefaultChunkSize,
+		chunkFramingKey: chunkFramingVersion,
+	}
+	for k, v := range customParams {
+		params[k] = v
+	}
+
+	envelope, err := composeCMSMessage(content, nonce, models, params)
 
 	if err != nil {
 		return err
@@ -293,94 +292,243 @@ func (c *defaultCipher) EncryptStream(in io.Reader, out io.Writer) error {
 		return cryptoError(err, "could not write to the output stream")
 	}
 
-	return c.chunkCipher.Encrypt(symmetricKey, nonce, nil, DefaultChunkSize, in, out)
+	return chunkCipher.Encrypt(symmetricKey, nonce, nil, DefaultChunkSize, in, out)
 }
-func (c *defaultCipher) DecryptStream(in io.Reader, out io.Writer, key *ed25519PrivateKey) error {
 
-	if key == nil || len(key.contents()) == 0 {
+//chunkCipherFor returns the chunk cipher which encrypts chunks with the content cipher
+func (c *defaultCipher) chunkCipherFor(content ContentCipher) (VirgilChunkCipher, error) {
+	if cc, ok := c.chunkCipher.(ContentChunkCipher); ok {
+		return cc.WithContentCipher(content), nil
+	}
+	if !isAESGCM(content) {
+		return nil, unsupported("content cipher for the chunk cipher")
+	}
+	return c.chunkCipher, nil
+}
+func (c *defaultCipher) DecryptStream(in io.Reader, out io.Writer, key PrivateKey) error {
+
+	if key == nil || key.Empty() {
+		return CryptoError("no keypair provided")
+	}
+
+	return c.decryptStream(in, out, func(recipients []recipient) ([]byte, error) {
+		return decryptSymmetricKey(recipients, key)
+	})
+}
+
+func (c *defaultCipher) DecryptStreamWithPassword(in io.Reader, out io.Writer, password []byte) error {
+	return c.decryptStream(in, out, func(recipients []recipient) ([]byte, error) {
+		return decryptSymmetricKeyWithPassword(recipients, password)
+	})
+}
+
+func (c *defaultCipher) decryptStream(in io.Reader, out io.Writer, decryptKey symmetricKeyDecrypter) error {
+	h, err := openStream(in, decryptKey)
+	if err != nil {
+		return err
+	}
+	//signature trailer would end up in out as if it were data
+	if _, ok := h.customParams[signatureTrailerKey]; ok {
+		return CryptoError("stream is signed, use DecryptThenVerifyStream")
+	}
+	return c.decryptStreamData(h, in, out)
+}
+
+func (c *defaultCipher) decryptStreamData(h *streamHeader, in io.Reader, out io.Writer) error {
+	if h.chunkSize > 0 {
+		framing, err := streamChunkFraming(h.customParams)
+		if err != nil {
+			return err
+		}
+		if framing == chunkFramingVersion {
+			chunkCipher, err := c.chunkCipherFor(h.content)
+			if err != nil {
+				return err
+			}
+			return chunkCipher.Decrypt(h.symmetricKey, h.nonce, nil, h.chunkSize, in, out)
+		}
+	}
+
+	//streams of the previous versions are always AES-GCM
+	if !isAESGCM(h.content) {
+		return unsupported("content cipher of the legacy stream")
+	}
+	if h.chunkSize > 0 {
+		return c.legacyChunkCipher.Decrypt(h.symmetricKey, h.nonce, nil, h.chunkSize, in, out)
+	}
+	return c.streamCipher.Decrypt(h.symmetricKey, h.nonce, nil, in, out)
+}
+
+//DecryptThenVerifyStream writes decrypted data to out as soon as it's available and checks the signature at the end.
+//If it returns error, everything written to out must be discarded
+func (c *defaultCipher) DecryptThenVerifyStream(in io.Reader, out io.Writer, decryptionKey PrivateKey, verifierPublicKeys ...PublicKey) error {
+
+	if decryptionKey == nil || decryptionKey.Empty() {
 		return CryptoError("no keypair provided")
 	}
 
-	//read header
+	if len(verifierPublicKeys) == 0 {
+		return CryptoError("no verifiers provided")
+	}
+
+	h, err := openStream(in, func(recipients []recipient) ([]byte, error) {
+		return decryptSymmetricKey(recipients, decryptionKey)
+	})
+	if err != nil {
+		return err
+	}
+
+	if v, ok := h.customParams[signatureTrailerKey].(*int); !ok || *v != signatureTrailerVersion {
+		return CryptoError("stream is not signed")
+	}
+
+	var signerIdValue []byte
+	if signerId, ok := h.customParams[signerId]; ok {
+		if tmp, ok := signerId.(*[]byte); ok {
+			signerIdValue = *tmp
+		} else {
+			return CryptoError("got signerId but could not decode")
+		}
+	}
+
+	writer := newVerifyingWriter(out)
+	if err = c.decryptStreamData(h, in, writer); err != nil {
+		return err
+	}
+
+	signature, hash, err := writer.finish()
+	if err != nil {
+		return err
+	}
+
+	return verifySignature(signerIdValue, verifierPublicKeys, func(v PublicKey) (bool, error) {
+		return verifyHash(hash, v, signature)
+	})
+}
+
+//symmetricKeyDecrypter picks the recipient it can decrypt and returns the symmetric key
+type symmetricKeyDecrypter func(recipients []recipient) ([]byte, error)
+
+//streamHeader is the parsed header of the stream along with the decrypted symmetric key
+type streamHeader struct {
+	customParams map[string]interface{}
+	content      ContentCipher
+	symmetricKey []byte
+	nonce        []byte
+	chunkSize    int
+}
+
+//openStream reads the header and decrypts the symmetric key, the stream is left at the first ciphertext byte
+func openStream(in io.Reader, decryptKey symmetricKeyDecrypter) (*streamHeader, error) {
+	customParams, content, nonce, recipients, err := readStreamHeader(in)
+	if err != nil {
+		return nil, err
+	}
+
+	chunkSize, err := streamChunkSize(customParams)
+	if err != nil {
+		return nil, err
+	}
+
+	symmetricKey, err := decryptKey(recipients)
+	if err != nil {
+		return nil, err
+	}
+	return &streamHeader{
+		customParams: customParams,
+		content:      content,
+		symmetricKey: symmetricKey,
+		nonce:        nonce,
+		chunkSize:    chunkSize,
+	}, nil
+}
+
+//readStreamHeader reads CMS envelope from the beginning of the stream leaving the stream at the first ciphertext byte
+func readStreamHeader(in io.Reader) (customParams map[string]interface{}, content ContentCipher, nonce []byte, recipients []recipient, err error) {
 	buf := make([]byte, 16)
-	read, err := in.Read(buf)
+	read, err := io.ReadFull(in, buf)
 	if read != len(buf) {
-		return cryptoError(err, "Could not read from stream")
+		return nil, nil, nil, nil, cryptoError(err, "Could not read from stream")
 	}
 	ret, offset, err := parseTagAndLength(buf, 0)
 	if err != nil {
-		return cryptoError(err, "Error while parsing stream header")
+		return nil, nil, nil, nil, cryptoError(err, "Error while parsing stream header")
 	}
 	if offset < len(buf) {
 		ret.length -= len(buf) - offset
 	}
+	if ret.length < 0 {
+		return nil, nil, nil, nil, CryptoError("Error while parsing stream header")
+	}
 
 	header := make([]byte, ret.length)
-	read, err = in.Read(header)
+	read, err = io.ReadFull(in, header)
 	if read != len(header) {
-		return cryptoError(err, "Could not read from stream")
+		return nil, nil, nil, nil, cryptoError(err, "Could not read from stream")
 	}
 	header = append(buf, header...)
-	customParams, rest, nonce, recipients, err := decodeCMSMessage(header)
+	customParams, rest, content, nonce, recipients, err := decodeCMSMessage(header)
+	if err != nil {
+		return nil, nil, nil, nil, err
+	}
+	if len(rest) != 0 {
+		return nil, nil, nil, nil, CryptoError("Some data is left after header parsing")
+	}
+	return customParams, content, nonce, recipients, nil
+}
+
+func streamChunkSize(customParams map[string]interface{}) (int, error) {
 	chunkSize := 0
 	if len(customParams) > 0 {
 		if chunkValue, ok := customParams["chunkSize"]; ok {
 			if tmp, ok := chunkValue.(*int); ok {
 				chunkSize = *tmp
 			} else {
-				return CryptoError("got chunkSize but could not decode")
+				return 0, CryptoError("got chunkSize but could not decode")
 			}
 
 		}
 	}
+	return chunkSize, nil
+}
 
-	if err != nil {
-		return err
+//streamChunkFraming returns 0 for legacy streams which have no chunk framing param
+func streamChunkFraming(customParams map[string]interface{}) (int, error) {
+	value, ok := customParams[chunkFramingKey]
+	if !ok {
+		return 0, nil
 	}
-	if len(rest) != 0 {
-		return CryptoError("Some data is left after header parsing")
+	framing, ok := value.(*int)
+	if !ok {
+		return 0, CryptoError("got chunk framing but could not decode")
 	}
-	for _, r := range recipients {
-		key, err := r.decryptKey(key.ReceiverID(), key.contents())
-		if err == nil {
-
-			if chunkSize > 0 {
-				return c.chunkCipher.Decrypt(key, nonce, nil, chunkSize, in, out)
-			}
-
-			return c.streamCipher.Decrypt(key, nonce, nil, in, out)
-		}
-
+	if *framing != chunkFramingVersion {
+		return 0, unsupported("chunk framing version")
 	}
-	return CryptoError("Could not decrypt the symmetric key. Wrong private key?")
+	return *framing, nil
 }
 
-func encryptData(data []byte) (cipherText, symmetricKey, nonce []byte) {
-	symmetricKey = make([]byte, 32) //256 bit AES key
-	nonce = make([]byte, 12)        //96 bit AES GCM nonce
+func encryptData(content ContentCipher, data []byte) (cipherText, symmetricKey, nonce []byte, err error) {
+	symmetricKey = make([]byte, 32) //256 bit key
+	nonce = make([]byte, 12)        //96 bit nonce
 
 	rand.Reader.Read(symmetricKey)
 	rand.Reader.Read(nonce)
 
-	ciph, _ := aes.NewCipher(symmetricKey)
-	aesGCM, _ := cipher.NewGCM(ciph)
-	cipherText = aesGCM.Seal(nil, nonce, data, nil)
-	return
-}
-func decryptData(ciphertext, key, nonce []byte) ([]byte, error) {
-	ciph, err := aes.NewCipher(key)
-
+	aead, err := content.NewAEAD(symmetricKey)
 	if err != nil {
-		return nil, cryptoError(err, "")
+		return nil, nil, nil, err
 	}
-
-	aesgcm, err := cipher.NewGCM(ciph)
-
+	cipherText = aead.Seal(nil, nonce, data, nil)
+	return
+}
+func decryptData(content ContentCipher, ciphertext, key, nonce []byte) ([]byte, error) {
+	aead, err := content.NewAEAD(key)
 	if err != nil {
-		return nil, cryptoError(err, "")
+		return nil, err
 	}
 
-	plaintext, err := aesgcm.Open(nil, nonce, ciphertext, nil)
+	plaintext, err := aead.Open(nil, nonce, ciphertext, nil)
 	if err != nil {
 		return nil, cryptoError(err, "")
 	}
@@ -390,8 +538,9 @@ func decryptData(ciphertext, key, nonce []byte) ([]byte, error) {
 func init() {
 	newCipherFunc = func() Cipher {
 		return &defaultCipher{
-			streamCipher: StreamCipher,
-			chunkCipher:  ChunkCipher,
+			streamCipher:      StreamCipher,
+			chunkCipher:       ChunkCipher,
+			legacyChunkCipher: &aesGCMChunkStreamCipher{},
 		}
 	}
 }
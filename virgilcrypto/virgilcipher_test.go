@@ -38,6 +38,8 @@ POSSIBILITY OF SUCH DAMAGE.
 import (
 	"bytes"
 	"crypto/rand"
+	"io"
+	"io/ioutil"
 	"testing"
 )
 
@@ -240,3 +242,331 @@ func TestStreamCipher(t *testing.T) {
 	}
 
 }
+
+func TestStreamCipherWithPassword(t *testing.T) {
+	keypair, err := NewKeypair()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	password := []byte("operator passphrase")
+
+	cipher := NewCipher()
+	cipher.AddPasswordRecipient(password)
+	if err = cipher.AddKeyRecipient(keypair.PublicKey()); err != nil {
+		t.Fatal(err)
+	}
+
+	plainBuf := make([]byte, DefaultChunkSize+1023)
+	rand.Read(plainBuf)
+	cipheredStream := &bytes.Buffer{}
+	err = cipher.EncryptStream(bytes.NewReader(plainBuf), cipheredStream)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	//decrypt with password
+	plainOutBuffer := &bytes.Buffer{}
+	err = cipher.DecryptStreamWithPassword(bytes.NewReader(cipheredStream.Bytes()), plainOutBuffer, password)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(plainBuf, plainOutBuffer.Bytes()) {
+		t.Fatal("plain & decrypted buffers do not match")
+	}
+
+	//the same stream can be decrypted with key
+	plainOutBuffer = &bytes.Buffer{}
+	err = cipher.DecryptStream(bytes.NewReader(cipheredStream.Bytes()), plainOutBuffer, keypair.PrivateKey())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(plainBuf, plainOutBuffer.Bytes()) {
+		t.Fatal("plain & decrypted buffers do not match")
+	}
+
+	//decrypt with wrong password must fail
+	err = cipher.DecryptStreamWithPassword(bytes.NewReader(cipheredStream.Bytes()), &bytes.Buffer{}, []byte("wrong"))
+	if err == nil {
+		t.Fatal("decrypt must fail but didn't")
+	}
+
+	//Crypto API
+	cipheredStream = &bytes.Buffer{}
+	err = DefaultCrypto.EncryptStreamWithPassword(bytes.NewReader(plainBuf), cipheredStream, string(password))
+	if err != nil {
+		t.Fatal(err)
+	}
+	plainOutBuffer = &bytes.Buffer{}
+	err = DefaultCrypto.DecryptStreamWithPassword(cipheredStream, plainOutBuffer, string(password))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(plainBuf, plainOutBuffer.Bytes()) {
+		t.Fatal("plain & decrypted buffers do not match")
+	}
+}
+
+func TestOpenSeekable(t *testing.T) {
+	keypair, err := NewKeypair()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer func(chunkSize int) { DefaultChunkSize = chunkSize }(DefaultChunkSize)
+	DefaultChunkSize = 100
+
+	for _, size := range []int{0, 1, 100, 1050} {
+		plain := make([]byte, size)
+		rand.Read(plain)
+		ciphertext := &bytes.Buffer{}
+		if err = DefaultCrypto.EncryptStream(bytes.NewReader(plain), ciphertext, keypair.PublicKey()); err != nil {
+			t.Fatal(err)
+		}
+		data := ciphertext.Bytes()
+
+		r, err := DefaultCrypto.OpenSeekable(bytes.NewReader(data), int64(len(data)), keypair.PrivateKey())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if r.Size() != int64(size) {
+			t.Fatalf("size %d expected %d", r.Size(), size)
+		}
+
+		//sequential read
+		res, err := ioutil.ReadAll(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(plain, res) {
+			t.Fatal("plain & decrypted buffers do not match")
+		}
+
+		//random ranges, including ones crossing chunk boundaries
+		for i := 0; i < 20 && size > 0; i++ {
+			var b [2]byte
+			rand.Read(b[:])
+			from := int(b[0]) * size / 256
+			to := from + int(b[1])
+			if to > size {
+				to = size
+			}
+			buf := make([]byte, to-from)
+			n, err := r.ReadAt(buf, int64(from))
+			if err != nil || n != len(buf) {
+				t.Fatalf("read %d bytes at %d: %v", n, from, err)
+			}
+			if !bytes.Equal(plain[from:to], buf) {
+				t.Fatalf("range %d-%d does not match", from, to)
+			}
+
+			if _, err = r.Seek(int64(from-size), io.SeekEnd); err != nil {
+				t.Fatal(err)
+			}
+			n, err = io.ReadFull(r, buf)
+			if err != nil || !bytes.Equal(plain[from:to], buf[:n]) {
+				t.Fatalf("range %d-%d does not match after seek: %v", from, to, err)
+			}
+		}
+
+		n, err := r.ReadAt(make([]byte, 10), int64(size))
+		if n != 0 || err != io.EOF {
+			t.Fatal("read past the end must return EOF")
+		}
+
+		//truncated stream fails on the last chunk
+		if size > 0 {
+			truncated := data[:len(data)-1]
+			r, err = DefaultCrypto.OpenSeekable(bytes.NewReader(truncated), int64(len(truncated)), keypair.PrivateKey())
+			if err == nil {
+				_, err = ioutil.ReadAll(r)
+			}
+			if err == nil {
+				t.Fatal("truncated stream was decrypted")
+			}
+		}
+	}
+
+	ciphertext := &bytes.Buffer{}
+	if err = DefaultCrypto.SignThenEncryptStream(bytes.NewReader([]byte("data")), ciphertext, keypair.PrivateKey(), keypair.PublicKey()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = DefaultCrypto.OpenSeekable(bytes.NewReader(ciphertext.Bytes()), int64(ciphertext.Len()), keypair.PrivateKey()); err == nil {
+		t.Fatal("signed streams must not be opened")
+	}
+}
+
+func TestEncryptingWriter(t *testing.T) {
+	keypair, err := NewKeypair()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer func(chunkSize int) { DefaultChunkSize = chunkSize }(DefaultChunkSize)
+	DefaultChunkSize = 100
+
+	for _, size := range []int{0, 1, 100, 1050} {
+		plain := make([]byte, size)
+		rand.Read(plain)
+
+		//written in small pieces
+		ciphertext := &bytes.Buffer{}
+		w := NewEncryptingWriter(ciphertext, keypair.PublicKey())
+		for p := plain; len(p) > 0; p = p[1+len(p)/3:] {
+			if _, err = w.Write(p[:1+len(p)/3]); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err = w.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		plainOut := &bytes.Buffer{}
+		if err = DefaultCrypto.DecryptStream(bytes.NewReader(ciphertext.Bytes()), plainOut, keypair.PrivateKey()); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(plain, plainOut.Bytes()) {
+			t.Fatal("plain & decrypted buffers do not match")
+		}
+
+		res, err := ioutil.ReadAll(NewDecryptingReader(bytes.NewReader(ciphertext.Bytes()), keypair.PrivateKey()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(plain, res) {
+			t.Fatal("plain & decrypted buffers do not match")
+		}
+
+		truncated := ciphertext.Bytes()[:ciphertext.Len()-1]
+		if _, err = ioutil.ReadAll(NewDecryptingReader(bytes.NewReader(truncated), keypair.PrivateKey())); err == nil {
+			t.Fatal("truncated stream was decrypted")
+		}
+	}
+
+	w := NewEncryptingWriter(ioutil.Discard)
+	if _, err = w.Write([]byte("data")); err == nil {
+		t.Fatal("writer without recipients must fail")
+	}
+	if err = w.Close(); err == nil {
+		t.Fatal("writer without recipients must fail")
+	}
+
+	//encryption stops when out fails
+	w = NewEncryptingWriter(&failingWriter{}, keypair.PublicKey())
+	if _, err = w.Write(make([]byte, 1000)); err == nil {
+		t.Fatal("write error was not returned")
+	}
+	if err = w.Close(); err == nil {
+		t.Fatal("write error was not returned by Close")
+	}
+
+	other, err := NewKeypair()
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := NewDecryptingReader(bytes.NewReader(nil), other.PrivateKey())
+	if _, err = r.Read(make([]byte, 10)); err == nil {
+		t.Fatal("empty stream was decrypted")
+	}
+	in := bytes.NewReader(make([]byte, 10000))
+	r = NewDecryptingReader(in, other.PrivateKey())
+	if err = r.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if in.Len() != 10000 {
+		t.Fatal("Close started decryption")
+	}
+	if _, err = r.Read(make([]byte, 10)); err != io.ErrClosedPipe {
+		t.Fatal("closed reader was read", err)
+	}
+}
+
+//aesOnlyChunkCipher does not implement ContentChunkCipher
+type aesOnlyChunkCipher struct{ VirgilChunkCipher }
+
+func TestContentCipher(t *testing.T) {
+	keypair, err := NewKeypair()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer func(chunkSize int) { DefaultChunkSize = chunkSize }(DefaultChunkSize)
+	DefaultChunkSize = 100
+
+	plain := make([]byte, 1050)
+	rand.Read(plain)
+
+	for _, content := range []ContentCipher{AESGCM, ChaCha20Poly1305} {
+		crypto := &VirgilCrypto{Cipher: NewCipher}
+		crypto.SetContentCipher(content)
+
+		ciphertext, err := crypto.Encrypt(plain, keypair.PublicKey())
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, _, detected, _, _, err := decodeCMSMessage(ciphertext)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !detected.OID().Equal(content.OID()) {
+			t.Fatalf("envelope has %v content cipher, expected %v", detected.OID(), content.OID())
+		}
+		//decryption does not need the content cipher to be set
+		res, err := DefaultCrypto.Decrypt(ciphertext, keypair.PrivateKey())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(plain, res) {
+			t.Fatal("plain & decrypted buffers do not match")
+		}
+
+		ciphertext, err = crypto.SignThenEncrypt(plain, keypair.PrivateKey(), keypair.PublicKey())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res, err = DefaultCrypto.DecryptThenVerify(ciphertext, keypair.PrivateKey(), keypair.PublicKey()); err != nil || !bytes.Equal(plain, res) {
+			t.Fatal("signed data was not decrypted", err)
+		}
+
+		stream := &bytes.Buffer{}
+		if err = crypto.EncryptStream(bytes.NewReader(plain), stream, keypair.PublicKey()); err != nil {
+			t.Fatal(err)
+		}
+		plainOut := &bytes.Buffer{}
+		if err = DefaultCrypto.DecryptStream(bytes.NewReader(stream.Bytes()), plainOut, keypair.PrivateKey()); err != nil || !bytes.Equal(plain, plainOut.Bytes()) {
+			t.Fatal("stream was not decrypted", err)
+		}
+		r, err := DefaultCrypto.OpenSeekable(bytes.NewReader(stream.Bytes()), int64(stream.Len()), keypair.PrivateKey())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res, err = ioutil.ReadAll(r); err != nil || !bytes.Equal(plain, res) {
+			t.Fatal("seekable stream was not decrypted", err)
+		}
+
+		//parallel chunk cipher produces the same stream
+		parallel := &defaultCipher{chunkCipher: NewParallelChunkCipher(2)}
+		plainOut.Reset()
+		if err = parallel.DecryptStream(bytes.NewReader(stream.Bytes()), plainOut, keypair.PrivateKey()); err != nil || !bytes.Equal(plain, plainOut.Bytes()) {
+			t.Fatal("stream was not decrypted by parallel chunk cipher", err)
+		}
+
+		stream.Reset()
+		if err = crypto.SignThenEncryptStream(bytes.NewReader(plain), stream, keypair.PrivateKey(), keypair.PublicKey()); err != nil {
+			t.Fatal(err)
+		}
+		plainOut.Reset()
+		if err = DefaultCrypto.DecryptThenVerifyStream(stream, plainOut, keypair.PrivateKey(), keypair.PublicKey()); err != nil || !bytes.Equal(plain, plainOut.Bytes()) {
+			t.Fatal("signed stream was not decrypted", err)
+		}
+	}
+
+	c := &defaultCipher{chunkCipher: &aesOnlyChunkCipher{&framedChunkCipher{}}}
+	c.SetContentCipher(ChaCha20Poly1305)
+	if err = c.AddKeyRecipient(keypair.PublicKey()); err != nil {
+		t.Fatal(err)
+	}
+	if err = c.EncryptStream(bytes.NewReader(plain), ioutil.Discard); err == nil {
+		t.Fatal("chunk cipher without content cipher support must not be used for ChaCha20-Poly1305")
+	}
+}
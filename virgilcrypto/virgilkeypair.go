@@ -58,6 +58,9 @@ var NewKeypair func() (Keypair, error)
 const EC_PRIVATE_KEY = "PRIVATE KEY"
 const ENCRYPTED_PRIVATE_KEY = "ENCRYPTED PRIVATE KEY"
 const PUBLIC_KEY = "PUBLIC KEY"
+const SEC1_PRIVATE_KEY = "EC PRIVATE KEY"
+const RSA_PRIVATE_KEY = "RSA PRIVATE KEY"
+const RSA_PUBLIC_KEY = "RSA PUBLIC KEY"
 
 const MINIMAL_KEY_LENGTH = 32
 
@@ -103,6 +106,25 @@ func (e *ed25519Keypair) PrivateKey() PrivateKey {
 	return e.privateKey
 }
 
+//keypair holds keys of any type other than ed25519
+type keypair struct {
+	publicKey  PublicKey
+	privateKey PrivateKey
+}
+
+func (e *keypair) HasPublic() bool {
+	return e.publicKey != nil && !e.publicKey.Empty()
+}
+func (e *keypair) HasPrivate() bool {
+	return e.privateKey != nil && !e.privateKey.Empty()
+}
+func (e *keypair) PublicKey() PublicKey {
+	return e.publicKey
+}
+func (e *keypair) PrivateKey() PrivateKey {
+	return e.privateKey
+}
+
 func unwrapKey(key []byte) ([]byte, string, error) {
 
 	if len(key) < MINIMAL_KEY_LENGTH {
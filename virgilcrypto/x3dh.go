@@ -4,46 +4,75 @@ import (
 	"github.com/agl/ed25519"
 	"github.com/agl/ed25519/extra25519"
 	"github.com/minio/sha256-simd"
-	"github.com/pkg/errors"
 	"golang.org/x/crypto/curve25519"
 	"golang.org/x/crypto/hkdf"
 )
 
-func X3DHInit(ICa, EKa PrivateKey, ICb, LTCb, OTCb PublicKey) ([]byte, error) {
+//PrekeyCard is a prekey along with the signature of its encoded form made with the identity key of the owner
+type PrekeyCard struct {
+	Key       PublicKey
+	Signature []byte
+}
 
-	edICa, ok := ICa.(*ed25519PrivateKey)
-	if !ok {
-		return nil, cryptoError(errors.New("non ed25519 private key"), "ICa")
+func SignPrekey(key PublicKey, identityKey PrivateKey) (*PrekeyCard, error) {
+	if key == nil || key.Empty() {
+		return nil, CryptoError("prekey is empty")
 	}
-
-	edEKa, ok := EKa.(*ed25519PrivateKey)
-	if !ok {
-		return nil, cryptoError(errors.New("non ed25519 private key"), "EKa")
+	data, err := key.Encode()
+	if err != nil {
+		return nil, err
+	}
+	signature, err := Signer.Sign(data, identityKey)
+	if err != nil {
+		return nil, err
 	}
+	return &PrekeyCard{Key: key, Signature: signature}, nil
+}
 
-	edICb, ok := ICb.(*ed25519PublicKey)
-	if !ok {
-		return nil, cryptoError(errors.New("non ed25519 public key"), "ICb")
+//Verify checks that the prekey was signed with the identity key
+func (p *PrekeyCard) Verify(identityKey PublicKey) error {
+	if p == nil || p.Key == nil || p.Key.Empty() {
+		return &InvalidPrekeyError{CryptoError("prekey is empty")}
+	}
+	if len(p.Signature) == 0 {
+		return &InvalidPrekeyError{CryptoError("prekey is not signed")}
+	}
+	data, err := p.Key.Encode()
+	if err != nil {
+		return err
+	}
+	if ok, err := Verifier.Verify(data, identityKey, p.Signature); !ok || err != nil {
+		return &InvalidPrekeyError{CryptoError("prekey signature is invalid")}
 	}
+	return nil
+}
 
-	edLTCb, ok := LTCb.(*ed25519PublicKey)
-	if !ok {
-		return nil, cryptoError(errors.New("non ed25519 public key"), "LTCb")
+//X3DHInit computes the initiator's shared secret. LTCb and OTCb, if present, must be signed with ICb,
+//otherwise the service could substitute the one-time prekey with its own and take part in the session
+func X3DHInit(ICa, EKa PrivateKey, ICb PublicKey, LTCb *PrekeyCard, OTCb *PrekeyCard) ([]byte, error) {
+
+	if err := LTCb.Verify(ICb); err != nil {
+		return nil, err
+	}
+	if OTCb != nil {
+		if err := OTCb.Verify(ICb); err != nil {
+			return nil, err
+		}
 	}
 
-	dh1, err := dhED25519(edICa, edLTCb)
+	dh1, err := dh(ICa, LTCb.Key)
 	if err != nil {
-		return nil, err
+		return nil, cryptoError(err, "ICa, LTCb")
 	}
 
-	dh2, err := dhED25519(edEKa, edICb)
+	dh2, err := dh(EKa, ICb)
 	if err != nil {
-		return nil, err
+		return nil, cryptoError(err, "EKa, ICb")
 	}
 
-	dh3, err := dhED25519(edEKa, edLTCb)
+	dh3, err := dh(EKa, LTCb.Key)
 	if err != nil {
-		return nil, err
+		return nil, cryptoError(err, "EKa, LTCb")
 	}
 
 	sk := append(dh1, dh2...)
@@ -51,14 +80,9 @@ func X3DHInit(ICa, EKa PrivateKey, ICb, LTCb, OTCb PublicKey) ([]byte, error) {
 
 	if OTCb != nil {
 
-		edOTCb, ok := OTCb.(*ed25519PublicKey)
-		if !ok {
-			return nil, cryptoError(errors.New("non ed25519 public key"), "LTCb")
-		}
-
-		dh4, err := dhED25519(edEKa, edOTCb)
+		dh4, err := dh(EKa, OTCb.Key)
 		if err != nil {
-			return nil, err
+			return nil, cryptoError(err, "EKa, OTCb")
 		}
 
 		sk = append(sk, dh4...)
@@ -74,39 +98,19 @@ func X3DHInit(ICa, EKa PrivateKey, ICb, LTCb, OTCb PublicKey) ([]byte, error) {
 
 func X3DHRespond(ICa, EKa PublicKey, ICb, LTCb, OTCb PrivateKey) ([]byte, error) {
 
-	edICa, ok := ICa.(*ed25519PublicKey)
-	if !ok {
-		return nil, cryptoError(errors.New("non ed25519 public key"), "ICa")
-	}
-
-	edEKa, ok := EKa.(*ed25519PublicKey)
-	if !ok {
-		return nil, cryptoError(errors.New("non ed25519 public key"), "EKa")
-	}
-
-	edICb, ok := ICb.(*ed25519PrivateKey)
-	if !ok {
-		return nil, cryptoError(errors.New("non ed25519 private key"), "ICb")
-	}
-
-	edLTCb, ok := LTCb.(*ed25519PrivateKey)
-	if !ok {
-		return nil, cryptoError(errors.New("non ed25519 private key"), "LTCb")
-	}
-
-	dh1, err := dhED25519(edLTCb, edICa)
+	dh1, err := dh(LTCb, ICa)
 	if err != nil {
-		return nil, err
+		return nil, cryptoError(err, "LTCb, ICa")
 	}
 
-	dh2, err := dhED25519(edICb, edEKa)
+	dh2, err := dh(ICb, EKa)
 	if err != nil {
-		return nil, err
+		return nil, cryptoError(err, "ICb, EKa")
 	}
 
-	dh3, err := dhED25519(edLTCb, edEKa)
+	dh3, err := dh(LTCb, EKa)
 	if err != nil {
-		return nil, err
+		return nil, cryptoError(err, "LTCb, EKa")
 	}
 
 	sk := append(dh1, dh2...)
@@ -114,14 +118,9 @@ func X3DHRespond(ICa, EKa PublicKey, ICb, LTCb, OTCb PrivateKey) ([]byte, error)
 
 	if OTCb != nil {
 
-		edOTCb, ok := OTCb.(*ed25519PrivateKey)
-		if !ok {
-			return nil, cryptoError(errors.New("non ed25519 private key"), "LTCb")
-		}
-
-		dh4, err := dhED25519(edOTCb, edEKa)
+		dh4, err := dh(OTCb, EKa)
 		if err != nil {
-			return nil, err
+			return nil, cryptoError(err, "OTCb, EKa")
 		}
 
 		sk = append(sk, dh4...)
@@ -23,7 +23,13 @@ func TestX3DH(t *testing.T) {
 	OTCb, err := NewKeypair()
 	assert.NoError(t, err)
 
-	sk1, err := X3DHInit(ICa.PrivateKey(), EKa.PrivateKey(), ICb.PublicKey(), LTCb.PublicKey(), OTCb.PublicKey())
+	signedLTCb, err := SignPrekey(LTCb.PublicKey(), ICb.PrivateKey())
+	assert.NoError(t, err)
+
+	signedOTCb, err := SignPrekey(OTCb.PublicKey(), ICb.PrivateKey())
+	assert.NoError(t, err)
+
+	sk1, err := X3DHInit(ICa.PrivateKey(), EKa.PrivateKey(), ICb.PublicKey(), signedLTCb, signedOTCb)
 	assert.NoError(t, err)
 
 	sk2, err := X3DHRespond(ICa.PublicKey(), EKa.PublicKey(), ICb.PrivateKey(), LTCb.PrivateKey(), OTCb.PrivateKey())
@@ -36,8 +42,51 @@ func TestX3DH(t *testing.T) {
 	assert.NoError(t, err)
 	assert.NotEqual(t, sk1, sk2)
 
-	sk1, err = X3DHInit(ICa.PrivateKey(), EKa.PrivateKey(), ICb.PublicKey(), LTCb.PublicKey(), nil)
+	sk1, err = X3DHInit(ICa.PrivateKey(), EKa.PrivateKey(), ICb.PublicKey(), signedLTCb, nil)
 	assert.NoError(t, err)
 	assert.Equal(t, sk1, sk2)
 
 }
+
+func TestX3DH_UnsignedPrekey(t *testing.T) {
+
+	ICa, err := NewKeypair()
+	assert.NoError(t, err)
+
+	EKa, err := NewKeypair()
+	assert.NoError(t, err)
+
+	ICb, err := NewKeypair()
+	assert.NoError(t, err)
+
+	LTCb, err := NewKeypair()
+	assert.NoError(t, err)
+
+	substituted, err := NewKeypair()
+	assert.NoError(t, err)
+
+	signed, err := SignPrekey(LTCb.PublicKey(), ICb.PrivateKey())
+	assert.NoError(t, err)
+
+	for _, prekey := range []*PrekeyCard{
+		nil,
+		{Key: LTCb.PublicKey()},
+		{Key: substituted.PublicKey(), Signature: signed.Signature},
+	} {
+		_, err = X3DHInit(ICa.PrivateKey(), EKa.PrivateKey(), ICb.PublicKey(), prekey, nil)
+		assert.IsType(t, &InvalidPrekeyError{}, err)
+	}
+
+	//signed by someone else
+	_, err = X3DHInit(ICa.PrivateKey(), EKa.PrivateKey(), substituted.PublicKey(), signed, nil)
+	assert.IsType(t, &InvalidPrekeyError{}, err)
+
+	//one-time prekey substituted by the service
+	for _, prekey := range []*PrekeyCard{
+		{Key: substituted.PublicKey()},
+		{Key: substituted.PublicKey(), Signature: signed.Signature},
+	} {
+		_, err = X3DHInit(ICa.PrivateKey(), EKa.PrivateKey(), ICb.PublicKey(), signed, prekey)
+		assert.IsType(t, &InvalidPrekeyError{}, err)
+	}
+}
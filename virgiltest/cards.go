@@ -0,0 +1,344 @@
+package virgiltest
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"gopkg.in/virgil.v4"
+	"gopkg.in/virgil.v4/virgilcrypto"
+)
+
+// error codes of the services, their messages are in the transport package
+const (
+	codeInternal               = 10000
+	codeAccessToken            = 20300
+	codeInvalidJSON            = 30000
+	codeDataInconsistency      = 30010
+	codeGlobalIdentityType     = 30100
+	codeInvalidScope           = 30101
+	codeTooManyDataEntries     = 30103
+	codeInvalidSnapshot        = 30107
+	codeInvalidSearch          = 30111
+	codeInvalidIdentityType    = 30113
+	codeEmptyIdentity          = 30114
+	codeInvalidPublicKey       = 30117
+	codeDataValueTooLong       = 30121
+	codeInvalidValidationToken = 30122
+	codeNoSignatures           = 30123
+	codeIrrelevantSigner       = 30126
+	codeInvalidSelfSignature   = 30127
+	codeInvalidAppSignature    = 30128
+	codeCardIDMismatch         = 30131
+	codeUnconfirmedGlobalCard  = 30137
+	codeCardExists             = 30138
+	codeInvalidRevocation      = 30139
+	codeInvalidRelationSign    = 30200
+	codeNoRelationSign         = 30201
+	codeNoRelatedCard          = 30202
+	codeRelationExists         = 30203
+	codeNoRelation             = 30205
+)
+
+const (
+	maxDataEntries     = 16
+	maxDataValueLength = 256
+)
+
+func (s *Server) getCard(r *http.Request, params []string) (interface{}, error) {
+	card, ok := s.cards[params[0]]
+	if !ok {
+		return nil, errNotFound
+	}
+	return card, nil
+}
+
+func (s *Server) searchCards(r *http.Request, params []string) (interface{}, error) {
+	criteria := &virgil.Criteria{}
+	if err := decode(r, criteria, codeInvalidJSON); err != nil {
+		return nil, err
+	}
+	if len(criteria.Identities) == 0 {
+		return nil, badRequest(codeInvalidSearch)
+	}
+	for _, identity := range criteria.Identities {
+		if identity == "" {
+			return nil, badRequest(codeInvalidSearch)
+		}
+	}
+	scope := criteria.Scope
+	if scope == "" {
+		scope = virgil.CardScope.Application
+	}
+	if !validScope(scope) {
+		return nil, badRequest(codeInvalidScope)
+	}
+
+	identities := make(map[string]bool)
+	for _, identity := range criteria.Identities {
+		identities[identity] = true
+	}
+	res := []*virgil.CardResponse{}
+	for _, card := range s.cards {
+		model, err := cardModel(card.Snapshot)
+		if err != nil {
+			continue
+		}
+		if model.Scope != scope || !identities[model.Identity] {
+			continue
+		}
+		if criteria.IdentityType != "" && model.IdentityType != criteria.IdentityType {
+			continue
+		}
+		res = append(res, card)
+	}
+	return res, nil
+}
+
+func (s *Server) createCard(r *http.Request, params []string) (interface{}, error) {
+	req := &virgil.SignableRequest{}
+	if err := decode(r, req, codeInvalidJSON); err != nil {
+		return nil, err
+	}
+	model, key, err := s.checkCardModel(req)
+	if err != nil {
+		return nil, err
+	}
+
+	id := fingerprint(req.Snapshot)
+	if len(req.Meta.Signatures) == 0 {
+		return nil, badRequest(codeNoSignatures)
+	}
+	selfSign, ok := req.Meta.Signatures[id]
+	if !ok {
+		return nil, badRequest(codeNoSignatures)
+	}
+	if !verifySignature(req.Snapshot, selfSign, key) {
+		return nil, badRequest(codeInvalidSelfSignature)
+	}
+
+	if model.Scope == virgil.CardScope.Application {
+		if err = s.checkAppSignatures(req, id); err != nil {
+			return nil, err
+		}
+	} else {
+		if err = s.useValidationToken(req, model.IdentityType, model.Identity); err != nil {
+			return nil, err
+		}
+	}
+
+	if _, ok := s.cards[id]; ok {
+		return nil, badRequest(codeCardExists)
+	}
+
+	card := &virgil.CardResponse{
+		ID:       id,
+		Snapshot: req.Snapshot,
+		Meta:     virgil.ResponseMeta{Signatures: make(map[string][]byte)},
+	}
+	for signer, sign := range req.Meta.Signatures {
+		card.Meta.Signatures[signer] = sign
+	}
+	if err = s.signCard(card); err != nil {
+		return nil, err
+	}
+	s.cards[id] = card
+	return card, nil
+}
+
+// checkCardModel validates the snapshot of the card request and returns its public key
+func (s *Server) checkCardModel(req *virgil.SignableRequest) (*virgil.CardModel, virgilcrypto.PublicKey, error) {
+	if len(req.Snapshot) == 0 {
+		return nil, nil, badRequest(codeInvalidSnapshot)
+	}
+	model, err := cardModel(req.Snapshot)
+	if err != nil {
+		return nil, nil, badRequest(codeInvalidSnapshot)
+	}
+
+	if !validScope(model.Scope) {
+		return nil, nil, badRequest(codeInvalidScope)
+	}
+	if model.IdentityType == "" {
+		return nil, nil, badRequest(codeInvalidIdentityType)
+	}
+	if model.Identity == "" {
+		return nil, nil, badRequest(codeEmptyIdentity)
+	}
+	//application cards are made by the service, so only email cards can be published globally
+	if model.Scope == virgil.CardScope.Global && model.IdentityType != "email" {
+		return nil, nil, badRequest(codeGlobalIdentityType)
+	}
+	if len(model.Data) > maxDataEntries {
+		return nil, nil, badRequest(codeTooManyDataEntries)
+	}
+	for _, v := range model.Data {
+		if len(v) > maxDataValueLength {
+			return nil, nil, badRequest(codeDataValueTooLong)
+		}
+	}
+
+	key, err := virgil.Crypto().ImportPublicKey(model.PublicKey)
+	if err != nil {
+		return nil, nil, badRequest(codeInvalidPublicKey)
+	}
+	return model, key, nil
+}
+
+// checkAppSignatures requires a valid signature of a registered application, all signers must be known
+func (s *Server) checkAppSignatures(req *virgil.SignableRequest, cardID string) error {
+	signed := false
+	for signer, sign := range req.Meta.Signatures {
+		if signer == cardID {
+			continue
+		}
+		key, ok := s.apps[signer]
+		if !ok {
+			return badRequest(codeIrrelevantSigner)
+		}
+		if !verifySignature(req.Snapshot, sign, key) {
+			return badRequest(codeInvalidAppSignature)
+		}
+		signed = true
+	}
+	if !signed {
+		return badRequest(codeInvalidAppSignature)
+	}
+	return nil
+}
+
+func (s *Server) revokeCard(r *http.Request, params []string) (interface{}, error) {
+	req := &virgil.SignableRequest{}
+	if err := decode(r, req, codeInvalidJSON); err != nil {
+		return nil, err
+	}
+	revoke := &virgil.RevokeCardRequest{}
+	if err := json.Unmarshal(req.Snapshot, revoke); err != nil {
+		return nil, badRequest(codeInvalidSnapshot)
+	}
+	if revoke.ID != params[0] {
+		return nil, badRequest(codeCardIDMismatch)
+	}
+	if revoke.RevocationReason != virgil.RevocationReason.Unspecified && revoke.RevocationReason != virgil.RevocationReason.Compromised {
+		return nil, badRequest(codeInvalidRevocation)
+	}
+	if len(req.Meta.Signatures) == 0 {
+		return nil, badRequest(codeNoSignatures)
+	}
+
+	card, ok := s.cards[revoke.ID]
+	if !ok {
+		return nil, errNotFound
+	}
+	model, err := cardModel(card.Snapshot)
+	if err != nil {
+		return nil, err
+	}
+
+	if model.Scope == virgil.CardScope.Application {
+		if err = s.checkAppSignatures(req, ""); err != nil {
+			return nil, err
+		}
+	} else {
+		//global cards are revoked by their owners
+		key, err := virgil.Crypto().ImportPublicKey(model.PublicKey)
+		if err != nil {
+			return nil, err
+		}
+		sign, ok := req.Meta.Signatures[card.ID]
+		if !ok {
+			return nil, badRequest(codeIrrelevantSigner)
+		}
+		if !verifySignature(req.Snapshot, sign, key) {
+			return nil, badRequest(codeInvalidSelfSignature)
+		}
+		if err = s.useValidationToken(req, model.IdentityType, model.Identity); err != nil {
+			return nil, err
+		}
+	}
+
+	delete(s.cards, card.ID)
+	delete(s.prekeys, card.ID)
+	return nil, nil
+}
+
+func (s *Server) addRelation(r *http.Request, params []string) (interface{}, error) {
+	trustor, ok := s.cards[params[0]]
+	if !ok {
+		return nil, errNotFound
+	}
+	req := &virgil.SignableRequest{}
+	if err := decode(r, req, codeInvalidJSON); err != nil {
+		return nil, err
+	}
+	if len(req.Snapshot) == 0 {
+		return nil, badRequest(codeNoRelatedCard)
+	}
+	relatedID := fingerprint(req.Snapshot)
+	if _, ok := s.cards[relatedID]; !ok {
+		return nil, badRequest(codeNoRelatedCard)
+	}
+	sign, err := s.checkRelationSignature(trustor, req)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := trustor.Meta.Relations[relatedID]; ok {
+		return nil, badRequest(codeRelationExists)
+	}
+	trustor.Meta.Relations[relatedID] = sign
+	return trustor, nil
+}
+
+func (s *Server) deleteRelation(r *http.Request, params []string) (interface{}, error) {
+	trustor, ok := s.cards[params[0]]
+	if !ok {
+		return nil, errNotFound
+	}
+	req := &virgil.SignableRequest{}
+	if err := decode(r, req, codeInvalidJSON); err != nil {
+		return nil, err
+	}
+	revoke := &virgil.RevokeCardRequest{}
+	if err := json.Unmarshal(req.Snapshot, revoke); err != nil {
+		return nil, badRequest(codeInvalidSnapshot)
+	}
+	if _, err := s.checkRelationSignature(trustor, req); err != nil {
+		return nil, err
+	}
+	if _, ok := trustor.Meta.Relations[revoke.ID]; !ok {
+		return nil, badRequest(codeNoRelation)
+	}
+	delete(trustor.Meta.Relations, revoke.ID)
+	return trustor, nil
+}
+
+// checkRelationSignature returns the signature of the request made by the trustor card
+func (s *Server) checkRelationSignature(trustor *virgil.CardResponse, req *virgil.SignableRequest) ([]byte, error) {
+	sign, ok := req.Meta.Signatures[trustor.ID]
+	if !ok || len(req.Meta.Signatures) != 1 {
+		return nil, badRequest(codeNoRelationSign)
+	}
+	model, err := cardModel(trustor.Snapshot)
+	if err != nil {
+		return nil, err
+	}
+	key, err := virgil.Crypto().ImportPublicKey(model.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+	if !verifySignature(req.Snapshot, sign, key) {
+		return nil, badRequest(codeInvalidRelationSign)
+	}
+	return sign, nil
+}
+
+func cardModel(snapshot []byte) (*virgil.CardModel, error) {
+	model := &virgil.CardModel{}
+	if err := json.Unmarshal(snapshot, model); err != nil {
+		return nil, err
+	}
+	return model, nil
+}
+
+func validScope(scope virgil.Enum) bool {
+	return scope == virgil.CardScope.Application || scope == virgil.CardScope.Global
+}
@@ -0,0 +1,165 @@
+package virgiltest
+
+import (
+	"fmt"
+	"net/http"
+	"net/mail"
+	"time"
+
+	"gopkg.in/virgil.v4"
+)
+
+const (
+	codeIdentityInvalidJSON = 40000
+	codeIdentityType        = 40100
+	codeInvalidTTL          = 40110
+	codeInvalidCTL          = 40120
+	codeTokenMissing        = 40130
+	codeTokenMismatch       = 40140
+	codeTokenExpired        = 40150
+	codeTokenInvalid        = 40170
+	codeInvalidEmail        = 40200
+	codeInvalidConfirmation = 40210
+	codeIdentityNotFound    = 41000
+)
+
+const (
+	defaultTokenTTL = time.Hour
+	defaultTokenCTL = 1
+)
+
+// identityAction is a verification waiting for the code sent to the identity
+type identityAction struct {
+	identityType string
+	identity     string
+	code         string
+}
+
+// validationToken proves the identity, it can be used a limited number of times before it expires
+type validationToken struct {
+	identityType string
+	identity     string
+	expires      time.Time
+	countLeft    int
+}
+
+// ConfirmationCode returns the code the identity service would send for the verification action
+func (s *Server) ConfirmationCode(actionID string) (string, bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	action, ok := s.actions[actionID]
+	if !ok {
+		return "", false
+	}
+	return action.code, true
+}
+
+func (s *Server) verifyIdentity(r *http.Request, params []string) (interface{}, error) {
+	req := &virgil.VerifyRequest{}
+	if err := decode(r, req, codeIdentityInvalidJSON); err != nil {
+		return nil, err
+	}
+	if req.Type != "email" {
+		return nil, badRequest(codeIdentityType)
+	}
+	if _, err := mail.ParseAddress(req.Value); err != nil {
+		return nil, badRequest(codeInvalidEmail)
+	}
+
+	id := randomHex(16)
+	s.actions[id] = &identityAction{
+		identityType: req.Type,
+		identity:     req.Value,
+		code:         fmt.Sprintf("%06d", randomNumber(1000000)),
+	}
+	return &virgil.VerifyResponse{ActionId: id}, nil
+}
+
+func (s *Server) confirmIdentity(r *http.Request, params []string) (interface{}, error) {
+	req := &virgil.ConfirmRequest{}
+	if err := decode(r, req, codeIdentityInvalidJSON); err != nil {
+		return nil, err
+	}
+	action, ok := s.actions[req.ActionId]
+	if !ok {
+		return nil, badRequest(codeIdentityNotFound)
+	}
+	if req.ConfirmationCode != action.code {
+		return nil, badRequest(codeInvalidConfirmation)
+	}
+	if req.Params.TimeToLive < 0 {
+		return nil, badRequest(codeInvalidTTL)
+	}
+	if req.Params.CountToLive < 0 {
+		return nil, badRequest(codeInvalidCTL)
+	}
+
+	ttl := time.Duration(req.Params.TimeToLive) * time.Second
+	if ttl == 0 {
+		ttl = defaultTokenTTL
+	}
+	ctl := req.Params.CountToLive
+	if ctl == 0 {
+		ctl = defaultTokenCTL
+	}
+
+	delete(s.actions, req.ActionId)
+	token := randomHex(32)
+	s.tokens[token] = &validationToken{
+		identityType: action.identityType,
+		identity:     action.identity,
+		expires:      s.now().Add(ttl),
+		countLeft:    ctl,
+	}
+	return &virgil.ConfirmResponse{
+		Type:            action.identityType,
+		Value:           action.identity,
+		ValidationToken: token,
+	}, nil
+}
+
+func (s *Server) validateIdentity(r *http.Request, params []string) (interface{}, error) {
+	req := &virgil.ValidateRequest{}
+	if err := decode(r, req, codeIdentityInvalidJSON); err != nil {
+		return nil, err
+	}
+	if req.ValidationToken == "" {
+		return nil, badRequest(codeTokenMissing)
+	}
+	if _, err := s.checkToken(req.ValidationToken, req.Type, req.Value); err != nil {
+		return nil, err
+	}
+	return nil, nil
+}
+
+// checkToken returns the token if it's valid for the identity
+func (s *Server) checkToken(value, identityType, identity string) (*validationToken, error) {
+	token, ok := s.tokens[value]
+	if !ok {
+		return nil, badRequest(codeTokenInvalid)
+	}
+	if !s.now().Before(token.expires) || token.countLeft <= 0 {
+		delete(s.tokens, value)
+		return nil, badRequest(codeTokenExpired)
+	}
+	if token.identityType != identityType || token.identity != identity {
+		return nil, badRequest(codeTokenMismatch)
+	}
+	return token, nil
+}
+
+// useValidationToken checks the token of the card request and counts its use
+func (s *Server) useValidationToken(req *virgil.SignableRequest, identityType, identity string) error {
+	if req.Meta.Validation == nil || req.Meta.Validation.Token == "" {
+		return badRequest(codeUnconfirmedGlobalCard)
+	}
+	token, err := s.checkToken(req.Meta.Validation.Token, identityType, identity)
+	if err != nil {
+		return badRequest(codeInvalidValidationToken)
+	}
+	token.countLeft--
+	if token.countLeft == 0 {
+		delete(s.tokens, req.Meta.Validation.Token)
+	}
+	return nil
+}
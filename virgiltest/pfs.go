@@ -0,0 +1,197 @@
+package virgiltest
+
+import (
+	"encoding/base64"
+	"net/http"
+
+	"gopkg.in/virgil.v4"
+	"gopkg.in/virgil.v4/virgilcrypto"
+)
+
+// prekeySupply keeps prekeys of an identity card, one-time prekeys are given out in the order of upload
+type prekeySupply struct {
+	longTerm  *virgil.CardResponse
+	oneTime   []*virgil.CardResponse
+	exhausted map[string]bool
+}
+
+func (s *Server) supply(identityCardID string) *prekeySupply {
+	supply, ok := s.prekeys[identityCardID]
+	if !ok {
+		supply = &prekeySupply{exhausted: make(map[string]bool)}
+		s.prekeys[identityCardID] = supply
+	}
+	return supply
+}
+
+func (s *Server) uploadPrekeys(r *http.Request, params []string) (interface{}, error) {
+	identityCard, ok := s.cards[params[0]]
+	if !ok {
+		return nil, errNotFound
+	}
+	req := &virgil.PrekeysRequest{}
+	if err := decode(r, req, codeInvalidJSON); err != nil {
+		return nil, err
+	}
+	if req.LongTermCard == nil {
+		return nil, badRequest(codeInvalidSnapshot)
+	}
+	longTerm, err := s.checkPrekey(identityCard, req.LongTermCard)
+	if err != nil {
+		return nil, err
+	}
+	oneTime, err := s.checkPrekeys(identityCard, req.OneTimeCards)
+	if err != nil {
+		return nil, err
+	}
+
+	supply := s.supply(identityCard.ID)
+	supply.longTerm = longTerm
+	supply.oneTime = append(supply.oneTime, oneTime...)
+	return &virgil.PrekeysResponse{LongTermCard: longTerm, OneTimeCards: oneTime}, nil
+}
+
+func (s *Server) uploadOneTimePrekeys(r *http.Request, params []string) (interface{}, error) {
+	identityCard, ok := s.cards[params[0]]
+	if !ok {
+		return nil, errNotFound
+	}
+	req := &virgil.PrekeysRequest{}
+	if err := decode(r, req, codeInvalidJSON); err != nil {
+		return nil, err
+	}
+	if len(req.OneTimeCards) == 0 {
+		return nil, badRequest(codeInvalidSnapshot)
+	}
+	oneTime, err := s.checkPrekeys(identityCard, req.OneTimeCards)
+	if err != nil {
+		return nil, err
+	}
+
+	supply := s.supply(identityCard.ID)
+	supply.oneTime = append(supply.oneTime, oneTime...)
+	return oneTime, nil
+}
+
+func (s *Server) claimPrekeys(r *http.Request, params []string) (interface{}, error) {
+	req := &virgil.ClaimPrekeysRequest{}
+	if err := decode(r, req, codeInvalidJSON); err != nil {
+		return nil, err
+	}
+	if len(req.IdentityCardIDs) == 0 {
+		return nil, badRequest(codeInvalidSearch)
+	}
+
+	res := []*virgil.PrekeyBundleResponse{}
+	for _, id := range req.IdentityCardIDs {
+		identityCard, ok := s.cards[id]
+		supply, hasPrekeys := s.prekeys[id]
+		if !ok || !hasPrekeys || supply.longTerm == nil {
+			continue
+		}
+		bundle := &virgil.PrekeyBundleResponse{IdentityCard: identityCard, LongTermCard: supply.longTerm}
+		if len(supply.oneTime) > 0 {
+			bundle.OneTimeCard, supply.oneTime = supply.oneTime[0], supply.oneTime[1:]
+			supply.exhausted[bundle.OneTimeCard.ID] = true
+		}
+		res = append(res, bundle)
+	}
+	return res, nil
+}
+
+func (s *Server) countOneTimePrekeys(r *http.Request, params []string) (interface{}, error) {
+	if _, ok := s.cards[params[0]]; !ok {
+		return nil, errNotFound
+	}
+	supply := s.supply(params[0])
+	return &virgil.PrekeyCount{Active: len(supply.oneTime), Exhausted: len(supply.exhausted)}, nil
+}
+
+// validateOneTimePrekeys returns ids of the prekeys which can't be claimed anymore
+func (s *Server) validateOneTimePrekeys(r *http.Request, params []string) (interface{}, error) {
+	if _, ok := s.cards[params[0]]; !ok {
+		return nil, errNotFound
+	}
+	req := &virgil.ValidateOneTimePrekeysRequest{}
+	if err := decode(r, req, codeInvalidJSON); err != nil {
+		return nil, err
+	}
+
+	active := make(map[string]bool)
+	for _, card := range s.supply(params[0]).oneTime {
+		active[card.ID] = true
+	}
+	res := &virgil.ValidateOneTimePrekeysResponse{Exhausted: []string{}}
+	for _, id := range req.OneTimeCardIDs {
+		if !active[id] {
+			res.Exhausted = append(res.Exhausted, id)
+		}
+	}
+	return res, nil
+}
+
+func (s *Server) checkPrekeys(identityCard *virgil.CardResponse, reqs []*virgil.SignableRequest) ([]*virgil.CardResponse, error) {
+	cards := []*virgil.CardResponse{}
+	ids := make(map[string]bool)
+	for _, req := range reqs {
+		if req == nil {
+			return nil, badRequest(codeInvalidSnapshot)
+		}
+		card, err := s.checkPrekey(identityCard, req)
+		if err != nil {
+			return nil, err
+		}
+		if ids[card.ID] {
+			return nil, badRequest(codeCardExists)
+		}
+		ids[card.ID] = true
+		cards = append(cards, card)
+	}
+	return cards, nil
+}
+
+// checkPrekey requires the prekey card of the same identity signed with the identity card key
+// along with the prekey signature in the card data, and returns the card signed by the service
+func (s *Server) checkPrekey(identityCard *virgil.CardResponse, req *virgil.SignableRequest) (*virgil.CardResponse, error) {
+	model, key, err := s.checkCardModel(req)
+	if err != nil {
+		return nil, err
+	}
+	identity, err := cardModel(identityCard.Snapshot)
+	if err != nil {
+		return nil, err
+	}
+	if model.Identity != identity.Identity || model.IdentityType != identity.IdentityType {
+		return nil, badRequest(codeDataInconsistency)
+	}
+	identityKey, err := virgil.Crypto().ImportPublicKey(identity.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	sign, ok := req.Meta.Signatures[identityCard.ID]
+	if !ok {
+		return nil, badRequest(codeNoSignatures)
+	}
+	if !verifySignature(req.Snapshot, sign, identityKey) {
+		return nil, badRequest(codeInvalidSelfSignature)
+	}
+	prekeySign, err := base64.StdEncoding.DecodeString(model.Data[virgil.PrekeySignatureField])
+	if err != nil {
+		return nil, badRequest(codeInvalidSelfSignature)
+	}
+	prekey := &virgilcrypto.PrekeyCard{Key: key, Signature: prekeySign}
+	if err = prekey.Verify(identityKey); err != nil {
+		return nil, badRequest(codeInvalidSelfSignature)
+	}
+
+	card := &virgil.CardResponse{
+		ID:       fingerprint(req.Snapshot),
+		Snapshot: req.Snapshot,
+		Meta:     virgil.ResponseMeta{Signatures: map[string][]byte{identityCard.ID: sign}},
+	}
+	if err = s.signCard(card); err != nil {
+		return nil, err
+	}
+	return card, nil
+}
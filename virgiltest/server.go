@@ -0,0 +1,298 @@
+// Package virgiltest provides an in-memory implementation of the Virgil card, identity and PFS services for tests.
+//
+//	server, err := virgiltest.NewServer("token")
+//	defer server.Close()
+//	client, err := server.Client()
+//
+// The server checks request signatures and validation tokens like the real services do, signs cards with its own service key
+// and answers with the same error codes. Confirmation codes which the identity service sends by email are returned by ConfirmationCode
+package virgiltest
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/virgil.v4"
+	"gopkg.in/virgil.v4/transport/endpoints"
+	"gopkg.in/virgil.v4/transport/virgilhttp"
+	"gopkg.in/virgil.v4/virgilcrypto"
+)
+
+// Server is the fake service, all services share its URL. It is safe for concurrent use
+type Server struct {
+	*httptest.Server
+
+	accessToken   string
+	serviceCardID string
+	serviceKey    virgilcrypto.PrivateKey
+	servicePublic virgilcrypto.PublicKey
+	routes        []route
+	now           func() time.Time
+
+	lock    sync.Mutex
+	apps    map[string]virgilcrypto.PublicKey
+	cards   map[string]*virgil.CardResponse
+	actions map[string]*identityAction
+	tokens  map[string]*validationToken
+	prekeys map[string]*prekeySupply
+}
+
+type handler func(s *Server, r *http.Request, params []string) (interface{}, error)
+
+type route struct {
+	endpoint endpoints.Endpoint
+	method   string
+	path     *regexp.Regexp
+}
+
+var handlers = map[endpoints.Endpoint]handler{
+	endpoints.GetCard:                (*Server).getCard,
+	endpoints.SearchCards:            (*Server).searchCards,
+	endpoints.CreateCard:             (*Server).createCard,
+	endpoints.RevokeCard:             (*Server).revokeCard,
+	endpoints.AddRelation:            (*Server).addRelation,
+	endpoints.DeleteRelation:         (*Server).deleteRelation,
+	endpoints.VerifyIdentity:         (*Server).verifyIdentity,
+	endpoints.ConfirmIdentity:        (*Server).confirmIdentity,
+	endpoints.ValidateIdentity:       (*Server).validateIdentity,
+	endpoints.UploadPrekeys:          (*Server).uploadPrekeys,
+	endpoints.UploadOneTimePrekeys:   (*Server).uploadOneTimePrekeys,
+	endpoints.ClaimPrekeys:           (*Server).claimPrekeys,
+	endpoints.CountOneTimePrekeys:    (*Server).countOneTimePrekeys,
+	endpoints.ValidateOneTimePrekeys: (*Server).validateOneTimePrekeys,
+}
+
+// NewServer starts the service which accepts requests with the access token
+func NewServer(accessToken string) (*Server, error) {
+	s := &Server{
+		accessToken: accessToken,
+		now:         time.Now,
+		apps:        make(map[string]virgilcrypto.PublicKey),
+		cards:       make(map[string]*virgil.CardResponse),
+		actions:     make(map[string]*identityAction),
+		tokens:      make(map[string]*validationToken),
+		prekeys:     make(map[string]*prekeySupply),
+	}
+
+	//routes are made of the same endpoints the HTTP transport calls
+	for e, ep := range virgilhttp.HTTPEndpoints {
+		parts := strings.Split(strings.TrimPrefix(ep.URL, "%s"), "%s")
+		for i := range parts {
+			parts[i] = regexp.QuoteMeta(parts[i])
+		}
+		s.routes = append(s.routes, route{
+			endpoint: e,
+			method:   ep.Method,
+			path:     regexp.MustCompile("^" + strings.Join(parts, "([^/]+)") + "$"),
+		})
+	}
+
+	keypair, err := virgil.Crypto().GenerateKeypair()
+	if err != nil {
+		return nil, err
+	}
+	s.serviceKey, s.servicePublic = keypair.PrivateKey(), keypair.PublicKey()
+	serviceCard, err := s.newCard("cards@virgilsecurity.com", "application", virgil.CardScope.Global, keypair)
+	if err != nil {
+		return nil, err
+	}
+	s.serviceCardID = serviceCard.ID
+	if err = s.signCard(serviceCard); err != nil {
+		return nil, err
+	}
+	s.cards[serviceCard.ID] = serviceCard
+
+	s.Server = httptest.NewServer(s)
+	return s, nil
+}
+
+// ServiceCardID returns the id of the card whose key signs all cards of the server
+func (s *Server) ServiceCardID() string {
+	return s.serviceCardID
+}
+
+// ServicePublicKey returns the key which signs all cards of the server
+func (s *Server) ServicePublicKey() virgilcrypto.PublicKey {
+	return s.servicePublic
+}
+
+// Validator returns a cards validator which checks the service signature of the server
+func (s *Server) Validator() *virgil.VirgilCardValidator {
+	v := virgil.NewCardsValidator()
+	v.AddVerifier(s.serviceCardID, s.servicePublic)
+	return v
+}
+
+// Client returns a client of the server which validates its cards. The options can override the transport and the validator
+func (s *Server) Client(opts ...func(*virgil.Client)) (*virgil.Client, error) {
+	transport := virgilhttp.NewTransportClient(s.URL, s.URL, s.URL, s.URL, virgilhttp.TransportClientPFSServiceURL(s.URL))
+	return virgil.NewClient(s.accessToken, append([]func(*virgil.Client){
+		virgil.ClientTransport(transport),
+		virgil.ClientCardsValidator(s.Validator()),
+	}, opts...)...)
+}
+
+// NewApp creates an application card and registers it, so application cards signed with the returned key are accepted
+func (s *Server) NewApp(bundle string) (appCardID string, appKey virgilcrypto.PrivateKey, err error) {
+	keypair, err := virgil.Crypto().GenerateKeypair()
+	if err != nil {
+		return "", nil, err
+	}
+	card, err := s.newCard(bundle, "application", virgil.CardScope.Global, keypair)
+	if err != nil {
+		return "", nil, err
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if err = s.signCard(card); err != nil {
+		return "", nil, err
+	}
+	s.cards[card.ID] = card
+	s.apps[card.ID] = keypair.PublicKey()
+	return card.ID, keypair.PrivateKey(), nil
+}
+
+// RegisterApp makes the server accept application cards signed by the key of the app card
+func (s *Server) RegisterApp(appCardID string, appKey virgilcrypto.PublicKey) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.apps[appCardID] = appKey
+}
+
+// newCard returns a self signed card which is not stored yet
+func (s *Server) newCard(identity, identityType string, scope virgil.Enum, keypair virgilcrypto.Keypair) (*virgil.CardResponse, error) {
+	req, err := virgil.NewCreateCardRequest(identity, identityType, keypair.PublicKey(), virgil.CardParams{Scope: scope})
+	if err != nil {
+		return nil, err
+	}
+	if err = (&virgil.RequestSigner{}).SelfSign(req, keypair.PrivateKey()); err != nil {
+		return nil, err
+	}
+	return &virgil.CardResponse{
+		ID:       fingerprint(req.Snapshot),
+		Snapshot: req.Snapshot,
+		Meta:     virgil.ResponseMeta{Signatures: req.Meta.Signatures},
+	}, nil
+}
+
+// signCard adds the service signature and the meta of the service
+func (s *Server) signCard(card *virgil.CardResponse) error {
+	fp := virgil.Crypto().CalculateFingerprint(card.Snapshot)
+	sign, err := virgil.Crypto().Sign(fp, s.serviceKey)
+	if err != nil {
+		return err
+	}
+	if card.Meta.Signatures == nil {
+		card.Meta.Signatures = make(map[string][]byte)
+	}
+	card.Meta.Signatures[s.serviceCardID] = sign
+	card.Meta.CreatedAt = s.now().UTC().Format(time.RFC3339)
+	card.Meta.CardVersion = "4.0"
+	if card.Meta.Relations == nil {
+		card.Meta.Relations = make(map[string][]byte)
+	}
+	return nil
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Authorization") != "VIRGIL "+s.accessToken {
+		writeError(w, &serviceError{status: http.StatusUnauthorized, code: codeAccessToken})
+		return
+	}
+
+	for _, rt := range s.routes {
+		if rt.method != r.Method {
+			continue
+		}
+		match := rt.path.FindStringSubmatch(r.URL.Path)
+		if match == nil {
+			continue
+		}
+
+		s.lock.Lock()
+		res, err := handlers[rt.endpoint](s, r, match[1:])
+		s.lock.Unlock()
+
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		if res == nil {
+			res = struct{}{}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(res)
+		return
+	}
+	writeError(w, errNotFound)
+}
+
+// serviceError is answered with the HTTP status and the service error code
+type serviceError struct {
+	status int
+	code   int
+}
+
+func (e *serviceError) Error() string {
+	return fmt.Sprintf("service error %d", e.code)
+}
+
+func badRequest(code int) error {
+	return &serviceError{status: http.StatusBadRequest, code: code}
+}
+
+var errNotFound = &serviceError{status: http.StatusNotFound}
+
+func writeError(w http.ResponseWriter, err error) {
+	e, ok := err.(*serviceError)
+	if !ok {
+		e = &serviceError{status: http.StatusInternalServerError, code: codeInternal}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(e.status)
+	json.NewEncoder(w).Encode(map[string]int{"code": e.code})
+}
+
+// decode reads the JSON body, the error has the code the service uses for invalid JSON
+func decode(r *http.Request, v interface{}, code int) error {
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		return badRequest(code)
+	}
+	return nil
+}
+
+func fingerprint(snapshot []byte) string {
+	return hex.EncodeToString(virgil.Crypto().CalculateFingerprint(snapshot))
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
+
+func randomNumber(max int64) int64 {
+	n, err := rand.Int(rand.Reader, big.NewInt(max))
+	if err != nil {
+		panic(err)
+	}
+	return n.Int64()
+}
+
+// verifySignature checks the signature of the snapshot fingerprint made with the key
+func verifySignature(snapshot, signature []byte, key virgilcrypto.PublicKey) bool {
+	ok, err := virgil.Crypto().Verify(virgil.Crypto().CalculateFingerprint(snapshot), signature, key)
+	return ok && err == nil
+}
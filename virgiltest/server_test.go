@@ -0,0 +1,301 @@
+package virgiltest
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/virgil.v4"
+	"gopkg.in/virgil.v4/errors"
+	"gopkg.in/virgil.v4/transport/virgilhttp"
+	"gopkg.in/virgil.v4/virgilcrypto"
+)
+
+type testEnv struct {
+	server *Server
+	client *virgil.Client
+	appID  string
+	appKey virgilcrypto.PrivateKey
+}
+
+func newTestEnv(t *testing.T) *testEnv {
+	server, err := NewServer("token")
+	assert.NoError(t, err)
+	appID, appKey, err := server.NewApp("com.example.app")
+	assert.NoError(t, err)
+	client, err := server.Client()
+	assert.NoError(t, err)
+	return &testEnv{server: server, client: client, appID: appID, appKey: appKey}
+}
+
+func (e *testEnv) createCard(t *testing.T, identity string) (*virgil.Card, virgilcrypto.PrivateKey) {
+	kp, err := virgil.Crypto().GenerateKeypair()
+	assert.NoError(t, err)
+	req, err := virgil.NewCreateCardRequest(identity, "username", kp.PublicKey(), virgil.CardParams{})
+	assert.NoError(t, err)
+	signer := &virgil.RequestSigner{}
+	assert.NoError(t, signer.SelfSign(req, kp.PrivateKey()))
+	assert.NoError(t, signer.AuthoritySign(req, e.appID, e.appKey))
+
+	card, err := e.client.CreateCard(req)
+	assert.NoError(t, err)
+	return card, kp.PrivateKey()
+}
+
+func assertServiceError(t *testing.T, code int, err error) {
+	sdkErr, ok := errors.ToSdkError(err)
+	if assert.True(t, ok, "%v", err) {
+		assert.Equal(t, code, sdkErr.ServiceErrorCode())
+	}
+}
+
+func TestHandlers_CoverAllEndpoints(t *testing.T) {
+	for endpoint := range virgilhttp.HTTPEndpoints {
+		assert.NotNil(t, handlers[endpoint], "endpoint %d", endpoint)
+	}
+}
+
+func TestServer_Cards(t *testing.T) {
+	e := newTestEnv(t)
+	defer e.server.Close()
+
+	alice, aliceKey := e.createCard(t, "alice")
+	assert.Equal(t, "4.0", alice.CardVersion)
+	assert.Contains(t, alice.Signatures, e.server.ServiceCardID())
+
+	card, err := e.client.GetCard(alice.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, alice.ID, card.ID)
+
+	cards, err := e.client.SearchCards(virgil.SearchCriteriaByIdentities("alice", "bob"))
+	assert.NoError(t, err)
+	assert.Len(t, cards, 1)
+
+	cards, err = e.client.SearchCards(virgil.SearchCriteriaByAppBundle("com.example.app"))
+	assert.NoError(t, err)
+	assert.Len(t, cards, 1)
+	assert.Equal(t, e.appID, cards[0].ID)
+
+	//relations
+	bob, _ := e.createCard(t, "bob")
+	req, err := virgil.NewAddRelationRequest(bob)
+	assert.NoError(t, err)
+	assert.NoError(t, (&virgil.RequestSigner{}).AuthoritySign(req, alice.ID, aliceKey))
+	card, err = e.client.AddRelation(req)
+	assert.NoError(t, err)
+	assert.Contains(t, card.Relations, bob.ID)
+
+	_, err = e.client.AddRelation(req)
+	assertServiceError(t, 30203, err)
+
+	req, err = virgil.NewDeleteRelationRequest(bob.ID)
+	assert.NoError(t, err)
+	assert.NoError(t, (&virgil.RequestSigner{}).AuthoritySign(req, alice.ID, aliceKey))
+	card, err = e.client.DeleteRelation(req)
+	assert.NoError(t, err)
+	assert.Empty(t, card.Relations)
+
+	_, err = e.client.DeleteRelation(req)
+	assertServiceError(t, 30205, err)
+
+	//revocation
+	req, err = virgil.NewRevokeCardRequest(alice.ID, virgil.RevocationReason.Compromised)
+	assert.NoError(t, err)
+	assert.NoError(t, (&virgil.RequestSigner{}).AuthoritySign(req, e.appID, e.appKey))
+	assert.NoError(t, e.client.RevokeCard(req))
+
+	_, err = e.client.GetCard(alice.ID)
+	assert.Equal(t, virgil.ErrNotFound, errors.Cause(err))
+}
+
+func TestServer_NetTransportClient(t *testing.T) {
+	e := newTestEnv(t)
+	defer e.server.Close()
+	client, err := e.server.Client(virgil.ClientTransport(virgilhttp.NewNetTransportClient(e.server.URL, e.server.URL, e.server.URL, e.server.URL,
+		virgilhttp.NetTransportClientPFSServiceURL(e.server.URL))))
+	assert.NoError(t, err)
+	e.client = client
+
+	alice, _ := e.createCard(t, "alice")
+	card, err := client.GetCard(alice.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, alice.ID, card.ID)
+
+	count, err := client.CountOneTimePrekeys(alice.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, count.Active)
+
+	req, err := virgil.NewRevokeCardRequest(alice.ID, virgil.RevocationReason.Unspecified)
+	assert.NoError(t, err)
+	assert.NoError(t, (&virgil.RequestSigner{}).AuthoritySign(req, e.appID, e.appKey))
+	assert.NoError(t, client.RevokeCard(req))
+	assert.Equal(t, virgil.ErrNotFound, errors.Cause(client.RevokeCard(req)))
+
+	_, err = client.GetCard(alice.ID)
+	assert.Equal(t, virgil.ErrNotFound, errors.Cause(err))
+}
+
+func TestServer_CreateCard_Errors(t *testing.T) {
+	e := newTestEnv(t)
+	defer e.server.Close()
+
+	kp, err := virgil.Crypto().GenerateKeypair()
+	assert.NoError(t, err)
+	otherKp, err := virgil.Crypto().GenerateKeypair()
+	assert.NoError(t, err)
+	signer := &virgil.RequestSigner{}
+
+	//no application signature
+	req, err := virgil.NewCreateCardRequest("alice", "username", kp.PublicKey(), virgil.CardParams{})
+	assert.NoError(t, err)
+	assert.NoError(t, signer.SelfSign(req, kp.PrivateKey()))
+	_, err = e.client.CreateCard(req)
+	assertServiceError(t, 30128, err)
+
+	//application signature made with another key
+	assert.NoError(t, signer.AuthoritySign(req, e.appID, otherKp.PrivateKey()))
+	_, err = e.client.CreateCard(req)
+	assertServiceError(t, 30128, err)
+
+	//unknown signer
+	req, err = virgil.NewCreateCardRequest("alice", "username", kp.PublicKey(), virgil.CardParams{})
+	assert.NoError(t, err)
+	assert.NoError(t, signer.SelfSign(req, kp.PrivateKey()))
+	assert.NoError(t, signer.AuthoritySign(req, "unknown", otherKp.PrivateKey()))
+	_, err = e.client.CreateCard(req)
+	assertServiceError(t, 30126, err)
+
+	//self signature made with another key
+	req, err = virgil.NewCreateCardRequest("alice", "username", kp.PublicKey(), virgil.CardParams{})
+	assert.NoError(t, err)
+	assert.NoError(t, signer.SelfSign(req, otherKp.PrivateKey()))
+	_, err = e.client.CreateCard(req)
+	assertServiceError(t, 30127, err)
+
+	//duplicate
+	req, err = virgil.NewCreateCardRequest("alice", "username", kp.PublicKey(), virgil.CardParams{})
+	assert.NoError(t, err)
+	assert.NoError(t, signer.SelfSign(req, kp.PrivateKey()))
+	assert.NoError(t, signer.AuthoritySign(req, e.appID, e.appKey))
+	card, err := e.client.CreateCard(req)
+	assert.NoError(t, err)
+	_, err = e.client.CreateCard(req)
+	assertServiceError(t, 30138, err)
+
+	//global cards need the validation token
+	req, err = virgil.NewCreateCardRequest("alice@example.com", "email", kp.PublicKey(), virgil.CardParams{Scope: virgil.CardScope.Global})
+	assert.NoError(t, err)
+	assert.NoError(t, signer.SelfSign(req, kp.PrivateKey()))
+	_, err = e.client.CreateCard(req)
+	assertServiceError(t, 30137, err)
+
+	//wrong access token
+	client, err := virgil.NewClient("wrong", virgil.ClientTransport(virgilhttp.NewTransportClient(e.server.URL, e.server.URL, e.server.URL, e.server.URL)))
+	assert.NoError(t, err)
+	_, err = client.GetCard(card.ID)
+	assertServiceError(t, 20300, err)
+}
+
+func TestServer_GlobalCard(t *testing.T) {
+	e := newTestEnv(t)
+	defer e.server.Close()
+
+	_, err := e.client.VerifyIdentity(&virgil.VerifyRequest{Type: "phone", Value: "alice@example.com"})
+	assertServiceError(t, 40100, err)
+	_, err = e.client.VerifyIdentity(&virgil.VerifyRequest{Type: "email", Value: "alice"})
+	assertServiceError(t, 40200, err)
+
+	verify, err := e.client.VerifyIdentity(&virgil.VerifyRequest{Type: "email", Value: "alice@example.com"})
+	assert.NoError(t, err)
+	code, ok := e.server.ConfirmationCode(verify.ActionId)
+	assert.True(t, ok)
+
+	_, err = e.client.ConfirmIdentity(&virgil.ConfirmRequest{ActionId: verify.ActionId, ConfirmationCode: "wrong"})
+	assertServiceError(t, 40210, err)
+	_, err = e.client.ConfirmIdentity(&virgil.ConfirmRequest{ActionId: "unknown", ConfirmationCode: code})
+	assertServiceError(t, 41000, err)
+
+	confirm, err := e.client.ConfirmIdentity(&virgil.ConfirmRequest{
+		ActionId:         verify.ActionId,
+		ConfirmationCode: code,
+		Params:           virgil.ValidationTokenParams{TimeToLive: 60, CountToLive: 2},
+	})
+	assert.NoError(t, err)
+	assert.NoError(t, e.client.ValidateIdentity(&virgil.ValidateRequest{Type: "email", Value: "alice@example.com", ValidationToken: confirm.ValidationToken}))
+	assertServiceError(t, 40140, e.client.ValidateIdentity(&virgil.ValidateRequest{Type: "email", Value: "bob@example.com", ValidationToken: confirm.ValidationToken}))
+	assertServiceError(t, 40170, e.client.ValidateIdentity(&virgil.ValidateRequest{Type: "email", Value: "alice@example.com", ValidationToken: "wrong"}))
+
+	kp, err := virgil.Crypto().GenerateKeypair()
+	assert.NoError(t, err)
+	req, err := virgil.NewCreateCardRequest("alice@example.com", "email", kp.PublicKey(), virgil.CardParams{Scope: virgil.CardScope.Global})
+	assert.NoError(t, err)
+	assert.NoError(t, (&virgil.RequestSigner{}).SelfSign(req, kp.PrivateKey()))
+	req.Meta.Validation = &virgil.ValidationInfo{Token: confirm.ValidationToken}
+	card, err := e.client.CreateCard(req)
+	assert.NoError(t, err)
+
+	cards, err := e.client.SearchCards(&virgil.Criteria{Scope: virgil.CardScope.Global, Identities: []string{"alice@example.com"}})
+	assert.NoError(t, err)
+	assert.Len(t, cards, 1)
+
+	//the token is used for the second time
+	revoke, err := virgil.NewRevokeCardRequest(card.ID, virgil.RevocationReason.Unspecified)
+	assert.NoError(t, err)
+	assert.NoError(t, (&virgil.RequestSigner{}).AuthoritySign(revoke, card.ID, kp.PrivateKey()))
+	revoke.Meta.Validation = &virgil.ValidationInfo{Token: confirm.ValidationToken}
+	assert.NoError(t, e.client.RevokeCard(revoke))
+
+	assertServiceError(t, 40170, e.client.ValidateIdentity(&virgil.ValidateRequest{Type: "email", Value: "alice@example.com", ValidationToken: confirm.ValidationToken}))
+}
+
+func TestServer_Prekeys(t *testing.T) {
+	e := newTestEnv(t)
+	defer e.server.Close()
+
+	identityCard, identityKey := e.createCard(t, "alice")
+	dir, err := ioutil.TempDir("", "prekeys")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	m := &virgil.PrekeyManager{
+		Client:       e.client,
+		Storage:      &virgil.FileStorage{RootDir: dir},
+		IdentityCard: identityCard,
+		IdentityKey:  identityKey,
+	}
+	longTerm, oneTime, err := m.Publish(2)
+	assert.NoError(t, err)
+	assert.Len(t, oneTime, 2)
+
+	_, err = m.AddOneTimePrekeys(1)
+	assert.NoError(t, err)
+	count, _, err := m.CheckSupply()
+	assert.NoError(t, err)
+	assert.Equal(t, 3, count.Active)
+
+	bundles, err := e.client.ClaimPrekeys(identityCard.ID, "unknown")
+	assert.NoError(t, err)
+	assert.Len(t, bundles, 1)
+	assert.Equal(t, longTerm.ID, bundles[0].LongTermCard.ID)
+	assert.Equal(t, oneTime[0].ID, bundles[0].OneTimeCard.ID)
+
+	exhausted, err := e.client.ValidateOneTimePrekeys(identityCard.ID, []string{oneTime[0].ID, oneTime[1].ID})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{oneTime[0].ID}, exhausted)
+
+	count, err = e.client.CountOneTimePrekeys(identityCard.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, &virgil.PrekeyCount{Active: 2, Exhausted: 1}, count)
+
+	//prekeys signed with another key are rejected
+	bob, bobKey := e.createCard(t, "bob")
+	m.IdentityCard, m.IdentityKey = identityCard, bobKey
+	_, err = m.AddOneTimePrekeys(1)
+	assertServiceError(t, 30127, err)
+
+	m.IdentityCard = bob
+	m.IdentityKey = identityKey
+	_, err = m.AddOneTimePrekeys(1)
+	assertServiceError(t, 30127, err)
+}